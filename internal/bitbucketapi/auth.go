@@ -0,0 +1,399 @@
+package bitbucketapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/bitbucket"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// AuthProvider authenticates the requests of a client.
+type AuthProvider interface {
+	// Client returns a client making the requests of base authenticated.
+	// The context is used for requests obtaining credentials, such as
+	// tokens, for the lifetime of the returned client.
+	Client(ctx context.Context, base *http.Client) *http.Client
+}
+
+// NoAuth makes unauthenticated requests, seeing public resources only.
+type NoAuth struct{}
+
+// Client returns base.
+func (NoAuth) Client(_ context.Context, base *http.Client) *http.Client {
+	return base
+}
+
+// TokenCache keeps the OAuth tokens of a provider beyond the lifetime of its
+// clients, so that a new client reuses a token which is still valid.
+type TokenCache interface {
+	// Token returns the cached token, nil if there is none.
+	Token() *oauth2.Token
+
+	// SetToken stores a newly obtained token.
+	SetToken(token *oauth2.Token)
+}
+
+// ClientCredentials authenticates with the OAuth 2.0 client credentials
+// grant of a consumer.
+type ClientCredentials struct {
+	ClientID     string
+	ClientSecret string
+
+	// TokenURL defaults to the token endpoint of Bitbucket Cloud.
+	TokenURL string
+
+	// Cache, if set, provides the initial token and keeps new ones.
+	Cache TokenCache
+}
+
+// Client returns a client requesting tokens as needed.
+func (p ClientCredentials) Client(ctx context.Context, base *http.Client) *http.Client {
+	tokenURL := p.TokenURL
+	if tokenURL == "" {
+		tokenURL = bitbucket.Endpoint.TokenURL
+	}
+	config := clientcredentials.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		TokenURL:     tokenURL,
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, base)
+	client := oauth2.NewClient(ctx, cachedTokenSource(p.Cache, config.TokenSource(ctx)))
+	client.Timeout = base.Timeout
+	return client
+}
+
+// PasswordCredentials authenticates with the OAuth 2.0 resource owner
+// password grant, for legacy setups whose consumer acts on behalf of an
+// account.
+type PasswordCredentials struct {
+	ClientID     string
+	ClientSecret string
+	Username     string
+	Password     string
+
+	// TokenURL defaults to the token endpoint of Bitbucket Cloud.
+	TokenURL string
+
+	// Cache, if set, provides the initial token and keeps new ones.
+	Cache TokenCache
+}
+
+// Client returns a client requesting tokens as needed.  Expired tokens are
+// replaced by requesting a new one with the password.
+func (p PasswordCredentials) Client(ctx context.Context, base *http.Client) *http.Client {
+	tokenURL := p.TokenURL
+	if tokenURL == "" {
+		tokenURL = bitbucket.Endpoint.TokenURL
+	}
+	config := &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Endpoint:     oauth2.Endpoint{TokenURL: tokenURL},
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, base)
+	source := oauth2.ReuseTokenSource(nil, &passwordTokenSource{
+		ctx:      ctx,
+		config:   config,
+		username: p.Username,
+		password: p.Password,
+	})
+	client := oauth2.NewClient(ctx, cachedTokenSource(p.Cache, source))
+	client.Timeout = base.Timeout
+	return client
+}
+
+type passwordTokenSource struct {
+	ctx      context.Context
+	config   *oauth2.Config
+	username string
+	password string
+}
+
+func (s *passwordTokenSource) Token() (*oauth2.Token, error) {
+	return s.config.PasswordCredentialsToken(s.ctx, s.username, s.password)
+}
+
+// RefreshTokenCredentials authenticates with the OAuth 2.0 refresh token
+// grant, for consumers which are not private and were authorized once with
+// the authorization code grant.
+type RefreshTokenCredentials struct {
+	ClientID     string
+	ClientSecret string
+
+	// RefreshToken is the initial refresh token, used unless the cache
+	// holds a newer one.
+	RefreshToken string
+
+	// TokenURL defaults to the token endpoint of Bitbucket Cloud.
+	TokenURL string
+
+	// Cache, if set, provides the initial token and keeps new ones along
+	// with their refresh tokens.  The refresh token is read from the cache
+	// on every refresh, so that clients sharing the cache use the one most
+	// recently issued.  A cache which also implements sync.Locker is locked
+	// during the refresh, so that only one of those clients rotates it.
+	Cache TokenCache
+}
+
+// Client returns a client refreshing its access token as needed.  A refresh
+// token issued along with a new access token replaces the previous one.
+func (p RefreshTokenCredentials) Client(ctx context.Context, base *http.Client) *http.Client {
+	tokenURL := p.TokenURL
+	if tokenURL == "" {
+		tokenURL = bitbucket.Endpoint.TokenURL
+	}
+	config := &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Endpoint:     oauth2.Endpoint{TokenURL: tokenURL},
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, base)
+	source := &refreshTokenSource{
+		ctx:          ctx,
+		config:       config,
+		cache:        p.Cache,
+		refreshToken: p.RefreshToken,
+	}
+
+	// The source keeps the cache up to date itself, while refreshing.
+	var initial *oauth2.Token
+	if p.Cache != nil {
+		initial = p.Cache.Token()
+	}
+	client := oauth2.NewClient(ctx, oauth2.ReuseTokenSource(initial, source))
+	client.Timeout = base.Timeout
+	return client
+}
+
+type refreshTokenSource struct {
+	ctx    context.Context
+	config *oauth2.Config
+	cache  TokenCache
+
+	mu sync.Mutex
+	// refreshToken is the last refresh token, used when there is no cache
+	// or it holds none yet.
+	refreshToken string
+}
+
+func (s *refreshTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.cache.(sync.Locker); ok {
+		l.Lock()
+		defer l.Unlock()
+	}
+
+	refreshToken := s.refreshToken
+	if s.cache != nil {
+		if cached := s.cache.Token(); cached != nil && cached.RefreshToken != "" {
+			// Another client sharing the cache refreshed meanwhile.
+			if cached.Valid() {
+				return cached, nil
+			}
+			refreshToken = cached.RefreshToken
+		}
+	}
+
+	token, err := s.config.TokenSource(s.ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	s.refreshToken = token.RefreshToken
+	if s.cache != nil {
+		s.cache.SetToken(token)
+	}
+	return token, nil
+}
+
+// cachedTokenSource returns source starting with the token of cache, if
+// any, and storing the tokens it obtains in the cache.
+func cachedTokenSource(cache TokenCache, source oauth2.TokenSource) oauth2.TokenSource {
+	if cache == nil {
+		return source
+	}
+	return oauth2.ReuseTokenSource(cache.Token(), &cachingTokenSource{cache: cache, source: source})
+}
+
+type cachingTokenSource struct {
+	cache  TokenCache
+	source oauth2.TokenSource
+}
+
+func (s *cachingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.cache.SetToken(token)
+	return token, nil
+}
+
+// AppPassword authenticates with the username and an app password of an
+// account using basic authentication.
+type AppPassword struct {
+	Username string
+	Password string
+}
+
+// Client returns a client sending the credentials with every request.
+func (p AppPassword) Client(_ context.Context, base *http.Client) *http.Client {
+	return wrap(base, func(req *http.Request) {
+		req.SetBasicAuth(p.Username, p.Password)
+	})
+}
+
+// APIToken authenticates with the email address and an API token of an
+// Atlassian account using basic authentication.
+type APIToken struct {
+	Email string
+	Token string
+}
+
+// Client returns a client sending the credentials with every request.
+func (p APIToken) Client(_ context.Context, base *http.Client) *http.Client {
+	return wrap(base, func(req *http.Request) {
+		req.SetBasicAuth(p.Email, p.Token)
+	})
+}
+
+// BearerToken authenticates with a fixed access token, such as a repository
+// or workspace access token.
+type BearerToken struct {
+	Token string
+}
+
+// Client returns a client sending the token with every request.
+func (p BearerToken) Client(_ context.Context, base *http.Client) *http.Client {
+	return wrap(base, func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	})
+}
+
+// JWT authenticates as an Atlassian Connect app, signing every request with
+// the shared secret established when the app was installed.
+type JWT struct {
+	// Issuer is the client key of the installation.
+	Issuer string
+	Secret string
+
+	// Expiry is the validity of the tokens, 3 minutes when zero.
+	Expiry time.Duration
+
+	now func() time.Time
+}
+
+// Client returns a client signing every request with a new token.
+func (p JWT) Client(_ context.Context, base *http.Client) *http.Client {
+	return wrap(base, func(req *http.Request) {
+		req.Header.Set("Authorization", "JWT "+p.token(req.Method, req.URL))
+	})
+}
+
+// token returns a token bound to the method, path and query of a request by
+// its query string hash.
+func (p JWT) token(method string, u *url.URL) string {
+	now := time.Now
+	if p.now != nil {
+		now = p.now
+	}
+	expiry := p.Expiry
+	if expiry <= 0 {
+		expiry = 3 * time.Minute
+	}
+
+	qsh := sha256.Sum256([]byte(canonicalRequest(method, u)))
+	issued := now()
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss": p.Issuer,
+		"iat": issued.Unix(),
+		"exp": issued.Add(expiry).Unix(),
+		"qsh": hex.EncodeToString(qsh[:]),
+	})
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString(claims)
+	mac := hmac.New(sha256.New, []byte(p.Secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalRequest returns the request in the canonical form of the query
+// string hash: the method, the path and the sorted query parameters, joined
+// by ampersands.
+func canonicalRequest(method string, u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	path = strings.Replace(path, "&", "%26", -1)
+
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		if k != "jwt" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for i, v := range values {
+			values[i] = percentEncode(v)
+		}
+		params = append(params, percentEncode(k)+"="+strings.Join(values, ","))
+	}
+	return strings.ToUpper(method) + "&" + path + "&" + strings.Join(params, "&")
+}
+
+// percentEncode encodes s as in RFC 3986, with spaces as %20.
+func percentEncode(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// wrap returns a copy of base whose requests are modified by authorize.
+func wrap(base *http.Client, authorize func(*http.Request)) *http.Client {
+	transport := base.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	client := *base
+	client.Transport = &authTransport{base: transport, authorize: authorize}
+	return &client
+}
+
+type authTransport struct {
+	base      http.RoundTripper
+	authorize func(*http.Request)
+}
+
+// RoundTrip authorizes a copy of the request, as round trippers must not
+// modify the request.
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	t.authorize(r)
+	return t.base.RoundTrip(r)
+}
@@ -0,0 +1,177 @@
+package bitbucketapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// tokenRequest holds the form of the last token request.
+var tokenRequest url.Values
+
+// authorization returns the Authorization header the client sends.
+func authorization(t *testing.T, p AuthProvider) (string, *http.Request) {
+	tokenRequest = nil
+	var header string
+	var request *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			r.ParseForm()
+			tokenRequest = r.PostForm
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token": "issued", "token_type": "bearer", "expires_in": 3600}`))
+			return
+		}
+		header = r.Header.Get("Authorization")
+		request = r
+	}))
+	defer ts.Close()
+
+	switch c := p.(type) {
+	case ClientCredentials:
+		c.TokenURL = ts.URL + "/token"
+		p = c
+	case PasswordCredentials:
+		c.TokenURL = ts.URL + "/token"
+		p = c
+	case RefreshTokenCredentials:
+		c.TokenURL = ts.URL + "/token"
+		p = c
+	}
+	base := &http.Client{Timeout: time.Second}
+	resp, err := p.Client(context.Background(), base).Get(ts.URL + "/2.0/user?b=2&a=1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	return header, request
+}
+
+func TestAuthProviders(t *testing.T) {
+	header, _ := authorization(t, NoAuth{})
+	require.Equal(t, "", header)
+
+	header, _ = authorization(t, AppPassword{Username: "jdoe", Password: "secret"})
+	require.Equal(t, "Basic amRvZTpzZWNyZXQ=", header)
+
+	header, _ = authorization(t, APIToken{Email: "jdoe@example.com", Token: "secret"})
+	require.Equal(t, "Basic amRvZUBleGFtcGxlLmNvbTpzZWNyZXQ=", header)
+
+	header, _ = authorization(t, BearerToken{Token: "token"})
+	require.Equal(t, "Bearer token", header)
+
+	header, _ = authorization(t, ClientCredentials{ClientID: "key", ClientSecret: "secret"})
+	require.Equal(t, "Bearer issued", header)
+	require.Equal(t, "client_credentials", tokenRequest.Get("grant_type"))
+
+	header, _ = authorization(t, PasswordCredentials{ClientID: "key", ClientSecret: "secret", Username: "jdoe", Password: "pass"})
+	require.Equal(t, "Bearer issued", header)
+	require.Equal(t, "password", tokenRequest.Get("grant_type"))
+	require.Equal(t, "jdoe", tokenRequest.Get("username"))
+	require.Equal(t, "pass", tokenRequest.Get("password"))
+
+	header, _ = authorization(t, RefreshTokenCredentials{ClientID: "key", ClientSecret: "secret", RefreshToken: "initial"})
+	require.Equal(t, "Bearer issued", header)
+	require.Equal(t, "refresh_token", tokenRequest.Get("grant_type"))
+	require.Equal(t, "initial", tokenRequest.Get("refresh_token"))
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	var refreshTokens []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			r.ParseForm()
+			refreshTokens = append(refreshTokens, r.PostForm.Get("refresh_token"))
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token": "issued", "token_type": "bearer", "expires_in": 1, "refresh_token": "rotated"}`))
+			return
+		}
+	}))
+	defer ts.Close()
+
+	// The cached refresh token is newer than the configured one.
+	cache := &memoryTokenCache{token: &oauth2.Token{RefreshToken: "cached"}}
+	p := RefreshTokenCredentials{ClientID: "key", ClientSecret: "secret", RefreshToken: "initial", TokenURL: ts.URL + "/token", Cache: cache}
+	client := p.Client(context.Background(), &http.Client{Timeout: time.Second})
+
+	// Tokens expiring within ten seconds count as expired, every request
+	// refreshes.
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(ts.URL + "/2.0/user")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	require.Equal(t, []string{"cached", "rotated"}, refreshTokens)
+	require.Equal(t, "rotated", cache.token.RefreshToken)
+}
+
+type memoryTokenCache struct {
+	token *oauth2.Token
+}
+
+func (c *memoryTokenCache) Token() *oauth2.Token         { return c.token }
+func (c *memoryTokenCache) SetToken(token *oauth2.Token) { c.token = token }
+
+func TestTokenCache(t *testing.T) {
+	cache := &memoryTokenCache{token: &oauth2.Token{
+		AccessToken: "cached",
+		TokenType:   "bearer",
+		Expiry:      time.Now().Add(time.Hour),
+	}}
+	header, _ := authorization(t, ClientCredentials{ClientID: "key", ClientSecret: "secret", Cache: cache})
+	require.Equal(t, "Bearer cached", header)
+	require.Nil(t, tokenRequest)
+
+	cache.token.Expiry = time.Now().Add(-time.Minute)
+	header, _ = authorization(t, PasswordCredentials{ClientID: "key", ClientSecret: "secret", Username: "jdoe", Password: "pass", Cache: cache})
+	require.Equal(t, "Bearer issued", header)
+	require.Equal(t, "password", tokenRequest.Get("grant_type"))
+	require.Equal(t, "issued", cache.token.AccessToken)
+	require.True(t, cache.token.Expiry.After(time.Now()))
+}
+
+func TestJWT(t *testing.T) {
+	now := time.Unix(1580515200, 0)
+	p := JWT{Issuer: "client-key", Secret: "shared", now: func() time.Time { return now }}
+
+	header, r := authorization(t, p)
+	require.True(t, strings.HasPrefix(header, "JWT "))
+	parts := strings.Split(strings.TrimPrefix(header, "JWT "), ".")
+	require.Len(t, parts, 3)
+
+	mac := hmac.New(sha256.New, []byte("shared"))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	require.Equal(t, base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), parts[2])
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	var claims map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &claims))
+
+	qsh := sha256.Sum256([]byte("GET&/2.0/user&a=1&b=2"))
+	require.Equal(t, map[string]interface{}{
+		"iss": "client-key",
+		"iat": float64(1580515200),
+		"exp": float64(1580515380),
+		"qsh": hex.EncodeToString(qsh[:]),
+	}, claims)
+	require.Equal(t, "/2.0/user", r.URL.Path)
+}
+
+func TestCanonicalRequest(t *testing.T) {
+	u, err := url.Parse("https://api.bitbucket.org/2.0/repositories/acme?q=state%20%3D%20%22OPEN%22&fields=a,b&jwt=x&state=OPEN&state=MERGED")
+	require.NoError(t, err)
+	require.Equal(t,
+		"GET&/2.0/repositories/acme&fields=a%2Cb&q=state%20%3D%20%22OPEN%22&state=MERGED,OPEN",
+		canonicalRequest("get", u))
+}
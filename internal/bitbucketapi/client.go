@@ -0,0 +1,339 @@
+package bitbucketapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Observer is notified of the requests of a client, e.g. to keep statistics.
+type Observer interface {
+	// Request is called before a request is sent and returns the context
+	// to send it with.
+	Request(ctx context.Context) context.Context
+
+	// Failure is called for every failed request, with the class of the
+	// failure.  Responses with a status passed to ExpectStatus are reported
+	// as well, see IsExpectedStatus.
+	Failure(ctx context.Context, url string, class string, err error)
+}
+
+// Client makes requests to the API.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	semaphore  chan struct{}
+
+	// Limiter limits the rate of requests, when set.
+	Limiter *RateLimiter
+
+	// Adaptive limits the concurrent requests by the health of the
+	// responses, when set.
+	Adaptive *AdaptiveLimiter
+
+	// Observer is notified of the requests, when set.
+	Observer Observer
+
+	// Prefetch fetches the next page of a collection while the current one
+	// is processed.
+	Prefetch bool
+}
+
+// NewClient returns a client limiting its concurrent requests, along with
+// those of other clients sharing the semaphore, to its capacity.
+func NewClient(httpClient *http.Client, baseURL string, semaphore chan struct{}) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+		semaphore:  semaphore,
+	}
+}
+
+// Page is the envelope Bitbucket wraps around paginated collections.
+type Page struct {
+	Values json.RawMessage `json:"values"`
+	Next   string          `json:"next"`
+}
+
+// Get fetches a single resource below the API root and decodes it into v.
+func (c *Client) Get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	_, err := c.doGet(ctx, c.URL(path, params), v)
+	return err
+}
+
+// GetHeader is like Get but also returns the response headers.
+func (c *Client) GetHeader(ctx context.Context, path string, params url.Values, v interface{}) (http.Header, error) {
+	return c.doGet(ctx, c.URL(path, params), v)
+}
+
+// ErrStopPaging can be returned by the callback of GetPages to stop walking
+// the remaining pages without failing.
+var ErrStopPaging = errors.New("stop paging")
+
+// GetPages walks every page of a collection, handing the raw values of each
+// page to fn.
+func (c *Client) GetPages(ctx context.Context, path string, params url.Values, fn func(values json.RawMessage) error) error {
+	if c.Prefetch {
+		return c.getPagesPrefetched(ctx, path, params, fn)
+	}
+
+	next := c.URL(path, params)
+	for next != "" {
+		p := new(Page)
+		if _, err := c.doGet(ctx, next, p); err != nil {
+			return err
+		}
+		if err := fn(p.Values); err == ErrStopPaging {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		next = p.Next
+	}
+	return nil
+}
+
+// getPagesPrefetched is like GetPages but requests the next page before
+// handing the current one to fn.  When paging stops early the request of the
+// next page is canceled.
+func (c *Client) getPagesPrefetched(ctx context.Context, path string, params url.Values, fn func(values json.RawMessage) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		page *Page
+		err  error
+	}
+	fetch := func(url string) <-chan result {
+		ch := make(chan result, 1)
+		go func() {
+			p := new(Page)
+			_, err := c.doGet(ctx, url, p)
+			ch <- result{page: p, err: err}
+		}()
+		return ch
+	}
+
+	pending := fetch(c.URL(path, params))
+	for pending != nil {
+		r := <-pending
+		if r.err != nil {
+			return r.err
+		}
+		pending = nil
+		if r.page.Next != "" {
+			pending = fetch(r.page.Next)
+		}
+		if err := fn(r.page.Values); err == ErrStopPaging {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// URL returns the URL of path below the API root with the query params.
+func (c *Client) URL(path string, params url.Values) string {
+	u := c.baseURL + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	return u
+}
+
+func (c *Client) doGet(ctx context.Context, url string, v interface{}) (http.Header, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/json")
+
+	// As only GET requests are made, requests failing with a transient
+	// transport error, such as a keep-alive connection closed by the
+	// server, are sent again.  Every attempt waits for the limits like a
+	// request of its own.
+	buf := getBuffer()
+	defer putBuffer(buf)
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		release, err := c.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sendCtx := ctx
+		if c.Observer != nil {
+			sendCtx = c.Observer.Request(ctx)
+		}
+		resp, err = c.send(sendCtx, req, buf)
+		release(resp, err)
+		if err == nil {
+			break
+		}
+		if attempt >= maxTransientRetries || !IsTransient(err) || ctx.Err() != nil {
+			c.failure(sendCtx, url, ClassNetwork, err)
+			if resp != nil {
+				return resp.Header, err
+			}
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := APIError{
+			URL:        url,
+			StatusCode: resp.StatusCode,
+			Title:      resp.Status,
+		}
+		var body errorResponse
+		if json.Unmarshal(buf.Bytes(), &body) == nil {
+			apiErr.Description = body.Error.Message
+		}
+		c.failure(ctx, url, ClassifyStatus(resp.StatusCode), apiErr)
+		return resp.Header, apiErr
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), v); err != nil {
+		c.failure(ctx, url, ClassParse, err)
+		return resp.Header, err
+	}
+	return resp.Header, nil
+}
+
+// acquire waits until a request may be sent by the rate limit, the adaptive
+// limit and the semaphore.  The returned function frees the slots once the
+// request was sent, the adaptive limit learning from its status and latency.
+func (c *Client) acquire(ctx context.Context) (func(*http.Response, error), error) {
+	// Wait for the rate limit before taking a connection, so that waiting
+	// requests do not hold up the others.
+	if c.Limiter != nil {
+		if err := c.Limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var generation int
+	if c.Adaptive != nil {
+		var err error
+		if generation, err = c.Adaptive.acquire(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	select {
+	case c.semaphore <- struct{}{}:
+	case <-ctx.Done():
+		if c.Adaptive != nil {
+			c.Adaptive.abandon()
+		}
+		return nil, ctx.Err()
+	}
+
+	start := time.Now()
+	return func(resp *http.Response, err error) {
+		<-c.semaphore
+		if c.Adaptive == nil {
+			return
+		}
+		// Canceled requests tell nothing about the load.
+		if ctx.Err() != nil {
+			c.Adaptive.abandon()
+			return
+		}
+		var statusCode int
+		if err == nil {
+			statusCode = resp.StatusCode
+		}
+		c.Adaptive.release(generation, time.Since(start), statusCode)
+	}, nil
+}
+
+// maxTransientRetries is how often a request failing with a transient
+// transport error is sent again.
+const maxTransientRetries = 2
+
+// send sends the request once, reading the body of the response into buf.
+func (c *Client) send(ctx context.Context, req *http.Request, buf *bytes.Buffer) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	buf.Reset()
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+func (c *Client) failure(ctx context.Context, url string, class string, err error) {
+	if c.Observer != nil {
+		c.Observer.Failure(ctx, url, class, err)
+	}
+}
+
+// maxPooledBuffer is the capacity above which buffers are left to the
+// garbage collector, so that a single huge response does not stay pinned.
+const maxPooledBuffer = 1 << 20
+
+// bufferPool holds the buffers response bodies are read into.  Decoded
+// json.RawMessage values copy their bytes, so buffers can be reused as soon
+// as the body is decoded.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// APIError is returned when the Bitbucket API answers with a non 2xx status.
+type APIError struct {
+	URL         string
+	StatusCode  int
+	Title       string
+	Description string
+}
+
+func (e APIError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("[%s] %s: %s", e.URL, e.Title, e.Description)
+	}
+	return fmt.Sprintf("[%s] %s", e.URL, e.Title)
+}
+
+// IsStatus returns whether err is an APIError with one of the status codes.
+func IsStatus(err error, codes ...int) bool {
+	apiErr, ok := err.(APIError)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if apiErr.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+package bitbucketapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer returns a server answering the requests of the paths, with
+// the page query parameter, with the responses and all others with a 404.
+// {{URL}} in the responses is replaced by the URL of the server.
+func newTestServer(t *testing.T, responses map[string]string) *httptest.Server {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path
+		if r.URL.Query().Get("page") != "" {
+			key += "?page=" + r.URL.Query().Get("page")
+		}
+		body, ok := responses[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"type": "error", "error": {"message": "not found"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, strings.Replace(body, "{{URL}}", ts.URL, -1))
+	}))
+	return ts
+}
+
+func TestGetPagesPrefetched(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/items":        `{"values": [1, 2], "next": "{{URL}}/items?page=2"}`,
+		"/items?page=2": `{"values": [3], "next": "{{URL}}/items?page=3"}`,
+		"/items?page=3": `{"values": [4]}`,
+	})
+	defer ts.Close()
+
+	c := NewClient(http.DefaultClient, ts.URL, make(chan struct{}, 2))
+	c.Prefetch = true
+
+	collect := func(stopAt int) []int {
+		var items []int
+		err := c.GetPages(context.Background(), "/items", nil, func(values json.RawMessage) error {
+			var page []int
+			if err := json.Unmarshal(values, &page); err != nil {
+				return err
+			}
+			items = append(items, page...)
+			if len(items) >= stopAt {
+				return ErrStopPaging
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		return items
+	}
+
+	require.Equal(t, []int{1, 2, 3, 4}, collect(10))
+	require.Equal(t, []int{1, 2, 3}, collect(3))
+}
+
+func TestGetPagesPrefetchedError(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/items": `{"values": [1], "next": "{{URL}}/missing"}`,
+	})
+	defer ts.Close()
+
+	c := NewClient(http.DefaultClient, ts.URL, make(chan struct{}, 2))
+	c.Prefetch = true
+
+	var pages int
+	err := c.GetPages(context.Background(), "/items", nil, func(values json.RawMessage) error {
+		pages++
+		return nil
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, pages)
+}
+
+func TestGetReusesBuffersSafely(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/a": `{"values": ["first"]}`,
+		"/b": `{"values": ["second, which is longer"]}`,
+	})
+	defer ts.Close()
+
+	c := NewClient(http.DefaultClient, ts.URL, make(chan struct{}, 1))
+	var a, b Page
+	require.NoError(t, c.Get(context.Background(), "/a", nil, &a))
+	require.NoError(t, c.Get(context.Background(), "/b", nil, &b))
+	require.JSONEq(t, `["first"]`, string(a.Values))
+	require.JSONEq(t, `["second, which is longer"]`, string(b.Values))
+}
+
+func TestGetCanceledLeavesAdaptiveLimit(t *testing.T) {
+	ts := newTestServer(t, map[string]string{"/a": `{}`})
+	defer ts.Close()
+
+	semaphore := make(chan struct{}, 1)
+	c := NewClient(http.DefaultClient, ts.URL, semaphore)
+	c.Adaptive = NewAdaptiveLimiter(4, time.Millisecond)
+
+	// The request times out waiting for a connection and is never sent.
+	semaphore <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, c.Get(ctx, "/a", nil, &Page{}))
+	<-semaphore
+
+	require.Equal(t, 4, c.Adaptive.CurrentLimit())
+	for i := 0; i < 4; i++ {
+		_, err := c.Adaptive.acquire(context.Background())
+		require.NoError(t, err)
+	}
+}
+
+type failure struct {
+	class    string
+	expected bool
+}
+
+type testObserver struct {
+	requests int
+	failures []failure
+}
+
+func (o *testObserver) Request(ctx context.Context) context.Context {
+	o.requests++
+	return ctx
+}
+
+func (o *testObserver) Failure(ctx context.Context, url string, class string, err error) {
+	var expected bool
+	if apiErr, ok := err.(APIError); ok {
+		expected = IsExpectedStatus(ctx, apiErr.StatusCode)
+	}
+	o.failures = append(o.failures, failure{class: class, expected: expected})
+}
+
+func TestObserver(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/a":       `{}`,
+		"/invalid": `{`,
+	})
+	defer ts.Close()
+
+	o := &testObserver{}
+	c := NewClient(http.DefaultClient, ts.URL, make(chan struct{}, 1))
+	c.Observer = o
+
+	ctx := context.Background()
+	var v struct{}
+	require.NoError(t, c.Get(ctx, "/a", nil, &v))
+	require.Error(t, c.Get(ctx, "/invalid", nil, &v))
+
+	err := c.Get(ExpectStatus(ctx, http.StatusNotFound), "/missing", nil, &v)
+	require.True(t, IsStatus(err, http.StatusNotFound))
+	require.False(t, IsStatus(err, http.StatusForbidden))
+
+	require.Equal(t, 3, o.requests)
+	require.Equal(t, []failure{
+		{class: ClassParse},
+		{class: ClassAPI, expected: true},
+	}, o.failures)
+}
+
+func TestClassifyStatus(t *testing.T) {
+	require.Equal(t, ClassAuth, ClassifyStatus(http.StatusUnauthorized))
+	require.Equal(t, ClassAuth, ClassifyStatus(http.StatusForbidden))
+	require.Equal(t, ClassRateLimit, ClassifyStatus(http.StatusTooManyRequests))
+	require.Equal(t, ClassAPI, ClassifyStatus(http.StatusInternalServerError))
+}
+
+func TestGetRetriesTransientErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		failures int
+		err      bool
+	}{
+		{name: "recovers", failures: 2},
+		{name: "gives up", failures: 3, err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= tt.failures {
+					// Drop the connection as a server closing it would.
+					conn, _, err := w.(http.Hijacker).Hijack()
+					require.NoError(t, err)
+					conn.Close()
+					return
+				}
+				fmt.Fprint(w, `{"slug": "api"}`)
+			}))
+			defer ts.Close()
+
+			observer := &testObserver{}
+			client := NewClient(ts.Client(), ts.URL, make(chan struct{}, 1))
+			client.Observer = observer
+
+			// Every attempt takes a token of the rate limit, the clock
+			// standing still refills none.
+			now := time.Now()
+			client.Limiter = NewRateLimiter(1, 3)
+			client.Limiter.now = func() time.Time { return now }
+			client.Adaptive = NewAdaptiveLimiter(4, 0)
+
+			var repo struct {
+				Slug string `json:"slug"`
+			}
+			err := client.Get(context.Background(), "/repositories/acme/api", nil, &repo)
+			require.Equal(t, 3, requests)
+			require.Equal(t, 0.0, client.Limiter.tokens)
+			if tt.err {
+				require.Error(t, err)
+				require.True(t, IsTransient(err))
+				require.Equal(t, []failure{{class: ClassNetwork}}, observer.failures)
+				require.Equal(t, 1, client.Adaptive.CurrentLimit())
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "api", repo.Slug)
+			require.Empty(t, observer.failures)
+
+			// Both failures halved the adaptive limit, the success raised
+			// it again.
+			require.Equal(t, 2, client.Adaptive.CurrentLimit())
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	require.True(t, IsTransient(io.EOF))
+	require.True(t, IsTransient(&url.Error{Op: "Get", URL: "https://api.bitbucket.org", Err: io.ErrUnexpectedEOF}))
+	require.True(t, IsTransient(errors.New("read tcp 10.0.0.1:4242->104.192.141.1:443: read: connection reset by peer")))
+	require.False(t, IsTransient(context.Canceled))
+	require.False(t, IsTransient(APIError{StatusCode: http.StatusBadGateway}))
+	require.False(t, IsTransient(nil))
+}
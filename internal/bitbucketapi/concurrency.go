@@ -0,0 +1,109 @@
+package bitbucketapi
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AdaptiveLimiter bounds the concurrent requests by a limit which is halved
+// when requests are throttled or slow and raised by one after as many healthy
+// requests as the limit allows, up to the configured maximum.
+type AdaptiveLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	max       int
+	inFlight  int
+	successes int
+	threshold time.Duration
+
+	// generation counts the decreases, so that the requests in flight
+	// when the limit was lowered do not lower it again.
+	generation int
+
+	// wake is closed and replaced whenever a slot may have become free.
+	wake chan struct{}
+}
+
+// NewAdaptiveLimiter returns a limiter starting at and bounded by max
+// concurrent requests, treating requests slower than threshold as overload.
+// A zero threshold only considers throttled requests.
+func NewAdaptiveLimiter(max int, threshold time.Duration) *AdaptiveLimiter {
+	return &AdaptiveLimiter{
+		limit:     max,
+		max:       max,
+		threshold: threshold,
+		wake:      make(chan struct{}),
+	}
+}
+
+// acquire waits for a free slot and returns the generation to hand back to
+// release.
+func (l *AdaptiveLimiter) acquire(ctx context.Context) (int, error) {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			generation := l.generation
+			l.mu.Unlock()
+			return generation, nil
+		}
+		wake := l.wake
+		l.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// release frees the slot of a request, adjusting the limit by its latency
+// and status code.  A status code of 0, when the request failed without a
+// complete response, counts as overload like a throttled request.
+func (l *AdaptiveLimiter) release(generation int, latency time.Duration, statusCode int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	throttled := statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+	if throttled || (l.threshold > 0 && latency > l.threshold) {
+		if generation == l.generation && l.limit > 1 {
+			l.limit /= 2
+			l.generation++
+		}
+		l.successes = 0
+	} else if l.limit < l.max {
+		l.successes++
+		if l.successes >= l.limit {
+			l.limit++
+			l.successes = 0
+		}
+	}
+
+	l.free()
+}
+
+// abandon frees the slot of a request which was not sent or was canceled,
+// leaving the limit as it is.
+func (l *AdaptiveLimiter) abandon() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.free()
+}
+
+// free wakes the requests waiting for a slot.  The caller holds mu.
+func (l *AdaptiveLimiter) free() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// CurrentLimit returns the current concurrency limit.
+func (l *AdaptiveLimiter) CurrentLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
@@ -0,0 +1,88 @@
+package bitbucketapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveLimiterDecreasesOncePerGeneration(t *testing.T) {
+	l := NewAdaptiveLimiter(8, time.Second)
+	ctx := context.Background()
+
+	var generations []int
+	for i := 0; i < 4; i++ {
+		g, err := l.acquire(ctx)
+		require.NoError(t, err)
+		generations = append(generations, g)
+	}
+
+	// All requests in flight are throttled, the limit is halved only once.
+	for _, g := range generations {
+		l.release(g, time.Millisecond, http.StatusTooManyRequests)
+	}
+	require.Equal(t, 4, l.CurrentLimit())
+
+	// Slow requests of the new generation halve it again.
+	g, err := l.acquire(ctx)
+	require.NoError(t, err)
+	l.release(g, 2*time.Second, http.StatusOK)
+	require.Equal(t, 2, l.CurrentLimit())
+}
+
+func TestAdaptiveLimiterRecovers(t *testing.T) {
+	l := NewAdaptiveLimiter(3, time.Second)
+	ctx := context.Background()
+
+	g, err := l.acquire(ctx)
+	require.NoError(t, err)
+	l.release(g, time.Millisecond, http.StatusServiceUnavailable)
+	require.Equal(t, 1, l.CurrentLimit())
+
+	// A limit of n is raised after n healthy requests.
+	for _, expected := range []int{2, 2, 3, 3, 3, 3} {
+		g, err := l.acquire(ctx)
+		require.NoError(t, err)
+		l.release(g, time.Millisecond, http.StatusOK)
+		require.Equal(t, expected, l.CurrentLimit())
+	}
+}
+
+func TestAdaptiveLimiterBlocksAtLimit(t *testing.T) {
+	l := NewAdaptiveLimiter(1, 0)
+	g, err := l.acquire(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(ctx)
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	done := make(chan struct{})
+	go func() {
+		_, err := l.acquire(context.Background())
+		require.NoError(t, err)
+		close(done)
+	}()
+	l.release(g, time.Millisecond, http.StatusOK)
+	<-done
+}
+
+func TestAdaptiveLimiterAbandon(t *testing.T) {
+	l := NewAdaptiveLimiter(1, time.Second)
+	_, err := l.acquire(context.Background())
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		_, err := l.acquire(context.Background())
+		require.NoError(t, err)
+		close(done)
+	}()
+	l.abandon()
+	<-done
+	require.Equal(t, 1, l.CurrentLimit())
+}
@@ -0,0 +1,7 @@
+// Package bitbucketapi is a client of the Bitbucket Cloud 2.0 REST API, shared
+// by the Bitbucket plugins.  It walks paginated collections and bounds the
+// requests by a connection limit, an optional rate limit and an optional
+// adaptive concurrency limit.  Authentication is left to the http.Client the
+// client is created with.  Common collections, such as the repositories and
+// pull requests, can be listed decoded into the exported resource types.
+package bitbucketapi
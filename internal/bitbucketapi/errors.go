@@ -0,0 +1,84 @@
+package bitbucketapi
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The classes of failed requests.
+const (
+	ClassAuth      = "auth"
+	ClassRateLimit = "rate_limit"
+	ClassNetwork   = "network"
+	ClassParse     = "parse"
+	ClassAPI       = "api"
+)
+
+// ClassifyStatus returns the class of an unsuccessful response.
+func ClassifyStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ClassAuth
+	case http.StatusTooManyRequests:
+		return ClassRateLimit
+	default:
+		return ClassAPI
+	}
+}
+
+type expectedStatusKey struct{}
+
+// ExpectStatus returns a context marking the given response statuses as
+// handled by the caller, so that observers need not report them as failed
+// requests.
+func ExpectStatus(ctx context.Context, codes ...int) context.Context {
+	return context.WithValue(ctx, expectedStatusKey{}, codes)
+}
+
+// IsExpectedStatus returns whether the status was marked as handled by
+// ExpectStatus.
+func IsExpectedStatus(ctx context.Context, statusCode int) bool {
+	codes, _ := ctx.Value(expectedStatusKey{}).([]int)
+	for _, code := range codes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// transientErrors are the messages of transport failures caused by the
+// server closing a connection, typically a keep-alive connection reused just
+// as it was closed.
+var transientErrors = []string{
+	"connection reset by peer",
+	"broken pipe",
+	"unexpected EOF",
+	"server closed idle connection",
+	"use of closed network connection",
+	"http2: server sent GOAWAY",
+}
+
+// IsTransient returns whether err is a transport failure which is likely to
+// succeed when the request is sent again.
+func IsTransient(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if err == nil {
+		return false
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	msg := err.Error()
+	for _, s := range transientErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package bitbucketapi
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// WorkspacePath returns the path of a workspace.
+func WorkspacePath(workspace string) string {
+	return "/workspaces/" + url.PathEscape(workspace)
+}
+
+// RepositoriesPath returns the path of the repositories of a workspace.
+func RepositoriesPath(workspace string) string {
+	return "/repositories/" + url.PathEscape(workspace)
+}
+
+// RepositoryPath returns the path of a repository.
+func RepositoryPath(workspace, slug string) string {
+	return RepositoriesPath(workspace) + "/" + url.PathEscape(slug)
+}
+
+// PullRequestsPath returns the path of the pull requests of a repository.
+func PullRequestsPath(workspace, slug string) string {
+	return RepositoryPath(workspace, slug) + "/pullrequests"
+}
+
+// PullRequestPath returns the path of a pull request.
+func PullRequestPath(workspace, slug string, id int64) string {
+	return PullRequestsPath(workspace, slug) + "/" + strconv.FormatInt(id, 10)
+}
+
+// HooksPath returns the path of the webhooks of a repository.
+func HooksPath(workspace, slug string) string {
+	return RepositoryPath(workspace, slug) + "/hooks"
+}
+
+// HookPath returns the path of a webhook of a repository.
+func HookPath(workspace, slug, uuid string) string {
+	return HooksPath(workspace, slug) + "/" + url.PathEscape(uuid)
+}
+
+// PipelinesPath returns the path of the pipelines of a repository.
+func PipelinesPath(workspace, slug string) string {
+	return RepositoryPath(workspace, slug) + "/pipelines/"
+}
+
+// UserSSHKeysPath returns the path of the SSH keys of a user.
+func UserSSHKeysPath(accountID string) string {
+	return "/users/" + url.PathEscape(accountID) + "/ssh-keys"
+}
+
+// CommitsPath returns the path of the commits reachable from a revision of
+// a repository, such as a branch.
+func CommitsPath(workspace, slug, revision string) string {
+	return RepositoryPath(workspace, slug) + "/commits/" + url.PathEscape(revision)
+}
+
+// CommitPath returns the path of a commit of a repository.
+func CommitPath(workspace, slug, hash string) string {
+	return RepositoryPath(workspace, slug) + "/commit/" + url.PathEscape(hash)
+}
+
+// CommitStatusesPath returns the path of the build statuses of a commit.
+func CommitStatusesPath(workspace, slug, hash string) string {
+	return CommitPath(workspace, slug, hash) + "/statuses"
+}
+
+// PullRequestStatusesPath returns the path of the build statuses of the
+// source commit of a pull request.
+func PullRequestStatusesPath(workspace, slug string, id int64) string {
+	return PullRequestPath(workspace, slug, id) + "/statuses"
+}
+
+// BranchRestrictionsPath returns the path of the branch restrictions of a
+// repository, which include its merge checks.
+func BranchRestrictionsPath(workspace, slug string) string {
+	return RepositoryPath(workspace, slug) + "/branch-restrictions"
+}
+
+// PullRequestActivityPath returns the path of the activity log of a pull
+// request, its comments, approvals and updates.
+func PullRequestActivityPath(workspace, slug string, id int64) string {
+	return PullRequestPath(workspace, slug, id) + "/activity"
+}
@@ -0,0 +1,36 @@
+package bitbucketapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(2, 2)
+	l.now = func() time.Time { return now }
+
+	// The burst is available right away, further requests are spaced out.
+	require.Equal(t, time.Duration(0), l.reserve())
+	require.Equal(t, time.Duration(0), l.reserve())
+	require.Equal(t, 500*time.Millisecond, l.reserve())
+	require.Equal(t, time.Second, l.reserve())
+
+	// Tokens refill over time, up to the burst.
+	now = now.Add(time.Hour)
+	require.Equal(t, time.Duration(0), l.reserve())
+	require.Equal(t, time.Duration(0), l.reserve())
+	require.Equal(t, 500*time.Millisecond, l.reserve())
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+	l := NewRateLimiter(0.001, 1)
+	require.NoError(t, l.wait(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, l.wait(ctx))
+}
@@ -0,0 +1,104 @@
+package bitbucketapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+// User is an account as referenced by other resources, such as the author
+// of a pull request.
+type User struct {
+	DisplayName string `json:"display_name"`
+	Nickname    string `json:"nickname"`
+	AccountID   string `json:"account_id"`
+	UUID        string `json:"uuid"`
+}
+
+// Repository is a repository of a workspace.
+type Repository struct {
+	UUID      string    `json:"uuid"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	FullName  string    `json:"full_name"`
+	IsPrivate bool      `json:"is_private"`
+	Size      int64     `json:"size"`
+	Language  string    `json:"language"`
+	HasIssues bool      `json:"has_issues"`
+	HasWiki   bool      `json:"has_wiki"`
+	CreatedOn time.Time `json:"created_on"`
+	UpdatedOn time.Time `json:"updated_on"`
+	Project   struct {
+		Key  string `json:"key"`
+		Name string `json:"name"`
+	} `json:"project"`
+	MainBranch struct {
+		Name string `json:"name"`
+	} `json:"mainbranch"`
+
+	// Parent is set on forks only.
+	Parent *struct {
+		FullName string `json:"full_name"`
+	} `json:"parent"`
+}
+
+// PullRequestEndpoint is the source or destination of a pull request.
+type PullRequestEndpoint struct {
+	Branch struct {
+		Name string `json:"name"`
+	} `json:"branch"`
+	Commit struct {
+		Hash string `json:"hash"`
+	} `json:"commit"`
+}
+
+// Participant is a reviewer or participant of a pull request.
+type Participant struct {
+	Role           string    `json:"role"`
+	Approved       bool      `json:"approved"`
+	State          string    `json:"state"`
+	ParticipatedOn time.Time `json:"participated_on"`
+	User           User      `json:"user"`
+}
+
+// PullRequest is a pull request of a repository.
+type PullRequest struct {
+	ID           int64               `json:"id"`
+	Title        string              `json:"title"`
+	Description  string              `json:"description"`
+	State        string              `json:"state"`
+	CreatedOn    time.Time           `json:"created_on"`
+	UpdatedOn    time.Time           `json:"updated_on"`
+	CommentCount int                 `json:"comment_count"`
+	TaskCount    int                 `json:"task_count"`
+	Source       PullRequestEndpoint `json:"source"`
+	Destination  PullRequestEndpoint `json:"destination"`
+	Author       User                `json:"author"`
+	Participants []Participant       `json:"participants"`
+}
+
+// ListRepositories walks the repositories of a workspace, handing each page
+// to fn.  Like with GetPages, fn can return ErrStopPaging to stop early.
+func (c *Client) ListRepositories(ctx context.Context, workspace string, params url.Values, fn func([]Repository) error) error {
+	return c.GetPages(ctx, RepositoriesPath(workspace), params, func(values json.RawMessage) error {
+		var page []Repository
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		return fn(page)
+	})
+}
+
+// ListPullRequests walks the pull requests of a repository, handing each
+// page to fn.  Without a state parameter Bitbucket only lists the open pull
+// requests.
+func (c *Client) ListPullRequests(ctx context.Context, workspace, slug string, params url.Values, fn func([]PullRequest) error) error {
+	return c.GetPages(ctx, PullRequestsPath(workspace, slug), params, func(values json.RawMessage) error {
+		var page []PullRequest
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		return fn(page)
+	})
+}
@@ -0,0 +1,69 @@
+package bitbucketapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListRepositories(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme": `{
+			"values": [{"slug": "api", "size": 1024, "mainbranch": {"name": "main"}, "project": {"key": "CORE"}}],
+			"next": "{{URL}}/repositories/acme?page=2"
+		}`,
+		"/repositories/acme?page=2": `{
+			"values": [{"slug": "api-fork", "parent": {"full_name": "acme/api"}}]
+		}`,
+	})
+	defer ts.Close()
+
+	c := NewClient(http.DefaultClient, ts.URL, make(chan struct{}, 1))
+	var repos []Repository
+	err := c.ListRepositories(context.Background(), "acme", nil, func(page []Repository) error {
+		repos = append(repos, page...)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, repos, 2)
+	require.Equal(t, "api", repos[0].Slug)
+	require.Equal(t, int64(1024), repos[0].Size)
+	require.Equal(t, "main", repos[0].MainBranch.Name)
+	require.Equal(t, "CORE", repos[0].Project.Key)
+	require.Nil(t, repos[0].Parent)
+	require.Equal(t, "acme/api", repos[1].Parent.FullName)
+}
+
+func TestListPullRequests(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api/pullrequests": `{
+			"values": [
+				{"id": 2, "state": "OPEN", "updated_on": "2020-02-01T12:00:00+00:00",
+					"source": {"branch": {"name": "feature"}, "commit": {"hash": "abc"}},
+					"author": {"display_name": "Jane Doe"},
+					"participants": [{"role": "REVIEWER", "approved": true, "user": {"nickname": "jdoe"}}]}
+			],
+			"next": "{{URL}}/repositories/acme/api/pullrequests?page=2"
+		}`,
+	})
+	defer ts.Close()
+
+	// Paging stops before the second page, which is not served.
+	c := NewClient(http.DefaultClient, ts.URL, make(chan struct{}, 1))
+	var prs []PullRequest
+	err := c.ListPullRequests(context.Background(), "acme", "api", nil, func(page []PullRequest) error {
+		prs = append(prs, page...)
+		return ErrStopPaging
+	})
+	require.NoError(t, err)
+	require.Len(t, prs, 1)
+	require.Equal(t, int64(2), prs[0].ID)
+	require.Equal(t, time.Date(2020, 2, 1, 12, 0, 0, 0, time.UTC), prs[0].UpdatedOn.UTC())
+	require.Equal(t, "feature", prs[0].Source.Branch.Name)
+	require.Equal(t, "Jane Doe", prs[0].Author.DisplayName)
+	require.Equal(t, "jdoe", prs[0].Participants[0].User.Nickname)
+	require.True(t, prs[0].Participants[0].Approved)
+}
@@ -0,0 +1,209 @@
+package bitbucket_pr_stats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/aggregators"
+)
+
+const measurement = "bitbucket_pr_stats"
+
+// PRStats computes percentiles over the per pull request metrics of the
+// bitbucket input.
+type PRStats struct {
+	Measurement string    `toml:"measurement"`
+	GroupBy     []string  `toml:"group_by"`
+	IDKey       string    `toml:"id_key"`
+	Fields      []string  `toml:"fields"`
+	Percentiles []float64 `toml:"percentiles"`
+
+	cache map[string]*aggregate
+}
+
+type aggregate struct {
+	tags map[string]string
+	// values holds the latest value of each field per pull request, so that
+	// pull requests gathered several times during a period are only counted
+	// once.
+	values map[string]map[string]float64
+	// anonymous counts metrics without an identifier.
+	anonymous int
+}
+
+// NewPRStats creates a new aggregator with the default settings.
+func NewPRStats() *PRStats {
+	s := &PRStats{
+		Measurement: "bitbucket_pull_request",
+		GroupBy:     []string{"workspace", "repository"},
+		IDKey:       "id",
+		Fields:      []string{"age", "time_to_merge", "lines_changed"},
+		Percentiles: []float64{50, 90, 95},
+	}
+	s.Reset()
+	return s
+}
+
+var sampleConfig = `
+  ## General Aggregator Arguments:
+  ## The period on which to flush & clear the aggregator.
+  period = "30s"
+  ## If true, the original metric will be dropped by the
+  ## aggregator and will not get sent to the output plugins.
+  drop_original = false
+
+  ## Measurement holding the per pull request metrics.
+  # measurement = "bitbucket_pull_request"
+
+  ## Tags to compute the statistics per, other tags are dropped.
+  # group_by = ["workspace", "repository"]
+
+  ## Field or tag identifying a pull request.  A pull request seen several
+  ## times during a period only contributes its latest values.
+  # id_key = "id"
+
+  ## Fields to compute the percentiles of.
+  # fields = ["age", "time_to_merge", "lines_changed"]
+
+  ## Percentiles to emit.
+  # percentiles = [50.0, 90.0, 95.0]
+`
+
+// SampleConfig returns sample configuration for this plugin.
+func (s *PRStats) SampleConfig() string {
+	return sampleConfig
+}
+
+// Description returns the plugin description.
+func (s *PRStats) Description() string {
+	return "Compute percentiles of the pull request metrics of the bitbucket input."
+}
+
+// Add records the values of a pull request metric.
+func (s *PRStats) Add(in telegraf.Metric) {
+	if in.Name() != s.Measurement {
+		return
+	}
+
+	tags := make(map[string]string, len(s.GroupBy))
+	values := make([]string, 0, len(s.GroupBy))
+	for _, key := range s.GroupBy {
+		value, _ := in.GetTag(key)
+		if value != "" {
+			tags[key] = value
+		}
+		values = append(values, value)
+	}
+	groupID := strings.Join(values, "\x00")
+
+	a, ok := s.cache[groupID]
+	if !ok {
+		a = &aggregate{
+			tags:   tags,
+			values: make(map[string]map[string]float64),
+		}
+		s.cache[groupID] = a
+	}
+
+	id, ok := in.GetTag(s.IDKey)
+	if !ok {
+		if v, found := in.GetField(s.IDKey); found {
+			id = fmt.Sprint(v)
+		} else {
+			a.anonymous++
+			id = "\x00" + strconv.Itoa(a.anonymous)
+		}
+	}
+
+	prValues := make(map[string]float64, len(s.Fields))
+	for _, field := range s.Fields {
+		v, ok := in.GetField(field)
+		if !ok {
+			continue
+		}
+		if fv, ok := convert(v); ok {
+			prValues[field] = fv
+		}
+	}
+	a.values[id] = prValues
+}
+
+// Push emits the percentiles of every group.
+func (s *PRStats) Push(acc telegraf.Accumulator) {
+	for _, a := range s.cache {
+		fields := make(map[string]interface{})
+		for _, field := range s.Fields {
+			var values []float64
+			for _, prValues := range a.values {
+				if v, ok := prValues[field]; ok {
+					values = append(values, v)
+				}
+			}
+			if len(values) == 0 {
+				continue
+			}
+			sort.Float64s(values)
+
+			fields[field+"_count"] = int64(len(values))
+			for _, p := range s.Percentiles {
+				fields[field+"_"+percentileSuffix(p)] = percentile(values, p)
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		acc.AddFields(measurement, fields, a.tags)
+	}
+}
+
+// Reset clears the cached pull requests.
+func (s *PRStats) Reset() {
+	s.cache = make(map[string]*aggregate)
+}
+
+// percentile returns the p-th percentile of the sorted values, interpolating
+// linearly between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if p <= 0 {
+		return sorted[0]
+	}
+	if p >= 100 {
+		return sorted[len(sorted)-1]
+	}
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := math.Floor(rank)
+	upper := math.Ceil(rank)
+	if lower == upper {
+		return sorted[int(rank)]
+	}
+	return sorted[int(lower)]*(upper-rank) + sorted[int(upper)]*(rank-lower)
+}
+
+// percentileSuffix formats a percentile as field suffix, e.g. 99.9 as p99_9.
+func percentileSuffix(p float64) string {
+	return "p" + strings.Replace(strconv.FormatFloat(p, 'f', -1, 64), ".", "_", -1)
+}
+
+func convert(in interface{}) (float64, bool) {
+	switch v := in.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func init() {
+	aggregators.Add("bitbucket_pr_stats", func() telegraf.Aggregator {
+		return NewPRStats()
+	})
+}
@@ -0,0 +1,101 @@
+package bitbucket_pr_stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newPullRequest(repository string, id int64, fields map[string]interface{}) telegraf.Metric {
+	fields["id"] = id
+	m, _ := metric.New("bitbucket_pull_request",
+		map[string]string{
+			"workspace":  "acme",
+			"repository": repository,
+			"state":      "OPEN",
+		},
+		fields,
+		time.Now(),
+	)
+	return m
+}
+
+func TestPercentiles(t *testing.T) {
+	s := NewPRStats()
+	s.Percentiles = []float64{0, 50, 90, 100}
+
+	for i, age := range []int64{10, 20, 30, 40, 50} {
+		s.Add(newPullRequest("api", int64(i), map[string]interface{}{"age": age}))
+	}
+
+	acc := testutil.Accumulator{}
+	s.Push(&acc)
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_pr_stats",
+		map[string]interface{}{
+			"age_count": int64(5),
+			"age_p0":    float64(10),
+			"age_p50":   float64(30),
+			"age_p90":   float64(46),
+			"age_p100":  float64(50),
+		},
+		map[string]string{"workspace": "acme", "repository": "api"})
+}
+
+func TestLatestValuePerPullRequest(t *testing.T) {
+	s := NewPRStats()
+	s.Percentiles = []float64{50}
+
+	s.Add(newPullRequest("api", 1, map[string]interface{}{"age": int64(10)}))
+	s.Add(newPullRequest("api", 1, map[string]interface{}{"age": int64(70)}))
+	s.Add(newPullRequest("api", 2, map[string]interface{}{"age": int64(30), "time_to_merge": int64(20)}))
+	s.Add(newPullRequest("web", 1, map[string]interface{}{"age": int64(5)}))
+
+	acc := testutil.Accumulator{}
+	s.Push(&acc)
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_pr_stats",
+		map[string]interface{}{
+			"age_count":           int64(2),
+			"age_p50":             float64(50),
+			"time_to_merge_count": int64(1),
+			"time_to_merge_p50":   float64(20),
+		},
+		map[string]string{"workspace": "acme", "repository": "api"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_pr_stats",
+		map[string]interface{}{
+			"age_count": int64(1),
+			"age_p50":   float64(5),
+		},
+		map[string]string{"workspace": "acme", "repository": "web"})
+}
+
+func TestIgnoresOtherMeasurements(t *testing.T) {
+	s := NewPRStats()
+
+	m, _ := metric.New("cpu", map[string]string{}, map[string]interface{}{"age": int64(1)}, time.Now())
+	s.Add(m)
+
+	acc := testutil.Accumulator{}
+	s.Push(&acc)
+	require.Equal(t, uint64(0), acc.NMetrics())
+}
+
+func TestReset(t *testing.T) {
+	s := NewPRStats()
+	s.Add(newPullRequest("api", 1, map[string]interface{}{"age": int64(10)}))
+	s.Reset()
+
+	acc := testutil.Accumulator{}
+	s.Push(&acc)
+	require.Equal(t, uint64(0), acc.NMetrics())
+}
+
+func TestPercentileSuffix(t *testing.T) {
+	require.Equal(t, "p50", percentileSuffix(50))
+	require.Equal(t, "p99_9", percentileSuffix(99.9))
+}
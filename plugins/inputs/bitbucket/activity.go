@@ -0,0 +1,151 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+// The values of pull_request_mode.
+const (
+	pullRequestModeRepository = "repository"
+	pullRequestModeWorkspace  = "workspace"
+)
+
+func validPullRequestMode(mode string) bool {
+	switch mode {
+	case "", pullRequestModeRepository, pullRequestModeWorkspace:
+		return true
+	default:
+		return false
+	}
+}
+
+// repositoryActivity decides, with pull_request_mode = "workspace", which
+// repositories have their pull requests fetched in a gather.  Only those
+// updated since the previous gather are, the pull requests of the others
+// are emitted again from the last fetch.
+type repositoryActivity struct {
+	fullRefresh time.Duration
+
+	mu       sync.Mutex
+	lastFull time.Time
+	since    time.Time
+	active   map[string]bool
+	cached   map[string]cachedRepository
+}
+
+// cachedRepository holds the last fetch of the pull requests of a
+// repository.
+type cachedRepository struct {
+	prs    []pullRequest
+	totals pullRequestTotals
+}
+
+func newRepositoryActivity(fullRefresh time.Duration) *repositoryActivity {
+	return &repositoryActivity{
+		fullRefresh: fullRefresh,
+		cached:      make(map[string]cachedRepository),
+	}
+}
+
+// begin starts the gather at now.  The first gather and those once every
+// full refresh fetch every repository, the others list the repositories
+// updated since the previous gather with a single query of the workspace.
+// When the listing fails every repository is fetched.
+func (a *repositoryActivity) begin(ctx context.Context, w *workspace, now time.Time) error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	since := a.since
+	full := a.lastFull.IsZero() || (a.fullRefresh > 0 && now.Sub(a.lastFull) >= a.fullRefresh)
+	a.active = nil
+	a.since = now
+	if full {
+		a.lastFull = now
+	}
+	a.mu.Unlock()
+	if full {
+		return nil
+	}
+
+	active, err := w.getUpdatedRepositories(ctx, since)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.active = active
+	a.mu.Unlock()
+	return nil
+}
+
+// cachedPullRequests returns the pull requests and totals of the last fetch
+// of a repository which was not updated since, to be emitted again.
+func (a *repositoryActivity) cachedPullRequests(slug string) ([]pullRequest, pullRequestTotals, bool) {
+	if a == nil {
+		return nil, pullRequestTotals{}, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.active == nil || a.active[slug] {
+		return nil, pullRequestTotals{}, false
+	}
+	c, ok := a.cached[slug]
+	return c.prs, c.totals, ok
+}
+
+// record keeps the fetched pull requests and totals of a repository.
+func (a *repositoryActivity) record(slug string, prs []pullRequest, totals pullRequestTotals) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.cached[slug] = cachedRepository{prs: append([]pullRequest(nil), prs...), totals: totals}
+	a.mu.Unlock()
+}
+
+// skipped returns the number of repositories whose pull requests were not
+// fetched in the current gather.
+func (a *repositoryActivity) skipped(repos []repository) int64 {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.active == nil {
+		return 0
+	}
+	var n int64
+	for _, repo := range repos {
+		if _, ok := a.cached[repo.Slug]; ok && !a.active[repo.Slug] {
+			n++
+		}
+	}
+	return n
+}
+
+// getUpdatedRepositories returns the slugs of the repositories of the
+// workspace updated since the given time.
+func (w *workspace) getUpdatedRepositories(ctx context.Context, since time.Time) (map[string]bool, error) {
+	params := url.Values{
+		"pagelen": {"100"},
+		"fields":  {"next,values.slug"},
+		"q":       {"updated_on >= " + since.UTC().Format(time.RFC3339)},
+	}
+	active := make(map[string]bool)
+	err := w.client.ListRepositories(ctx, w.Workspace, params, func(page []bitbucketapi.Repository) error {
+		for _, repo := range page {
+			active[repo.Slug] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing updated repositories of %s failed: %v", w.Workspace, err)
+	}
+	return active, nil
+}
@@ -0,0 +1,88 @@
+package bitbucket
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullRequestModeWorkspace(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	prs := func(id int) string {
+		return strings.Replace(fmt.Sprintf(`{"values": [{"id": %d, "state": "OPEN", "updated_on": "RECENT"}]}`, id), "RECENT", recent, -1)
+	}
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme":                  `{"values": [{"slug": "api"}, {"slug": "web"}]}`,
+		"/repositories/acme/api/pullrequests": prs(1),
+		"/repositories/acme/web/pullrequests": prs(2),
+	})
+	defer ts.Close()
+
+	// Only api was updated since the previous gather.
+	var requests []*url.URL
+	handler := ts.Config.Handler
+	ts.Config.Handler = recordRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repositories/acme" && r.URL.Query().Get("q") != "" {
+			require.True(t, strings.HasPrefix(r.URL.Query().Get("q"), "updated_on >= "))
+			fmt.Fprint(w, `{"values": [{"slug": "api"}]}`)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}), &requests)
+
+	b := newTestBitbucket(t, ts.URL)
+	b.GatherPullRequests = true
+	b.PullRequestMode = pullRequestModeWorkspace
+	require.NoError(t, b.Init())
+
+	gather := func() ([]int64, []string) {
+		requests = nil
+		var acc testutil.Accumulator
+		require.NoError(t, acc.GatherError(b.Gather))
+		var ids []int64
+		for _, m := range acc.Metrics {
+			if m.Measurement == "bitbucket_pull_request" {
+				ids = append(ids, m.Fields["id"].(int64))
+			}
+		}
+		var paths []string
+		for _, u := range requests {
+			if listsPullRequests(u) {
+				paths = append(paths, u.Path)
+			}
+		}
+		return ids, paths
+	}
+
+	ids, paths := gather()
+	require.ElementsMatch(t, []int64{1, 2}, ids)
+	require.ElementsMatch(t, []string{"/repositories/acme/api/pullrequests", "/repositories/acme/web/pullrequests"}, paths)
+	w := b.workspaces[0]
+	// The listing and the open count of each repository.
+	require.Equal(t, int64(4), w.stats.pullRequestRequests.Get())
+	require.Equal(t, int64(0), w.stats.skippedRepositories.Get())
+
+	ids, paths = gather()
+	require.ElementsMatch(t, []int64{1, 2}, ids)
+	require.Equal(t, []string{"/repositories/acme/api/pullrequests"}, paths)
+	// The updated repositories, the listing of api and its open count.
+	require.Equal(t, int64(3), w.stats.pullRequestRequests.Get())
+	require.Equal(t, int64(1), w.stats.skippedRepositories.Get())
+}
+
+func TestInitPullRequestMode(t *testing.T) {
+	b := newBitbucket()
+	b.Workspace = "acme"
+	b.PullRequestMode = "team"
+	require.EqualError(t, b.Init(), `invalid pull_request_mode "team"`)
+
+	b.PullRequestMode = ""
+	b.Workspaces = []*WorkspaceConfig{{Workspace: "other", PullRequestMode: "team"}}
+	require.EqualError(t, b.Init(), `invalid pull_request_mode "team" for other`)
+}
@@ -0,0 +1,155 @@
+package bitbucket
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+// The values of grant_type.
+const (
+	grantClientCredentials = "client_credentials"
+	grantPassword          = "password"
+	grantRefreshToken      = "refresh_token"
+)
+
+// The values of auth_method.
+const (
+	authNone        = "none"
+	authOAuth       = "oauth"
+	authAppPassword = "app_password"
+	authAPIToken    = "api_token"
+	authBasic       = "basic"
+	authToken       = "token"
+	authJWT         = "jwt"
+)
+
+// authMethod returns the configured auth_method, or the one implied by the
+// credentials which are set.
+func (c WorkspaceConfig) authMethod() string {
+	switch {
+	case c.AuthMethod == authBasic:
+		return authAppPassword
+	case c.AuthMethod != "":
+		return c.AuthMethod
+	case c.ClientID != "" || c.ClientSecret != "":
+		return authOAuth
+	case c.GrantType != "":
+		return authOAuth
+	case c.Username != "" || c.AppPassword != "":
+		return authAppPassword
+	case c.Email != "" || c.APIToken != "":
+		return authAPIToken
+	case c.token() != "":
+		return authToken
+	case c.JWTIssuer != "" || c.JWTSecret != "":
+		return authJWT
+	default:
+		return authNone
+	}
+}
+
+// token returns the access token of token, or of its alias access_token.
+func (c WorkspaceConfig) token() string {
+	if c.Token != "" {
+		return c.Token
+	}
+	return c.AccessToken
+}
+
+// hasCredentials returns whether any authentication is configured, so that
+// workspaces blocks without credentials inherit those of the plugin level.
+func (c WorkspaceConfig) hasCredentials() bool {
+	return c.authMethod() != authNone || c.AuthMethod == authNone
+}
+
+// authProvider returns the provider of the configured credentials.
+func (c WorkspaceConfig) authProvider() (bitbucketapi.AuthProvider, error) {
+	switch c.authMethod() {
+	case authNone:
+		return bitbucketapi.NoAuth{}, nil
+	case authOAuth:
+		if c.ClientID == "" || c.ClientSecret == "" {
+			return nil, errors.New("client_id and client_secret must be set together")
+		}
+		switch c.GrantType {
+		case "", grantClientCredentials:
+			return bitbucketapi.ClientCredentials{
+				ClientID:     c.ClientID,
+				ClientSecret: c.ClientSecret,
+			}, nil
+		case grantPassword:
+			if c.Username == "" || c.Password == "" {
+				return nil, errors.New("username and password must be set for the password grant")
+			}
+			return bitbucketapi.PasswordCredentials{
+				ClientID:     c.ClientID,
+				ClientSecret: c.ClientSecret,
+				Username:     c.Username,
+				Password:     c.Password,
+			}, nil
+		case grantRefreshToken:
+			if c.RefreshToken == "" {
+				return nil, errors.New("refresh_token must be set for the refresh_token grant")
+			}
+			return bitbucketapi.RefreshTokenCredentials{
+				ClientID:     c.ClientID,
+				ClientSecret: c.ClientSecret,
+				RefreshToken: c.RefreshToken,
+			}, nil
+		default:
+			return nil, fmt.Errorf("invalid grant_type %q", c.GrantType)
+		}
+	case authAppPassword:
+		if c.Username == "" || c.AppPassword == "" {
+			return nil, errors.New("username and app_password must be set together")
+		}
+		return bitbucketapi.AppPassword{
+			Username: c.Username,
+			Password: c.AppPassword,
+		}, nil
+	case authAPIToken:
+		if c.Email == "" || c.APIToken == "" {
+			return nil, errors.New("email and api_token must be set together")
+		}
+		return bitbucketapi.APIToken{
+			Email: c.Email,
+			Token: c.APIToken,
+		}, nil
+	case authToken:
+		if c.token() == "" {
+			return nil, errors.New("token must be set")
+		}
+		return bitbucketapi.BearerToken{Token: c.token()}, nil
+	case authJWT:
+		if c.JWTIssuer == "" || c.JWTSecret == "" {
+			return nil, errors.New("jwt_issuer and jwt_secret must be set together")
+		}
+		return bitbucketapi.JWT{
+			Issuer: c.JWTIssuer,
+			Secret: c.JWTSecret,
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid auth_method %q", c.AuthMethod)
+	}
+}
+
+// cacheTokens returns provider keeping its OAuth tokens in the state, keyed
+// by consumer and, for the password grant, account.  Other providers are
+// returned unchanged.
+func cacheTokens(provider bitbucketapi.AuthProvider, state *gatherState) bitbucketapi.AuthProvider {
+	switch p := provider.(type) {
+	case bitbucketapi.ClientCredentials:
+		p.Cache = state.tokenCache(p.ClientID)
+		return p
+	case bitbucketapi.PasswordCredentials:
+		p.Cache = state.tokenCache(p.ClientID + "/" + p.Username)
+		return p
+	case bitbucketapi.RefreshTokenCredentials:
+		p.Cache = state.tokenCache(p.ClientID + "/" + grantRefreshToken)
+		return p
+	default:
+		return provider
+	}
+}
@@ -0,0 +1,216 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthProvider(t *testing.T) {
+	tests := []struct {
+		cfg      WorkspaceConfig
+		expected bitbucketapi.AuthProvider
+		err      string
+	}{
+		{WorkspaceConfig{}, bitbucketapi.NoAuth{}, ""},
+		{WorkspaceConfig{ClientID: "key", ClientSecret: "secret"},
+			bitbucketapi.ClientCredentials{ClientID: "key", ClientSecret: "secret"}, ""},
+		{WorkspaceConfig{ClientID: "key", ClientSecret: "secret", GrantType: "client_credentials"},
+			bitbucketapi.ClientCredentials{ClientID: "key", ClientSecret: "secret"}, ""},
+		{WorkspaceConfig{ClientID: "key", ClientSecret: "secret", GrantType: "password", Username: "jdoe", Password: "pass"},
+			bitbucketapi.PasswordCredentials{ClientID: "key", ClientSecret: "secret", Username: "jdoe", Password: "pass"}, ""},
+		{WorkspaceConfig{ClientID: "key", ClientSecret: "secret", GrantType: "password", Username: "jdoe"},
+			nil, "username and password must be set for the password grant"},
+		{WorkspaceConfig{ClientID: "key", ClientSecret: "secret", GrantType: "implicit"},
+			nil, `invalid grant_type "implicit"`},
+		{WorkspaceConfig{GrantType: "password"}, nil, "client_id and client_secret must be set together"},
+		{WorkspaceConfig{ClientID: "key", ClientSecret: "secret", GrantType: "refresh_token", RefreshToken: "refresh"},
+			bitbucketapi.RefreshTokenCredentials{ClientID: "key", ClientSecret: "secret", RefreshToken: "refresh"}, ""},
+		{WorkspaceConfig{ClientID: "key", ClientSecret: "secret", GrantType: "refresh_token"},
+			nil, "refresh_token must be set for the refresh_token grant"},
+		{WorkspaceConfig{Username: "jdoe", AppPassword: "secret"},
+			bitbucketapi.AppPassword{Username: "jdoe", Password: "secret"}, ""},
+		{WorkspaceConfig{AuthMethod: "basic", Username: "jdoe", AppPassword: "secret"},
+			bitbucketapi.AppPassword{Username: "jdoe", Password: "secret"}, ""},
+		{WorkspaceConfig{AuthMethod: "basic", Username: "jdoe"}, nil, "username and app_password must be set together"},
+		{WorkspaceConfig{Email: "jdoe@example.com", APIToken: "secret"},
+			bitbucketapi.APIToken{Email: "jdoe@example.com", Token: "secret"}, ""},
+		{WorkspaceConfig{Email: "jdoe@example.com"}, nil, "email and api_token must be set together"},
+		{WorkspaceConfig{Token: "token"}, bitbucketapi.BearerToken{Token: "token"}, ""},
+		{WorkspaceConfig{AccessToken: "token"}, bitbucketapi.BearerToken{Token: "token"}, ""},
+		{WorkspaceConfig{JWTIssuer: "key", JWTSecret: "secret"},
+			bitbucketapi.JWT{Issuer: "key", Secret: "secret"}, ""},
+		{WorkspaceConfig{AuthMethod: "none", Token: "token"}, bitbucketapi.NoAuth{}, ""},
+		{WorkspaceConfig{ClientID: "key"}, nil, "client_id and client_secret must be set together"},
+		{WorkspaceConfig{Username: "jdoe"}, nil, "username and app_password must be set together"},
+		{WorkspaceConfig{AuthMethod: "token"}, nil, "token must be set"},
+		{WorkspaceConfig{JWTSecret: "secret"}, nil, "jwt_issuer and jwt_secret must be set together"},
+		{WorkspaceConfig{AuthMethod: "kerberos"}, nil, `invalid auth_method "kerberos"`},
+	}
+	for _, tt := range tests {
+		provider, err := tt.cfg.authProvider()
+		if tt.err != "" {
+			require.EqualError(t, err, tt.err)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, tt.expected, provider)
+	}
+}
+
+func TestWorkspaceInheritsOtherCredentials(t *testing.T) {
+	parent := WorkspaceConfig{Token: "token"}
+
+	cfg := WorkspaceConfig{Workspace: "acme"}
+	cfg.inherit(parent)
+	require.Equal(t, "token", cfg.Token)
+
+	cfg = WorkspaceConfig{Workspace: "public", AuthMethod: "none"}
+	cfg.inherit(parent)
+	require.Equal(t, "", cfg.Token)
+
+	cfg = WorkspaceConfig{Workspace: "initech", Username: "jdoe", AppPassword: "secret"}
+	cfg.inherit(parent)
+	require.Equal(t, "", cfg.Token)
+}
+
+type headerAuth struct{}
+
+func (headerAuth) Client(_ context.Context, base *http.Client) *http.Client {
+	client := *base
+	client.Transport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		r.Header.Set("Authorization", "Custom")
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	return &client
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestCustomAuthProvider(t *testing.T) {
+	var authorization string
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+	})
+	defer ts.Close()
+	handler := ts.Config.Handler
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		handler.ServeHTTP(w, r)
+	})
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.newAuthProvider = func(WorkspaceConfig) (bitbucketapi.AuthProvider, error) {
+		return headerAuth{}, nil
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, b.Gather(&acc))
+	require.Empty(t, acc.Errors)
+	require.Equal(t, "Custom", authorization)
+}
+
+func TestInitRefreshTokenRequiresPersistTokens(t *testing.T) {
+	b := newBitbucket()
+	b.Workspace = "acme"
+	b.ClientID = "key"
+	b.ClientSecret = "secret"
+	b.GrantType = "refresh_token"
+	b.RefreshToken = "refresh"
+	require.EqualError(t, b.Init(), `grant_type "refresh_token" requires persist_tokens and state_file`)
+
+	b.PersistTokens = true
+	require.EqualError(t, b.Init(), "persist_tokens requires state_file")
+
+	dir, err := ioutil.TempDir("", "bitbucket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	b.StateFile = filepath.Join(dir, "state.json")
+	require.NoError(t, b.Init())
+
+	// Workspaces blocks inherit the grant along with the credentials.
+	b.Workspace = ""
+	b.PersistTokens = false
+	b.Workspaces = []*WorkspaceConfig{{Workspace: "initech"}}
+	require.EqualError(t, b.Init(), `grant_type "refresh_token" requires persist_tokens and state_file for initech`)
+}
+
+func TestSharedRefreshTokenRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitbucket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	// Every refresh revokes the refresh token used and issues a new one.
+	var mu sync.Mutex
+	issued := 0
+	current := "initial"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			mu.Lock()
+			defer mu.Unlock()
+			r.ParseForm()
+			if r.PostForm.Get("refresh_token") != current {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": "invalid_grant"}`))
+				return
+			}
+			issued++
+			current = fmt.Sprintf("rotated-%d", issued)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token": "issued", "token_type": "bearer", "expires_in": 1, "refresh_token": %q}`, current)
+		case "/repositories/acme", "/repositories/initech":
+			w.Write([]byte(`{"values": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.ClientID = "key"
+	b.ClientSecret = "secret"
+	b.GrantType = "refresh_token"
+	b.RefreshToken = "initial"
+	b.PersistTokens = true
+	b.StateFile = stateFile
+	b.Workspaces = []*WorkspaceConfig{{Workspace: "initech"}}
+	require.NoError(t, b.Init())
+	b.newAuthProvider = func(cfg WorkspaceConfig) (bitbucketapi.AuthProvider, error) {
+		provider, err := cfg.authProvider()
+		if err != nil {
+			return nil, err
+		}
+		p := provider.(bitbucketapi.RefreshTokenCredentials)
+		p.TokenURL = ts.URL + "/token"
+		return p, nil
+	}
+
+	// Both workspaces refresh with the token rotated by the other one.
+	for i := 0; i < 2; i++ {
+		var acc testutil.Accumulator
+		require.NoError(t, b.Gather(&acc))
+		require.Empty(t, acc.Errors)
+	}
+	require.True(t, issued >= 4)
+
+	state, err := loadState(stateFile)
+	require.NoError(t, err)
+	require.Equal(t, current, state.tokenCache("key/refresh_token").Token().RefreshToken)
+}
@@ -0,0 +1,201 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// snapshotAccumulator keeps the metrics and errors of a collection, so that
+// they can be emitted by later gathers.
+type snapshotAccumulator struct {
+	mu      sync.Mutex
+	metrics []telegraf.Metric
+	errors  []error
+}
+
+func (s *snapshotAccumulator) AddFields(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	s.add(measurement, fields, tags, telegraf.Untyped, t)
+}
+
+func (s *snapshotAccumulator) AddGauge(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	s.add(measurement, fields, tags, telegraf.Gauge, t)
+}
+
+func (s *snapshotAccumulator) AddCounter(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	s.add(measurement, fields, tags, telegraf.Counter, t)
+}
+
+func (s *snapshotAccumulator) AddSummary(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	s.add(measurement, fields, tags, telegraf.Summary, t)
+}
+
+func (s *snapshotAccumulator) AddHistogram(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	s.add(measurement, fields, tags, telegraf.Histogram, t)
+}
+
+func (s *snapshotAccumulator) AddMetric(m telegraf.Metric) {
+	s.mu.Lock()
+	s.metrics = append(s.metrics, m.Copy())
+	s.mu.Unlock()
+}
+
+func (s *snapshotAccumulator) SetPrecision(time.Duration) {}
+
+func (s *snapshotAccumulator) AddError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.errors = append(s.errors, err)
+	s.mu.Unlock()
+}
+
+// WithTracking is not supported, the plugin never tracks metrics.
+func (s *snapshotAccumulator) WithTracking(int) telegraf.TrackingAccumulator {
+	panic("tracking is not supported")
+}
+
+func (s *snapshotAccumulator) add(measurement string, fields map[string]interface{}, tags map[string]string, tp telegraf.ValueType, t []time.Time) {
+	tm := time.Now()
+	if len(t) > 0 {
+		tm = t[0]
+	}
+	m, err := metric.New(measurement, tags, fields, tm, tp)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.metrics = append(s.metrics, m)
+	s.mu.Unlock()
+}
+
+// refresher collects the metrics in the background every refresh_interval,
+// keeping the latest snapshot for the gathers.
+type refresher struct {
+	interval time.Duration
+	collect  func(context.Context, telegraf.Accumulator) error
+
+	// snapshotFile, if set, keeps the metrics of the latest collection,
+	// and cached those kept before a restart, emitted until the first
+	// collection is complete.
+	snapshotFile string
+	cached       []telegraf.Metric
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	snapshot *snapshotAccumulator
+	err      error
+}
+
+func (r *refresher) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			r.refresh(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (r *refresher) stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// refresh replaces the snapshot by a new collection, unless it was stopped
+// meanwhile.
+func (r *refresher) refresh(ctx context.Context) {
+	snapshot := &snapshotAccumulator{}
+	err := r.collect(ctx, snapshot)
+	if ctx.Err() != nil {
+		return
+	}
+	if r.snapshotFile != "" {
+		if err := saveSnapshot(r.snapshotFile, snapshot.metrics); err != nil {
+			snapshot.AddError(fmt.Errorf("saving snapshot failed: %v", err))
+		}
+	}
+
+	r.mu.Lock()
+	r.snapshot = snapshot
+	r.err = err
+	r.mu.Unlock()
+}
+
+// flush emits the metrics of the latest snapshot.  Its errors are only
+// reported by the first gather after the collection.  Before the first
+// collection is complete only the cached metrics are emitted, if any.
+func (r *refresher) flush(acc telegraf.Accumulator) error {
+	r.mu.Lock()
+	snapshot, err := r.snapshot, r.err
+	var errs []error
+	if snapshot != nil {
+		snapshot.mu.Lock()
+		errs = snapshot.errors
+		snapshot.errors = nil
+		snapshot.mu.Unlock()
+	}
+	r.err = nil
+	r.mu.Unlock()
+
+	if snapshot == nil {
+		addCached(acc, r.cached)
+		return nil
+	}
+	for _, m := range snapshot.metrics {
+		acc.AddMetric(m.Copy())
+	}
+	for _, e := range errs {
+		acc.AddError(e)
+	}
+	return err
+}
+
+// Start sets up the workspaces and checks their credentials, then begins
+// collecting in the background when refresh_interval is set.
+func (b *Bitbucket) Start(telegraf.Accumulator) error {
+	ctx := context.Background()
+	if err := b.createWorkspaces(ctx); err != nil {
+		return err
+	}
+	if err := b.probeScopes(ctx); err != nil {
+		return err
+	}
+
+	if b.RefreshInterval.Duration <= 0 {
+		return nil
+	}
+	b.refresher = &refresher{
+		interval:     b.RefreshInterval.Duration,
+		collect:      b.collect,
+		snapshotFile: b.SnapshotFile,
+		cached:       b.cached,
+	}
+	b.refresher.start()
+	return nil
+}
+
+// Stop ends the background collection, canceling a collection in progress.
+func (b *Bitbucket) Stop() {
+	if b.refresher != nil {
+		b.refresher.stop()
+	}
+}
@@ -0,0 +1,71 @@
+package bitbucket
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshInterval(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+	})
+	defer ts.Close()
+
+	var requests int32
+	handler := ts.Config.Handler
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		handler.ServeHTTP(w, r)
+	})
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.RefreshInterval = internal.Duration{Duration: time.Hour}
+
+	var acc testutil.Accumulator
+	require.NoError(t, b.Start(&acc))
+	defer b.Stop()
+
+	require.Eventually(t, func() bool {
+		b.refresher.mu.Lock()
+		defer b.refresher.mu.Unlock()
+		return b.refresher.snapshot != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	collected := atomic.LoadInt32(&requests)
+
+	for i := 0; i < 2; i++ {
+		acc.ClearMetrics()
+		acc.Errors = nil
+		require.NoError(t, b.Gather(&acc))
+		require.True(t, acc.HasMeasurement("bitbucket_repository"))
+		require.True(t, acc.HasMeasurement("bitbucket_up"))
+		if i == 0 {
+			require.Len(t, acc.Errors, 1)
+		} else {
+			require.Empty(t, acc.Errors)
+		}
+	}
+	require.Equal(t, collected, atomic.LoadInt32(&requests))
+}
+
+func TestRefresherFlushBeforeCollection(t *testing.T) {
+	r := &refresher{}
+	var acc testutil.Accumulator
+	require.NoError(t, r.flush(&acc))
+	require.Empty(t, acc.GetTelegrafMetrics())
+}
+
+func TestRefresherFlushError(t *testing.T) {
+	r := &refresher{snapshot: &snapshotAccumulator{}, err: errors.New("failed")}
+	var acc testutil.Accumulator
+	require.EqualError(t, r.flush(&acc), "failed")
+	require.NoError(t, r.flush(&acc))
+}
@@ -0,0 +1,1505 @@
+package bitbucket
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+	"github.com/influxdata/telegraf/internal/choice"
+	tlsint "github.com/influxdata/telegraf/internal/tls"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"golang.org/x/net/http2"
+)
+
+// Bitbucket gathers repository information from Bitbucket Cloud workspaces.
+type Bitbucket struct {
+	URL string `toml:"url"`
+	WorkspaceConfig
+	Workspaces []*WorkspaceConfig `toml:"workspaces"`
+
+	RepoOverrides []*RepoOverride `toml:"repo_override"`
+
+	UserField       string            `toml:"user_field"`
+	DurationUnit    string            `toml:"duration_unit"`
+	UserTeamMap     map[string]string `toml:"user_team_map"`
+	UserTeamMapFile string            `toml:"user_team_map_file"`
+	PathTagMap      map[string]string `toml:"path_tag_map"`
+	OwnershipFile   string            `toml:"ownership_file"`
+
+	BusinessDays     []string `toml:"business_days"`
+	BusinessHours    string   `toml:"business_hours"`
+	BusinessTimezone string   `toml:"business_timezone"`
+
+	HistogramBuckets       []float64 `toml:"histogram_buckets"`
+	ReviewLatencyQuantiles []float64 `toml:"review_latency_quantiles"`
+
+	ClassifyChangeType bool              `toml:"classify_change_type"`
+	ChangeTypePatterns map[string]string `toml:"change_type_patterns"`
+
+	LabelPatterns []string `toml:"label_patterns"`
+
+	BypassAccounts []string `toml:"bypass_accounts"`
+
+	EmitClosedOnce bool   `toml:"emit_closed_once"`
+	PersistTokens  bool   `toml:"persist_tokens"`
+	StateFile      string `toml:"state_file"`
+
+	TrackSizeGrowth bool `toml:"track_size_growth"`
+
+	IncludeRawJSON bool `toml:"include_raw_json"`
+	RawJSONMaxSize int  `toml:"raw_json_max_size"`
+
+	MaxConnections           int               `toml:"max_connections"`
+	RequestsPerSecond        float64           `toml:"requests_per_second"`
+	Burst                    int               `toml:"burst"`
+	AdaptiveConcurrency      bool              `toml:"adaptive_concurrency"`
+	AdaptiveLatencyThreshold internal.Duration `toml:"adaptive_latency_threshold"`
+	PrefetchPages            bool              `toml:"prefetch_pages"`
+	FastDecode               bool              `toml:"fast_decode"`
+	HTTPTimeout              internal.Duration `toml:"http_timeout"`
+	MaxIdleConns             int               `toml:"max_idle_conns"`
+	IdleConnTimeout          internal.Duration `toml:"idle_conn_timeout"`
+	ForceHTTP1               bool              `toml:"force_http1"`
+	DNSServer                string            `toml:"dns_server"`
+	DNSCacheTTL              internal.Duration `toml:"dns_cache_ttl"`
+	PinnedIPs                []string          `toml:"pinned_ips"`
+	PreferIPv4               bool              `toml:"prefer_ipv4"`
+	PreferIPv6               bool              `toml:"prefer_ipv6"`
+	TraceRequests            bool              `toml:"trace_requests"`
+	ServeStale               bool              `toml:"serve_stale"`
+	ErrorMode                string            `toml:"error_mode"`
+	RefreshInterval          internal.Duration `toml:"refresh_interval"`
+	SnapshotFile             string            `toml:"snapshot_file"`
+
+	GatherIntervals map[string]internal.Duration `toml:"gather_intervals"`
+
+	tlsint.ClientConfig
+
+	Log telegraf.Logger
+
+	teams       map[string]string
+	ownership   []ownershipRule
+	changeTypes []changeTypePattern
+	labels      []*regexp.Regexp
+	calendar    *businessCalendar
+	overrides   []repoOverride
+	state       *gatherState
+	workspaces  []*workspace
+	refresher   *refresher
+	cached      []telegraf.Metric
+
+	// newAuthProvider returns the authentication of a workspace, from its
+	// configuration unless replaced.
+	newAuthProvider func(WorkspaceConfig) (bitbucketapi.AuthProvider, error)
+}
+
+// WorkspaceConfig holds the settings of a single workspace, given either at
+// the plugin level or in a workspaces block.
+type WorkspaceConfig struct {
+	Workspace    string   `toml:"workspace"`
+	Repositories []string `toml:"repositories"`
+	ExcludeForks bool     `toml:"exclude_forks"`
+
+	RepoUpdatedWithin internal.Duration `toml:"repo_updated_within"`
+
+	AuthMethod   string `toml:"auth_method"`
+	ClientID     string `toml:"client_id"`
+	ClientSecret string `toml:"client_secret"`
+	GrantType    string `toml:"grant_type"`
+	RefreshToken string `toml:"refresh_token"`
+	Username     string `toml:"username"`
+	Password     string `toml:"password"`
+	AppPassword  string `toml:"app_password"`
+	Email        string `toml:"email"`
+	APIToken     string `toml:"api_token"`
+	Token        string `toml:"token"`
+	AccessToken  string `toml:"access_token"`
+	JWTIssuer    string `toml:"jwt_issuer"`
+	JWTSecret    string `toml:"jwt_secret"`
+
+	// Tags are only decoded from workspaces blocks, the tags table of the
+	// plugin level is applied by the agent.
+	Tags map[string]string `toml:"tags"`
+
+	GatherPullRequests     bool              `toml:"gather_pull_requests"`
+	PullRequestStates      []string          `toml:"pull_request_states"`
+	PullRequestLookback    internal.Duration `toml:"pull_request_lookback"`
+	Sort                   string            `toml:"sort"`
+	MaxPRsPerRepo          int               `toml:"max_prs_per_repo"`
+	MaxPages               int               `toml:"max_pages"`
+	MaxPullRequestRequests int               `toml:"max_pull_request_requests"`
+	Query                  string            `toml:"query"`
+	ParticipantRoles       []string          `toml:"participant_roles"`
+	PullRequestMode        string            `toml:"pull_request_mode"`
+	PullRequestRefresh     internal.Duration `toml:"pull_request_refresh"`
+
+	RequireReviewers      bool   `toml:"require_reviewers"`
+	UnreviewedMeasurement string `toml:"unreviewed_measurement"`
+	AwaitingReviewBy      string `toml:"awaiting_review_by"`
+
+	OverdueReviews internal.Duration `toml:"overdue_reviews"`
+
+	QueueBranches []string `toml:"queue_branches"`
+
+	GatherDiffstat bool     `toml:"gather_diffstat"`
+	PathInclude    []string `toml:"path_include"`
+
+	GatherCIState       bool `toml:"gather_ci_state"`
+	GatherMergeChecks   bool `toml:"gather_merge_checks"`
+	GatherFirstResponse bool `toml:"gather_first_response"`
+
+	GatherMainBranch bool `toml:"gather_main_branch"`
+	MainBranchDepth  int  `toml:"main_branch_depth"`
+
+	GatherPipelinesConfig bool `toml:"gather_pipelines_config"`
+
+	GatherLastActivity bool `toml:"gather_last_activity"`
+
+	GatherPermissions bool              `toml:"gather_permissions"`
+	GatherSSHKeys     bool              `toml:"gather_ssh_keys"`
+	SSHKeyMaxAge      internal.Duration `toml:"ssh_key_max_age"`
+	GatherTwoStep     bool              `toml:"gather_two_step_verification"`
+	GatherSecurity    bool              `toml:"gather_security_settings"`
+	GatherWebhooks    bool              `toml:"gather_webhooks"`
+	GatherConsumers   bool              `toml:"gather_oauth_consumers"`
+}
+
+// compileFilters compiles the globs of queue_branches and path_include.
+func (c *WorkspaceConfig) compileFilters() (queueBranches, pathInclude filter.Filter, err error) {
+	if queueBranches, err = filter.Compile(c.QueueBranches); err != nil {
+		return nil, nil, fmt.Errorf("compiling queue_branches failed: %v", err)
+	}
+	if pathInclude, err = filter.Compile(c.PathInclude); err != nil {
+		return nil, nil, fmt.Errorf("compiling path_include failed: %v", err)
+	}
+	return queueBranches, pathInclude, nil
+}
+
+// inherit fills the credentials and filters not set in a workspaces block
+// from the plugin level.
+func (c *WorkspaceConfig) inherit(parent WorkspaceConfig) {
+	if !c.hasCredentials() {
+		c.AuthMethod = parent.AuthMethod
+		c.ClientID = parent.ClientID
+		c.ClientSecret = parent.ClientSecret
+		c.GrantType = parent.GrantType
+		c.RefreshToken = parent.RefreshToken
+		c.Username = parent.Username
+		c.Password = parent.Password
+		c.AppPassword = parent.AppPassword
+		c.Email = parent.Email
+		c.APIToken = parent.APIToken
+		c.Token = parent.Token
+		c.AccessToken = parent.AccessToken
+		c.JWTIssuer = parent.JWTIssuer
+		c.JWTSecret = parent.JWTSecret
+	}
+	if c.RepoUpdatedWithin.Duration == 0 {
+		c.RepoUpdatedWithin = parent.RepoUpdatedWithin
+	}
+	if len(c.PullRequestStates) == 0 {
+		c.PullRequestStates = parent.PullRequestStates
+	}
+	if c.PullRequestLookback.Duration == 0 {
+		c.PullRequestLookback = parent.PullRequestLookback
+	}
+	if c.Sort == "" {
+		c.Sort = parent.Sort
+	}
+	if c.MaxPRsPerRepo == 0 {
+		c.MaxPRsPerRepo = parent.MaxPRsPerRepo
+	}
+	if c.MaxPages == 0 {
+		c.MaxPages = parent.MaxPages
+	}
+	if c.MaxPullRequestRequests == 0 {
+		c.MaxPullRequestRequests = parent.MaxPullRequestRequests
+	}
+	if c.Query == "" {
+		c.Query = parent.Query
+	}
+	if len(c.ParticipantRoles) == 0 {
+		c.ParticipantRoles = parent.ParticipantRoles
+	}
+	if c.PullRequestMode == "" {
+		c.PullRequestMode = parent.PullRequestMode
+	}
+	if c.PullRequestRefresh.Duration == 0 {
+		c.PullRequestRefresh = parent.PullRequestRefresh
+	}
+	if c.MainBranchDepth == 0 {
+		c.MainBranchDepth = parent.MainBranchDepth
+	}
+	if c.UnreviewedMeasurement == "" {
+		c.UnreviewedMeasurement = parent.UnreviewedMeasurement
+	}
+	if c.AwaitingReviewBy == "" {
+		c.AwaitingReviewBy = parent.AwaitingReviewBy
+	}
+	if c.OverdueReviews.Duration == 0 {
+		c.OverdueReviews = parent.OverdueReviews
+	}
+	if len(c.QueueBranches) == 0 {
+		c.QueueBranches = parent.QueueBranches
+	}
+	if len(c.PathInclude) == 0 {
+		c.PathInclude = parent.PathInclude
+	}
+	if c.SSHKeyMaxAge.Duration == 0 {
+		c.SSHKeyMaxAge = parent.SSHKeyMaxAge
+	}
+}
+
+// workspace gathers a single workspace.
+type workspace struct {
+	WorkspaceConfig
+
+	Log telegraf.Logger
+
+	// userField is the attribute identifying users in tags and fields.
+	userField string
+
+	// durationUnit is the unit duration fields are reported in.
+	durationUnit string
+
+	// calendar restricts the durations of pull requests to business hours,
+	// when set.
+	calendar *businessCalendar
+
+	// histogramBuckets are the upper bounds of the buckets of the duration
+	// histograms, which are only reported when set.
+	histogramBuckets []float64
+
+	// reviewLatencyQuantiles are the quantiles of the review latency
+	// summaries, which are only reported when set.
+	reviewLatencyQuantiles []float64
+
+	// teams maps the account IDs, nicknames or display names of users to
+	// their team.
+	teams map[string]string
+
+	// components maps path prefixes to the component owning them.
+	components map[string]string
+
+	// ownership holds the rules of the ownership file in file order.
+	ownership []ownershipRule
+
+	// classifyChangeType enables the change_type tag, from changeTypes or
+	// the conventional commit prefix of the title.
+	classifyChangeType bool
+	changeTypes        []changeTypePattern
+
+	// labelPatterns extract the labels tag from titles and descriptions.
+	labelPatterns []*regexp.Regexp
+
+	// bypassAccounts holds the users of bypass_accounts.
+	bypassAccounts map[string]bool
+
+	// state remembers the closed pull requests already emitted, with
+	// emit_closed_once.
+	state *gatherState
+
+	// sizes remembers the sizes of the repositories, with
+	// track_size_growth.
+	sizes *gatherState
+
+	// includeRawJSON adds the source document of pull requests as a field,
+	// left out when larger than rawJSONMaxSize bytes unless zero.
+	includeRawJSON bool
+	rawJSONMaxSize int
+
+	// fastDecode decodes pull requests without encoding/json.
+	fastDecode bool
+
+	client      *bitbucketapi.Client
+	stats       *requestStats
+	errors      *errorLog
+	lastMetrics []telegraf.Metric
+
+	// queueBranches matches the branches of queue_branches.
+	queueBranches filter.Filter
+
+	// pathInclude matches the paths of path_include.
+	pathInclude filter.Filter
+
+	// reviewLoad collects the reviewer assignments during a gather of the
+	// pull requests.
+	reviewLoad *reviewLoad
+
+	// truncation counts the pull requests left out by max_prs_per_repo,
+	// max_pages and max_pull_request_requests during a gather.
+	truncation *truncation
+
+	// timings sums the time spent in the phases of a gather.
+	timings *gatherTimings
+
+	// schedule runs the gathers with an interval of gather_intervals.
+	schedule *gatherSchedule
+
+	// activity picks the repositories whose pull requests are fetched,
+	// with pull_request_mode = "workspace".
+	activity *repositoryActivity
+
+	// firstResponses keeps the first responses to pull requests found.
+	firstResponses *firstResponses
+
+	// mergeTimes keeps the times of the merge commits found.
+	mergeTimes *mergeTimes
+
+	// overrides are the repo_override blocks, applied per repository.
+	overrides []repoOverride
+}
+
+// tags returns the tags added to every metric of the workspace, the static
+// tags along with the workspace itself so that repositories of the same name
+// in different workspaces stay distinguishable.
+func (w *workspace) tags() map[string]string {
+	tags := make(map[string]string, len(w.Tags)+1)
+	for k, v := range w.Tags {
+		tags[k] = v
+	}
+	tags["workspace"] = w.Workspace
+	return tags
+}
+
+// duration converts d to the configured duration unit, seconds are
+// reported as integers.
+func (w *workspace) duration(d time.Duration) interface{} {
+	switch w.durationUnit {
+	case "m":
+		return d.Minutes()
+	case "h":
+		return d.Hours()
+	default:
+		return int64(d.Seconds())
+	}
+}
+
+const sampleConfig = `
+  ## Bitbucket Cloud API endpoint.
+  # url = "https://api.bitbucket.org/2.0"
+
+  ## Workspace to monitor.  Further workspaces can be added in workspaces
+  ## blocks below.
+  workspace = "myworkspace"
+
+  ## Repository slugs to monitor.  When empty, every repository in the
+  ## workspace is gathered.
+  # repositories = []
+
+  ## Leave out forks, the repositories with a parent, when listing the
+  ## repositories of the workspace.  Forks given in repositories are kept.
+  # exclude_forks = false
+
+  ## Only list the repositories updated within this duration, so long dormant
+  ## repositories are skipped entirely.  Repositories given in repositories
+  ## are always gathered.
+  # repo_updated_within = "720h"
+
+  ## Authentication, one of "oauth", "app_password", "api_token", "token",
+  ## "jwt" or "none", with "basic" as an alias of "app_password".  By default it is
+  ## chosen by the credentials which are set.
+  ## Unauthenticated requests only see public repositories.
+  # auth_method = ""
+
+  ## OAuth consumer key and secret.  With the "client_credentials" grant the
+  ## consumer must be marked as private, the legacy "password" grant acts on
+  ## behalf of the account of username and password instead.  The
+  ## "refresh_token" grant starts from the refresh_token of an authorization
+  ## of the consumer and requires persist_tokens, as Bitbucket rotates the
+  ## refresh token and the configured one stops working.
+  # client_id = ""
+  # client_secret = ""
+  # grant_type = "client_credentials"
+  # password = ""
+  # refresh_token = ""
+
+  ## Username and app password of an account, the username is also used by
+  ## the "password" grant.
+  # username = ""
+  # app_password = ""
+
+  ## Email address and API token of an Atlassian account.
+  # email = ""
+  # api_token = ""
+
+  ## Repository, project or workspace access token, sent as a bearer token
+  ## without any token exchange.  access_token is an alias of token.
+  # token = ""
+
+  ## Client key and shared secret of an Atlassian Connect app installation,
+  ## signing every request.
+  # jwt_issuer = ""
+  # jwt_secret = ""
+
+  ## Gather the pull requests of each repository which were updated within
+  ## pull_request_lookback and are in one of the given states.
+  # gather_pull_requests = false
+  # pull_request_states = ["OPEN", "MERGED", "DECLINED"]
+  # pull_request_lookback = "168h"
+
+  ## How the repositories whose pull requests are requested are picked.
+  ## With "repository" those of every repository are requested in every
+  ## gather.  With "workspace" a single query of the workspace lists the
+  ## repositories updated since the last gather and only those are
+  ## requested, the pull requests of the others are emitted again as last
+  ## requested.  Every pull_request_refresh all repositories are requested,
+  ## catching up on changes which do not update the repository, such as
+  ## approvals.
+  # pull_request_mode = "repository"
+  # pull_request_refresh = "1h"
+
+  ## Order in which pull requests are requested, e.g. "-updated_on" or
+  ## "-created_on".  Paging only stops early at the lookback window when
+  ## sorting by "-updated_on".
+  # sort = "-updated_on"
+
+  ## Maximum number of pull requests gathered per repository, in the order
+  ## given by sort; 0 for no limit.
+  # max_prs_per_repo = 0
+
+  ## Maximum number of pages of 50 pull requests listed per repository; 0
+  ## for no limit.
+  # max_pages = 0
+
+  ## Request budget of the pull request gather of a workspace.  Once it made
+  ## this many requests, the listing of each repository stops after its
+  ## current page; 0 for no limit.
+  # max_pull_request_requests = 0
+
+  ## Raw Bitbucket query language (BBQL) filter passed as the q parameter of
+  ## the pull request requests, e.g. 'source.branch.name ~ "feature/"'.
+  # query = ""
+
+  ## Roles of the participants counted as reviewers in the reviewers,
+  ## approvals, approved and changes_requested_by fields, add "PARTICIPANT"
+  ## to include informal reviews.
+  # participant_roles = ["REVIEWER"]
+
+  ## Leave out pull requests without reviewers, which are often a problem of
+  ## their own, from the pull request metrics.  When unreviewed_measurement is
+  ## set they are reported in that measurement instead of being dropped.
+  # require_reviewers = false
+  # unreviewed_measurement = "bitbucket_unreviewed_pull_request"
+
+  ## Only gather the open pull requests awaiting the review of the user with
+  ## the given UUID, i.e. where the user is a reviewer who neither approved nor
+  ## requested changes yet.
+  # awaiting_review_by = "{c5a0d676-fd27-4bd4-ac69-a7540d7e495b}"
+
+  ## Report the reviewers of open pull requests who neither approved nor
+  ## requested changes within this time of the pull request being opened,
+  ## one metric per reviewer and pull request; "0s" to disable.  Costs one
+  ## more listing per repository, regardless of the lookback window.
+  # overdue_reviews = "0s"
+
+  ## Report the queue of open pull requests targeting these branches, such as
+  ## release branches, per repository.  Wildcards are supported.
+  # queue_branches = ["main", "release/*"]
+
+  ## Gather the files changed by each pull request, reporting the size of the
+  ## change.  Costs one request per pull request.  With path_include only
+  ## pull requests touching a matching path are reported.
+  # gather_diffstat = false
+  # path_include = ["services/payments/**"]
+
+  ## Report the state of the pipeline run for the source commit of each open
+  ## pull request.  Costs one request per open pull request.
+  # gather_ci_state = false
+
+  ## Report the merge checks of each repository, such as the minimum number
+  ## of approvals and successful builds, and whether each open pull request
+  ## satisfies those of its destination branch as the mergeable field.
+  ## Requires admin access to the repositories, costs one request per open
+  ## pull request whose branch requires successful builds.
+  # gather_merge_checks = false
+
+  ## Report the time from opening each pull request to the first comment or
+  ## approval by someone other than its author.  Costs a walk of the activity
+  ## of every pull request until it was responded to.
+  # gather_first_response = false
+
+  ## Report whether the builds of the main branch of each repository pass,
+  ## by its latest commit with completed builds, and the time since the last
+  ## commit with passing builds.  Examines up to main_branch_depth commits,
+  ## costing a request per commit until one passed.
+  # gather_main_branch = false
+  # main_branch_depth = 20
+
+  ## Report whether Bitbucket Pipelines is enabled for each repository.
+  ## Requires the pipeline scope, costs one request per repository.
+  # gather_pipelines_config = false
+
+  ## Take days_since_last_commit and days_since_last_pr from the newest
+  ## commit of the main branch and the newest pull request of each
+  ## repository, rather than from the last update of the repository and the
+  ## gathered pull requests.  Costs two requests per repository.
+  # gather_last_activity = false
+
+  ## Gather the explicit user and group permissions of each repository.
+  ## Requires admin access to the repositories.
+  # gather_permissions = false
+
+  ## Gather the SSH keys registered by the workspace members, where the
+  ## credentials are allowed to see them.  Keys older than ssh_key_max_age
+  ## are reported as stale; set to "0s" to disable.
+  # gather_ssh_keys = false
+  # ssh_key_max_age = "8760h"
+
+  ## Gather the two-step verification status of the workspace members.  Only
+  ## members whose security attributes are exposed to the credentials are
+  ## reported.
+  # gather_two_step_verification = false
+
+  ## Gather the security settings of the workspace, such as IP allowlisting
+  ## on Premium plans.
+  # gather_security_settings = false
+
+  ## Gather the webhooks of each repository along with the failures of their
+  ## recent deliveries, where the delivery history is available.
+  # gather_webhooks = false
+
+  ## Gather the OAuth consumers registered in the workspace.
+  # gather_oauth_consumers = false
+
+  ## Maximum number of concurrent API requests.
+  # max_connections = 5
+
+  ## Maximum rate of API requests across all workspaces, allowing bursts of
+  ## up to burst requests.  Bitbucket limits most endpoints to 1000 requests
+  ## per hour, about 0.27 per second.  0 for no limit.
+  # requests_per_second = 0.0
+  # burst = 1
+
+  ## Adapt the number of concurrent API requests, up to max_connections, to
+  ## the health of the API.  The limit is halved on 429 or 503 responses, on
+  ## requests failing without a response and on requests slower than
+  ## adaptive_latency_threshold, and raised again while requests succeed.
+  # adaptive_concurrency = false
+  # adaptive_latency_threshold = "2s"
+
+  ## Request the next page of a collection while processing the current one.
+  ## Speeds up collections of many pages at the cost of a wasted request when
+  ## paging stops early, as at the end of the pull request lookback.
+  # prefetch_pages = false
+
+  ## Decode pull requests with a single pass parser extracting only the
+  ## reported attributes, reducing CPU and allocations when gathering many
+  ## pull requests.
+  # fast_decode = false
+
+  ## Timeout for HTTP requests.
+  # http_timeout = "5s"
+
+  ## Maximum number of idle connections kept open to the API, defaults to
+  ## max_connections.
+  # max_idle_conns = 0
+
+  ## Time after which idle connections are closed; 0 keeps them open.
+  ## Requests failing as the server closed a connection, such as with a
+  ## connection reset or an unexpected EOF, are sent again up to twice,
+  ## waiting for requests_per_second and the concurrency limits each time.
+  # idle_conn_timeout = "90s"
+
+  ## Disable HTTP/2 and talk HTTP/1.1 to the API.
+  # force_http1 = false
+
+  ## DNS server, as "host:port", used to resolve the API host instead of the
+  ## system resolver, e.g. for split-horizon setups.
+  # dns_server = ""
+
+  ## Time resolved addresses are cached for; 0 resolves every connection.
+  # dns_cache_ttl = "0s"
+
+  ## Connect to these addresses of the API host instead of resolving it.
+  # pinned_ips = []
+
+  ## Dial the IPv4 or IPv6 addresses of the API host first, falling back to
+  ## the other family.
+  # prefer_ipv4 = false
+  # prefer_ipv6 = false
+
+  ## Record the DNS lookup, connect, TLS handshake and time to first byte of
+  ## the API requests in the internal_bitbucket measurement, to diagnose slow
+  ## gathers.
+  # trace_requests = false
+
+  ## Emit the metrics of the last successful gather again, with a stale
+  ## field, when the repositories cannot be listed, e.g. during API outages.
+  # serve_stale = false
+
+  ## How failures during a gather are handled.  With "lenient" the metrics
+  ## which could be gathered are emitted and the failures are only logged,
+  ## with "strict" the gather additionally fails with the collected errors.
+  # error_mode = "lenient"
+
+  ## Collect in the background every refresh_interval rather than in every
+  ## gather, which then only emits the latest collected metrics.  Allows
+  ## short agent intervals without multiplying the API requests.
+  # refresh_interval = "0s"
+
+  ## Keep the metrics of the latest background collection in snapshot_file.
+  ## After a restart they are emitted, with a cached field, until the first
+  ## collection is complete.  Requires refresh_interval.
+  # snapshot_file = ""
+
+  ## Optional TLS Config
+  # tls_ca = "/etc/telegraf/ca.pem"
+  # tls_cert = "/etc/telegraf/cert.pem"
+  # tls_key = "/etc/telegraf/key.pem"
+  ## Use TLS but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## Attribute identifying users in the author tag and approved field of pull
+  ## requests, one of "display_name", "nickname" or "account_id".  Display
+  ## names are not unique and change with renames.
+  # user_field = "display_name"
+
+  ## Unit of the durations, such as the age of pull requests, one of "s", "m"
+  ## or "h".  Durations in minutes or hours are reported as floats.
+  # duration_unit = "s"
+
+  ## Count the durations of pull requests, their age, time to merge, time to
+  ## first response, review latency and overdue reviews, in business hours
+  ## only, so nights and weekends do not count.  Enabled when any of the
+  ## options is set; the days default to Monday to Friday, the hours to the
+  ## whole day and the time zone to UTC.
+  # business_days = ["mon", "tue", "wed", "thu", "fri"]
+  # business_hours = "09:00-17:00"
+  # business_timezone = "Europe/Berlin"
+
+  ## Upper bounds of the buckets, in the duration_unit, of the histograms of
+  ## the age of open and the time to merge of merged pull requests.  The
+  ## histograms are reported per repository when buckets are set.
+  # histogram_buckets = [3600.0, 14400.0, 86400.0, 259200.0, 604800.0]
+
+  ## Quantiles of the summaries of the review latency, the time from opening
+  ## a pull request until the first reviewer approved or requested changes.
+  ## The summaries are reported per repository when quantiles are set.
+  # review_latency_quantiles = [0.5, 0.9, 0.99]
+
+  ## CODEOWNERS-like file of path patterns and owning teams, reported as the
+  ## owning_team tag of pull requests.  The last matching pattern decides the
+  ## owner of a file and the team owning the most changed lines wins.
+  ## Requires gather_diffstat.
+  # ownership_file = ""
+
+  ## Classify pull requests by title, reported as the change_type tag.  By
+  ## default the conventional commit prefix is used, so "feat(api): ..." is
+  ## of type feat.
+  # classify_change_type = false
+
+  ## Regular expressions of labels marked in the titles and descriptions of
+  ## pull requests, such as "[hotfix]", reported as the comma separated
+  ## labels tag.  The first group of an expression is the label, or the
+  ## whole match without groups.  Descriptions are only requested when set.
+  # label_patterns = ["\\[([A-Za-z0-9_-]+)\\]"]
+
+  ## Accounts whose approvals do not count as a second pair of eyes, such as
+  ## service accounts, for the self_approved field of merged pull requests.
+  ## Users are matched by account ID, UUID, nickname or display name.
+  # bypass_accounts = []
+
+  ## Emit merged and declined pull requests only once, in the first gather
+  ## seeing them closed, rather than in every gather within the lookback.
+  ## The emitted pull requests are remembered in state_file across restarts,
+  ## or in memory only when it is not set, until they leave the lookback.
+  ## Without one the 10000 most recently updated are remembered per
+  ## repository.
+  # emit_closed_once = false
+  # state_file = ""
+
+  ## Keep the OAuth access tokens in state_file, so that restarts reuse the
+  ## tokens which are still valid rather than requesting new ones.
+  # persist_tokens = false
+
+  ## Report the growth of the size of each repository since the previous
+  ## gather as size_growth_bytes, catching sudden additions of large files.
+  ## The sizes are remembered in state_file across restarts, or in memory
+  ## only when it is not set.
+  # track_size_growth = false
+
+  ## Attach the JSON document of each pull request, as fetched, as the
+  ## raw_json field.  Documents larger than raw_json_max_size bytes are left
+  ## out, 0 for no limit.
+  # include_raw_json = false
+  # raw_json_max_size = 65536
+
+  ## Teams of the pull request authors, reported as the team tag.  Users are
+  ## matched by account ID, nickname or display name.  The map can also be
+  ## read from a JSON file holding an object of the same form, entries of
+  ## user_team_map take precedence.
+  # user_team_map_file = ""
+  # [inputs.bitbucket.user_team_map]
+  #   "Jane Doe" = "platform"
+  #   "557058:2" = "payments"
+
+  ## Components owning the paths of a monorepo, reported as the component
+  ## tag of pull requests.  Files are matched by the longest path prefix and
+  ## the component with the most changed lines wins.  Requires
+  ## gather_diffstat.
+  # [inputs.bitbucket.path_tag_map]
+  #   "services/payments/" = "payments"
+  #   "web/" = "frontend"
+
+  ## Regular expressions of the change types of classify_change_type, used
+  ## instead of the conventional commit prefix.  The first change type in
+  ## name order whose expression matches the title is used.
+  # [inputs.bitbucket.change_type_patterns]
+  #   "bugfix" = "^(fix|hotfix)(\\(.*\\))?:"
+  #   "feature" = "^feat(\\(.*\\))?:"
+
+  ## Intervals of individual gathers, which then only run when their interval
+  ## elapsed and emit the metrics of their last run in the gathers between.
+  ## The gathers are "repositories", "pull_requests", "permissions",
+  ## "webhooks", "main_branch", "ssh_keys", "two_step_verification",
+  ## "security" and "oauth_consumers".  Gathers without an interval run in
+  ## every gather.
+  # [inputs.bitbucket.gather_intervals]
+  #   repositories = "1h"
+  #   permissions = "1h"
+
+  ## Additional workspaces, each with its own repositories, credentials,
+  ## gathers and filters.  The credentials and the non-boolean pull request
+  ## and SSH key options not set in a block are taken from the plugin level.
+  ## All workspaces share the max_connections limit.
+  # [[inputs.bitbucket.workspaces]]
+  #   workspace = "otherworkspace"
+  #   client_id = ""
+  #   client_secret = ""
+  #   repositories = []
+  #   gather_pull_requests = true
+  #   pull_request_lookback = "720h"
+  #   ## Static tags added to the metrics of the workspace.
+  #   [inputs.bitbucket.workspaces.tags]
+  #     business_unit = "payments"
+
+  ## Options overriding those of the workspaces for the repositories
+  ## matching one of the slugs or globs of repositories, such as a stricter
+  ## overdue_reviews for a critical service.  Overrides apply in order, the
+  ## later one winning.  Supported are pull_request_states,
+  ## pull_request_lookback, query, participant_roles, require_reviewers,
+  ## overdue_reviews, gather_diffstat, gather_ci_state, gather_merge_checks
+  ## and gather_first_response.
+  # [[inputs.bitbucket.repo_override]]
+  #   repositories = ["payments", "payments-*"]
+  #   overdue_reviews = "4h"
+  #   gather_ci_state = true
+`
+
+const (
+	measurementRepository         = "bitbucket_repository"
+	measurementPullRequest        = "bitbucket_pull_request"
+	measurementPermissions        = "bitbucket_repository_permissions"
+	measurementAdminGrant         = "bitbucket_repository_admin_grant"
+	measurementSSHKey             = "bitbucket_ssh_key"
+	measurementSSHKeys            = "bitbucket_ssh_keys"
+	measurementMember             = "bitbucket_member"
+	measurementTwoStep            = "bitbucket_two_step_verification"
+	measurementWorkspace          = "bitbucket_workspace"
+	measurementWebhook            = "bitbucket_webhook"
+	measurementOAuthConsumer      = "bitbucket_oauth_consumer"
+	measurementOAuthConsumers     = "bitbucket_oauth_consumers"
+	measurementUp                 = "bitbucket_up"
+	measurementPullRequestSummary = "bitbucket_pull_request_summary"
+	measurementBranchQueue        = "bitbucket_branch_queue"
+	measurementErrors             = "bitbucket_errors"
+	measurementPullRequestCount   = "bitbucket_repository_pull_requests"
+
+	measurementAgeHistogram         = "bitbucket_pull_request_age"
+	measurementTimeToMergeHistogram = "bitbucket_pull_request_time_to_merge"
+	measurementReviewLatency        = "bitbucket_review_latency"
+
+	measurementMainBranch    = "bitbucket_main_branch"
+	measurementMergeChecks   = "bitbucket_merge_checks"
+	measurementOverdueReview = "bitbucket_overdue_review"
+)
+
+// SampleConfig returns sample configuration for this plugin.
+func (b *Bitbucket) SampleConfig() string {
+	return sampleConfig
+}
+
+// Description returns the plugin description.
+func (b *Bitbucket) Description() string {
+	return "Gather repository information from Bitbucket Cloud workspaces."
+}
+
+// Init validates the configuration.
+func (b *Bitbucket) Init() error {
+	if b.Workspace == "" && len(b.Workspaces) == 0 {
+		return errors.New("workspace must be set")
+	}
+	if _, err := b.WorkspaceConfig.authProvider(); err != nil {
+		return err
+	}
+	if !validPullRequestMode(b.PullRequestMode) {
+		return fmt.Errorf("invalid pull_request_mode %q", b.PullRequestMode)
+	}
+	if b.MaxConnections <= 0 {
+		b.MaxConnections = 5
+	}
+	if b.MaxIdleConns <= 0 {
+		b.MaxIdleConns = b.MaxConnections
+	}
+	if b.PreferIPv4 && b.PreferIPv6 {
+		return errors.New("prefer_ipv4 and prefer_ipv6 are mutually exclusive")
+	}
+	for _, ip := range b.PinnedIPs {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid pinned IP %q", ip)
+		}
+	}
+	if _, _, err := b.WorkspaceConfig.compileFilters(); err != nil {
+		return err
+	}
+	for _, cfg := range b.Workspaces {
+		if cfg.Workspace == "" {
+			return errors.New("workspace must be set in workspaces blocks")
+		}
+		if _, _, err := cfg.compileFilters(); err != nil {
+			return fmt.Errorf("%v for %s", err, cfg.Workspace)
+		}
+		if cfg.hasCredentials() {
+			if _, err := cfg.authProvider(); err != nil {
+				return fmt.Errorf("%v for %s", err, cfg.Workspace)
+			}
+		}
+		if !validPullRequestMode(cfg.PullRequestMode) {
+			return fmt.Errorf("invalid pull_request_mode %q for %s", cfg.PullRequestMode, cfg.Workspace)
+		}
+	}
+
+	switch b.UserField {
+	case "":
+		b.UserField = "display_name"
+	case "display_name", "nickname", "account_id":
+	default:
+		return fmt.Errorf("invalid user_field %q", b.UserField)
+	}
+
+	switch b.DurationUnit {
+	case "":
+		b.DurationUnit = "s"
+	case "s", "m", "h":
+	default:
+		return fmt.Errorf("invalid duration_unit %q", b.DurationUnit)
+	}
+	if len(b.BusinessDays) > 0 || b.BusinessHours != "" || b.BusinessTimezone != "" {
+		calendar, err := newBusinessCalendar(b.BusinessDays, b.BusinessHours, b.BusinessTimezone)
+		if err != nil {
+			return err
+		}
+		b.calendar = calendar
+	}
+	overrides, err := compileRepoOverrides(b.RepoOverrides)
+	if err != nil {
+		return err
+	}
+	b.overrides = overrides
+	if !validBuckets(b.HistogramBuckets) {
+		return errors.New("histogram_buckets must be finite and strictly increasing")
+	}
+	for name := range b.GatherIntervals {
+		if !choice.Contains(name, scheduledGathers) {
+			return fmt.Errorf("invalid gather in gather_intervals %q", name)
+		}
+	}
+	if !validQuantiles(b.ReviewLatencyQuantiles) {
+		return errors.New("review_latency_quantiles must be between 0 and 1")
+	}
+
+	switch b.ErrorMode {
+	case "":
+		b.ErrorMode = errorModeLenient
+	case errorModeLenient, errorModeStrict:
+	default:
+		return fmt.Errorf("invalid error_mode %q", b.ErrorMode)
+	}
+
+	b.teams = make(map[string]string)
+	if b.UserTeamMapFile != "" {
+		teams, err := loadTeamMap(b.UserTeamMapFile)
+		if err != nil {
+			return err
+		}
+		for user, team := range teams {
+			b.teams[user] = team
+		}
+	}
+	for user, team := range b.UserTeamMap {
+		b.teams[user] = team
+	}
+
+	if b.OwnershipFile != "" {
+		ownership, err := loadOwnership(b.OwnershipFile)
+		if err != nil {
+			return err
+		}
+		b.ownership = ownership
+	}
+
+	changeTypes, err := compileChangeTypes(b.ChangeTypePatterns)
+	if err != nil {
+		return err
+	}
+	b.changeTypes = changeTypes
+
+	labels, err := compileLabelPatterns(b.LabelPatterns)
+	if err != nil {
+		return err
+	}
+	b.labels = labels
+
+	if b.PersistTokens && b.StateFile == "" {
+		return errors.New("persist_tokens requires state_file")
+	}
+
+	// Bitbucket rotates refresh tokens, the configured one only works until
+	// the first refresh.
+	if !b.PersistTokens {
+		if b.Workspace != "" && b.GrantType == grantRefreshToken {
+			return errors.New(`grant_type "refresh_token" requires persist_tokens and state_file`)
+		}
+		for _, cfg := range b.Workspaces {
+			if cfg.GrantType == grantRefreshToken || (!cfg.hasCredentials() && b.GrantType == grantRefreshToken) {
+				return fmt.Errorf(`grant_type "refresh_token" requires persist_tokens and state_file for %s`, cfg.Workspace)
+			}
+		}
+	}
+	if b.SnapshotFile != "" {
+		if b.RefreshInterval.Duration <= 0 {
+			return errors.New("snapshot_file requires refresh_interval")
+		}
+		if b.cached, err = loadSnapshot(b.SnapshotFile); err != nil {
+			return fmt.Errorf("loading snapshot failed: %v", err)
+		}
+	}
+	if b.EmitClosedOnce || b.PersistTokens || b.TrackSizeGrowth {
+		if b.state, err = loadState(b.StateFile); err != nil {
+			return fmt.Errorf("loading state failed: %v", err)
+		}
+		b.state.log = b.Log
+	}
+	return nil
+}
+
+// createWorkspaces sets up the workspace given at the plugin level, if any,
+// followed by those of the workspaces blocks.
+func (b *Bitbucket) createWorkspaces(ctx context.Context) error {
+	httpClient, err := b.createHTTPClient()
+	if err != nil {
+		return err
+	}
+
+	configs := make([]WorkspaceConfig, 0, len(b.Workspaces)+1)
+	if b.Workspace != "" {
+		configs = append(configs, b.WorkspaceConfig)
+	}
+	for _, cfg := range b.Workspaces {
+		cfg.inherit(b.WorkspaceConfig)
+		configs = append(configs, *cfg)
+	}
+
+	// The clients of all workspaces share the connection and rate limits.
+	semaphore := make(chan struct{}, b.MaxConnections)
+	var limiter *bitbucketapi.RateLimiter
+	if b.RequestsPerSecond > 0 {
+		limiter = bitbucketapi.NewRateLimiter(b.RequestsPerSecond, b.Burst)
+	}
+	var adaptive *bitbucketapi.AdaptiveLimiter
+	if b.AdaptiveConcurrency {
+		adaptive = bitbucketapi.NewAdaptiveLimiter(b.MaxConnections, b.AdaptiveLatencyThreshold.Duration)
+	}
+	// The workspaces are only kept once all of them are set up, a failure
+	// sets them up anew in the next gather.
+	workspaces := make([]*workspace, 0, len(configs))
+	for _, cfg := range configs {
+		authClient, err := b.authenticate(ctx, httpClient, cfg)
+		if err != nil {
+			return err
+		}
+		var closed *gatherState
+		if b.EmitClosedOnce {
+			closed = b.state
+		}
+		var sizes *gatherState
+		if b.TrackSizeGrowth {
+			sizes = b.state
+		}
+		w := &workspace{
+			WorkspaceConfig:        cfg,
+			Log:                    b.Log,
+			userField:              b.UserField,
+			durationUnit:           b.DurationUnit,
+			calendar:               b.calendar,
+			overrides:              b.overrides,
+			histogramBuckets:       b.HistogramBuckets,
+			reviewLatencyQuantiles: b.ReviewLatencyQuantiles,
+			teams:                  b.teams,
+			components:             b.PathTagMap,
+			ownership:              b.ownership,
+			classifyChangeType:     b.ClassifyChangeType,
+			changeTypes:            b.changeTypes,
+			labelPatterns:          b.labels,
+			bypassAccounts:         make(map[string]bool, len(b.BypassAccounts)),
+			state:                  closed,
+			sizes:                  sizes,
+			includeRawJSON:         b.IncludeRawJSON,
+			rawJSONMaxSize:         b.RawJSONMaxSize,
+			fastDecode:             b.FastDecode,
+			client:                 bitbucketapi.NewClient(authClient, b.URL, semaphore),
+		}
+		for _, account := range b.BypassAccounts {
+			w.bypassAccounts[account] = true
+		}
+		if w.queueBranches, w.pathInclude, err = cfg.compileFilters(); err != nil {
+			return fmt.Errorf("%v for %s", err, w.Workspace)
+		}
+		if len(b.GatherIntervals) > 0 {
+			intervals := make(map[string]time.Duration, len(b.GatherIntervals))
+			for name, interval := range b.GatherIntervals {
+				intervals[name] = interval.Duration
+			}
+			w.schedule = newGatherSchedule(intervals)
+		}
+		w.firstResponses = newFirstResponses()
+		w.mergeTimes = newMergeTimes()
+		if w.GatherPullRequests && w.PullRequestMode == pullRequestModeWorkspace {
+			w.activity = newRepositoryActivity(w.PullRequestRefresh.Duration)
+		}
+		w.errors = newErrorLog(b.URL)
+		w.stats = newRequestStats(map[string]string{"workspace": w.Workspace}, b.TraceRequests)
+		w.client.Limiter = limiter
+		w.client.Adaptive = adaptive
+		w.client.Prefetch = b.PrefetchPages
+		w.client.Observer = requestObserver{stats: w.stats, errors: w.errors}
+		workspaces = append(workspaces, w)
+	}
+	b.workspaces = workspaces
+	return nil
+}
+
+// createHTTPClient returns the unauthenticated client the requests of all
+// workspaces are made with.
+func (b *Bitbucket) createHTTPClient() (*http.Client, error) {
+	tlsCfg, err := b.ClientConfig.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// All requests go to the same host, so the idle connection limit applies
+	// per host as well.
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsCfg,
+		MaxIdleConns:        b.MaxIdleConns,
+		MaxIdleConnsPerHost: b.MaxIdleConns,
+		IdleConnTimeout:     b.IdleConnTimeout.Duration,
+	}
+	if b.DNSServer != "" || b.DNSCacheTTL.Duration > 0 || len(b.PinnedIPs) > 0 || b.PreferIPv4 || b.PreferIPv6 {
+		u, err := url.Parse(b.URL)
+		if err != nil {
+			return nil, err
+		}
+		d := newDialer(b.HTTPTimeout.Duration, b.DNSServer, b.DNSCacheTTL.Duration, u.Hostname(), b.PinnedIPs)
+		d.preferIPv4 = b.PreferIPv4
+		d.preferIPv6 = b.PreferIPv6
+		transport.DialContext = d.DialContext
+	}
+	if b.ForceHTTP1 {
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	} else if err := http2.ConfigureTransport(transport); err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{
+		Transport: transport,
+		Timeout:   b.HTTPTimeout.Duration,
+	}
+	return httpClient, nil
+}
+
+// authenticate returns a client making the requests of httpClient with the
+// credentials of the workspace, if any.
+func (b *Bitbucket) authenticate(ctx context.Context, httpClient *http.Client, cfg WorkspaceConfig) (*http.Client, error) {
+	newProvider := b.newAuthProvider
+	if newProvider == nil {
+		newProvider = WorkspaceConfig.authProvider
+	}
+	provider, err := newProvider(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%v for %s", err, cfg.Workspace)
+	}
+	if b.PersistTokens {
+		provider = cacheTokens(provider, b.state)
+	}
+	return provider.Client(ctx, httpClient), nil
+}
+
+// Gather Bitbucket metrics
+func (b *Bitbucket) Gather(acc telegraf.Accumulator) error {
+	if b.refresher != nil {
+		return b.refresher.flush(acc)
+	}
+	return b.collect(context.Background(), acc)
+}
+
+// collect gathers the metrics of all workspaces into acc.
+func (b *Bitbucket) collect(ctx context.Context, acc telegraf.Accumulator) error {
+	var collector *collectingAccumulator
+	if b.ErrorMode == errorModeStrict {
+		collector = newCollectingAccumulator(acc)
+		acc = collector
+	}
+
+	if b.workspaces == nil {
+		if err := b.createWorkspaces(ctx); err != nil {
+			acc.AddError(err)
+			if collector != nil {
+				return collector.err()
+			}
+			return nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, w := range b.workspaces {
+		wg.Add(1)
+		go func(w *workspace) {
+			defer wg.Done()
+			wacc := newTaggingAccumulator(acc, w.tags())
+			counter := newCountingAccumulator(wacc)
+			err := w.gather(ctx, counter, b.ServeStale)
+			w.addUp(wacc, counter, err)
+			if err != nil {
+				acc.AddError(err)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if b.state != nil {
+		if err := b.state.save(); err != nil {
+			acc.AddError(fmt.Errorf("saving state failed: %v", err))
+		}
+	}
+	if collector != nil {
+		return collector.err()
+	}
+	return nil
+}
+
+// gather reports the metrics of the workspace.  When serveStale is set and
+// the repositories cannot be listed, the metrics of the last successful
+// gather are emitted again.
+func (w *workspace) gather(ctx context.Context, acc telegraf.Accumulator, serveStale bool) error {
+	w.timings = newGatherTimings()
+	defer w.timings.record(w.stats)
+	defer w.addErrors(acc)
+
+	now := time.Now()
+	repos := w.schedule.repositories()
+	if w.schedule.due(gatherRepositories, now) {
+		var err error
+		repos, err = w.getRepositories(ctx)
+		w.timings.track(phaseRepositoryDiscovery, now)
+		if err != nil {
+			if serveStale && w.lastMetrics != nil {
+				addStale(acc, w.lastMetrics)
+			}
+			return err
+		}
+		w.schedule.setRepositories(repos)
+	}
+
+	var rec *recordingAccumulator
+	if serveStale {
+		rec = newRecordingAccumulator(acc)
+		acc = rec
+	}
+
+	// Gathers not due emit the metrics of their last run, those due record
+	// their metrics for the runs in between.
+	accs := make(map[string]telegraf.Accumulator)
+	for _, name := range scheduledGathers {
+		if !w.schedule.due(name, now) {
+			w.schedule.replay(name, acc)
+			continue
+		}
+		accs[name] = w.schedule.recorder(name, acc)
+	}
+	due := func(name string) bool {
+		_, ok := accs[name]
+		return ok
+	}
+
+	gatherPRs := w.GatherPullRequests && due(gatherPullRequests)
+	var prRequests int64
+	prCtx := countRequests(ctx, &prRequests)
+	if gatherPRs {
+		w.reviewLoad = newReviewLoad()
+		w.truncation = &truncation{}
+		if err := w.activity.begin(prCtx, w, now); err != nil {
+			accs[gatherPullRequests].AddError(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	workspaceGathers := []struct {
+		name    string
+		enabled bool
+		gather  func(context.Context, telegraf.Accumulator) error
+	}{
+		{gatherSSHKeys, w.GatherSSHKeys, w.gatherSSHKeys},
+		{gatherTwoStep, w.GatherTwoStep, w.gatherTwoStepVerification},
+		{gatherSecurity, w.GatherSecurity, w.gatherSecuritySettings},
+		{gatherConsumers, w.GatherConsumers, w.gatherOAuthConsumers},
+	}
+	for _, g := range workspaceGathers {
+		if !g.enabled || !due(g.name) {
+			continue
+		}
+		wg.Add(1)
+		go func(gather func(context.Context, telegraf.Accumulator) error, acc telegraf.Accumulator) {
+			defer wg.Done()
+			if err := gather(ctx, acc); err != nil {
+				acc.AddError(err)
+			}
+		}(g.gather, accs[g.name])
+	}
+
+	repositoryGathers := []struct {
+		name    string
+		enabled bool
+		gather  func(*workspace, context.Context, telegraf.Accumulator, repository) error
+	}{
+		{gatherRepositories, true, (*workspace).gatherRepository},
+		{gatherPullRequests, w.GatherPullRequests, (*workspace).gatherPullRequests},
+		{gatherPermissions, w.GatherPermissions, (*workspace).gatherPermissions},
+		{gatherWebhooks, w.GatherWebhooks, (*workspace).gatherWebhooks},
+		{gatherMainBranch, w.GatherMainBranch, (*workspace).gatherMainBranch},
+	}
+
+	for _, repo := range repos {
+		rw := w.forRepository(repo)
+		for _, g := range repositoryGathers {
+			if !g.enabled || !due(g.name) {
+				continue
+			}
+			gctx := ctx
+			if g.name == gatherPullRequests {
+				gctx = prCtx
+			}
+			wg.Add(1)
+			go func(ctx context.Context, gather func(*workspace, context.Context, telegraf.Accumulator, repository) error, acc telegraf.Accumulator, w *workspace, repo repository) {
+				defer wg.Done()
+				if err := gather(w, ctx, acc, repo); err != nil {
+					acc.AddError(err)
+				}
+			}(gctx, g.gather, accs[g.name], rw, repo)
+		}
+	}
+	wg.Wait()
+
+	if gatherPRs {
+		start := time.Now()
+		w.addPullRequestSummary(accs[gatherPullRequests], w.reviewLoad, w.truncation)
+		w.timings.track(phaseAccumulation, start)
+		if w.stats != nil {
+			w.stats.pullRequestRequests.Set(prRequests)
+			w.stats.skippedRepositories.Set(w.activity.skipped(repos))
+		}
+	}
+	for name, acc := range accs {
+		w.schedule.finish(name, acc, now)
+	}
+
+	if rec != nil {
+		w.lastMetrics = rec.metrics
+	}
+	return nil
+}
+
+type repository struct {
+	Slug      string `json:"slug"`
+	IsPrivate bool   `json:"is_private"`
+	Size      int64  `json:"size"`
+	Language  string `json:"language"`
+	HasIssues bool   `json:"has_issues"`
+	HasWiki   bool   `json:"has_wiki"`
+	Project   struct {
+		Key string `json:"key"`
+	} `json:"project"`
+	Links struct {
+		Clone []struct {
+			Name string `json:"name"`
+			Href string `json:"href"`
+		} `json:"clone"`
+	} `json:"links"`
+	MainBranch struct {
+		Name string `json:"name"`
+	} `json:"mainbranch"`
+	UpdatedOn time.Time `json:"updated_on"`
+
+	// Parent is set on forks only.
+	Parent *struct {
+		FullName string `json:"full_name"`
+	} `json:"parent"`
+}
+
+// days returns the number of whole days of d.
+func days(d time.Duration) int64 {
+	return int64(d / (24 * time.Hour))
+}
+
+// getRepositories returns the configured repositories, or every repository
+// of the workspace when none are configured.
+func (w *workspace) getRepositories(ctx context.Context) ([]repository, error) {
+	if len(w.Repositories) == 0 {
+		var repos []repository
+		path := bitbucketapi.RepositoriesPath(w.Workspace)
+		params := url.Values{"pagelen": {"100"}}
+		if w.RepoUpdatedWithin.Duration > 0 {
+			since := time.Now().Add(-w.RepoUpdatedWithin.Duration)
+			params.Set("q", "updated_on >= "+since.UTC().Format(time.RFC3339))
+		}
+		err := w.client.GetPages(ctx, path, params, func(values json.RawMessage) error {
+			var p []repository
+			if err := json.Unmarshal(values, &p); err != nil {
+				return err
+			}
+			for _, repo := range p {
+				if w.ExcludeForks && repo.Parent != nil {
+					continue
+				}
+				repos = append(repos, repo)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("listing repositories of %s failed: %v", w.Workspace, err)
+		}
+		return repos, nil
+	}
+
+	repos := make([]repository, 0, len(w.Repositories))
+	for _, slug := range w.Repositories {
+		var repo repository
+		if err := w.client.Get(ctx, w.repositoryPath(slug), nil, &repo); err != nil {
+			return nil, err
+		}
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
+
+func (w *workspace) repositoryPath(slug string) string {
+	return bitbucketapi.RepositoryPath(w.Workspace, slug)
+}
+
+func (w *workspace) repositoryTags(repo repository) map[string]string {
+	return map[string]string{
+		"workspace":  w.Workspace,
+		"repository": repo.Slug,
+	}
+}
+
+type pipelinesConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// gatherRepository reports the metadata of a repository.
+func (w *workspace) gatherRepository(ctx context.Context, acc telegraf.Accumulator, repo repository) error {
+	now := time.Now()
+	fields := map[string]interface{}{
+		"size":       repo.Size,
+		"is_private": repo.IsPrivate,
+		"has_issues": repo.HasIssues,
+		"has_wiki":   repo.HasWiki,
+	}
+	if branch := repo.MainBranch.Name; w.GatherLastActivity && branch != "" {
+		params := url.Values{"pagelen": {"1"}, "fields": {"values.date"}}
+		var commits struct {
+			Values []commit `json:"values"`
+		}
+		if err := w.client.Get(ctx, bitbucketapi.CommitsPath(w.Workspace, repo.Slug, branch), params, &commits); err != nil {
+			acc.AddError(fmt.Errorf("getting the last commit of %s of %s failed: %v", branch, repo.Slug, err))
+		} else if len(commits.Values) > 0 && !commits.Values[0].Date.IsZero() {
+			fields["days_since_last_commit"] = days(now.Sub(commits.Values[0].Date))
+		}
+	} else if !w.GatherLastActivity && !repo.UpdatedOn.IsZero() {
+		fields["days_since_last_commit"] = days(now.Sub(repo.UpdatedOn))
+	}
+	if w.sizes != nil {
+		if previous, ok := w.sizes.swapSize(w.Workspace+"/"+repo.Slug, repo.Size); ok {
+			fields["size_growth_bytes"] = repo.Size - previous
+		}
+	}
+	for _, link := range repo.Links.Clone {
+		switch link.Name {
+		case "https", "ssh":
+			fields["clone_"+link.Name] = link.Href
+		}
+	}
+
+	// Repositories which never had Pipelines configured answer with a 404,
+	// those whose configuration the credentials may not see with a 403.
+	if w.GatherPipelinesConfig {
+		var config pipelinesConfig
+		err := w.client.Get(bitbucketapi.ExpectStatus(ctx, http.StatusNotFound, http.StatusForbidden), w.repositoryPath(repo.Slug)+"/pipelines_config", nil, &config)
+		if bitbucketapi.IsStatus(err, http.StatusNotFound) {
+			fields["pipelines_enabled"] = false
+		} else if bitbucketapi.IsStatus(err, http.StatusForbidden) {
+			w.Log.Debugf("Pipelines configuration of %s is not visible: %v", repo.Slug, err)
+		} else if err != nil {
+			acc.AddError(fmt.Errorf("gathering pipelines configuration of %s failed: %v", repo.Slug, err))
+		} else {
+			fields["pipelines_enabled"] = config.Enabled
+		}
+	}
+
+	tags := w.repositoryTags(repo)
+	tags["language"] = repo.Language
+	acc.AddFields(measurementRepository, fields, tags, now)
+	return nil
+}
+
+func newBitbucket() *Bitbucket {
+	return &Bitbucket{
+		URL:          "https://api.bitbucket.org/2.0",
+		UserField:    "display_name",
+		DurationUnit: "s",
+		WorkspaceConfig: WorkspaceConfig{
+			PullRequestStates:   []string{"OPEN", "MERGED", "DECLINED"},
+			PullRequestLookback: internal.Duration{Duration: 7 * 24 * time.Hour},
+			Sort:                "-updated_on",
+			ParticipantRoles:    []string{"REVIEWER"},
+			PullRequestRefresh:  internal.Duration{Duration: time.Hour},
+			MainBranchDepth:     20,
+			SSHKeyMaxAge:        internal.Duration{Duration: 365 * 24 * time.Hour},
+		},
+		MaxConnections:           5,
+		AdaptiveLatencyThreshold: internal.Duration{Duration: 2 * time.Second},
+		HTTPTimeout:              internal.Duration{Duration: time.Second * 5},
+		IdleConnTimeout:          internal.Duration{Duration: 90 * time.Second},
+	}
+}
+
+func init() {
+	inputs.Add("bitbucket", func() telegraf.Input {
+		return newBitbucket()
+	})
+}
@@ -0,0 +1,393 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer serves the given bodies by request path.  The placeholder
+// {{URL}} is replaced by the address of the server, so that bodies can
+// carry absolute pagination links.
+func newTestServer(t *testing.T, responses map[string]string) *httptest.Server {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path
+		if r.URL.Query().Get("page") != "" {
+			key += "?page=" + r.URL.Query().Get("page")
+		}
+		body, ok := responses[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"type": "error", "error": {"message": "not found"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, strings.Replace(body, "{{URL}}", ts.URL, -1))
+	}))
+	return ts
+}
+
+// recordRequests wraps handler to record the URL of every request.
+func recordRequests(handler http.Handler, requests *[]*url.URL) http.Handler {
+	var mu sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*requests = append(*requests, r.URL)
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func newTestBitbucket(t *testing.T, url string) *Bitbucket {
+	b := newBitbucket()
+	b.URL = url
+	b.Workspace = "acme"
+	b.Log = testutil.Logger{}
+	require.NoError(t, b.Init())
+	return b
+}
+
+func TestInitRequiresWorkspace(t *testing.T) {
+	b := &Bitbucket{}
+	require.Error(t, b.Init())
+}
+
+func TestInitRequiresCompleteCredentials(t *testing.T) {
+	b := &Bitbucket{}
+	b.Workspace = "acme"
+	b.ClientID = "key"
+	require.Error(t, b.Init())
+}
+
+func TestGatherRepositoriesPaginated(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme": `{
+			"values": [{"slug": "api", "is_private": true, "size": 1024, "language": "go", "has_issues": false, "has_wiki": true,
+				"links": {"clone": [
+					{"name": "https", "href": "https://bitbucket.org/acme/api.git"},
+					{"name": "ssh", "href": "git@bitbucket.org:acme/api.git"}
+				]}}],
+			"next": "{{URL}}/repositories/acme?page=2"
+		}`,
+		"/repositories/acme?page=2": `{
+			"values": [{"slug": "web", "is_private": false, "size": 2048, "language": "javascript", "has_issues": true, "has_wiki": false}]
+		}`,
+		"/repositories/acme/api/pipelines_config": `{"enabled": true}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.GatherPipelinesConfig = true
+	require.NoError(t, b.Init())
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_repository",
+		map[string]interface{}{
+			"size":              int64(1024),
+			"is_private":        true,
+			"has_issues":        false,
+			"has_wiki":          true,
+			"pipelines_enabled": true,
+			"clone_https":       "https://bitbucket.org/acme/api.git",
+			"clone_ssh":         "git@bitbucket.org:acme/api.git",
+		},
+		map[string]string{
+			"workspace":  "acme",
+			"repository": "api",
+			"language":   "go",
+		})
+	acc.AssertContainsTaggedFields(t, "bitbucket_repository",
+		map[string]interface{}{
+			"size":              int64(2048),
+			"is_private":        false,
+			"has_issues":        true,
+			"has_wiki":          false,
+			"pipelines_enabled": false,
+		},
+		map[string]string{
+			"workspace":  "acme",
+			"repository": "web",
+			"language":   "javascript",
+		})
+}
+
+func TestGatherPipelinesConfigForbidden(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+	})
+	defer ts.Close()
+	handler := ts.Config.Handler
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repositories/acme/api/pipelines_config" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"type": "error", "error": {"message": "forbidden"}}`)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPipelinesConfig = true
+	require.NoError(t, b.Init())
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	require.True(t, acc.HasMeasurement("bitbucket_repository"))
+	require.False(t, acc.HasField("bitbucket_repository", "pipelines_enabled"))
+}
+
+func TestGatherConfiguredRepositoryNotFound(t *testing.T) {
+	ts := newTestServer(t, map[string]string{})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"missing"}
+	var acc testutil.Accumulator
+	err := acc.GatherError(b.Gather)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not found")
+}
+
+func TestGatherPermissions(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/permissions-config/users": `{
+			"values": [
+				{"permission": "admin", "user": {"display_name": "Jane Doe", "account_id": "557058:1"}},
+				{"permission": "write", "user": {"display_name": "John Doe", "account_id": "557058:2"}},
+				{"permission": "write", "user": {"display_name": "Erika Mustermann", "account_id": "557058:3"}}
+			]
+		}`,
+		"/repositories/acme/api/permissions-config/groups": `{
+			"values": [
+				{"permission": "admin", "group": {"slug": "ops", "name": "Operations"}},
+				{"permission": "read", "group": {"slug": "everyone", "name": "Everyone"}}
+			]
+		}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPermissions = true
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_repository_permissions",
+		map[string]interface{}{"read": 0, "write": 2, "admin": 1, "total": 3},
+		map[string]string{"workspace": "acme", "repository": "api", "principal_type": "user"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_repository_permissions",
+		map[string]interface{}{"read": 1, "write": 0, "admin": 1, "total": 2},
+		map[string]string{"workspace": "acme", "repository": "api", "principal_type": "group"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_repository_admin_grant",
+		map[string]interface{}{"account_id": "557058:1"},
+		map[string]string{"workspace": "acme", "repository": "api", "principal_type": "user", "principal": "Jane Doe"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_repository_admin_grant",
+		map[string]interface{}{"name": "Operations"},
+		map[string]string{"workspace": "acme", "repository": "api", "principal_type": "group", "principal": "ops"})
+}
+
+func TestCreateHTTPClientTransport(t *testing.T) {
+	b := newTestBitbucket(t, "")
+	b.MaxConnections = 8
+	b.MaxIdleConns = 0
+	require.NoError(t, b.Init())
+
+	httpClient, err := b.createHTTPClient()
+	require.NoError(t, err)
+	transport := httpClient.Transport.(*http.Transport)
+	require.Equal(t, 8, transport.MaxIdleConnsPerHost)
+	require.Equal(t, 90*time.Second, transport.IdleConnTimeout)
+	require.Contains(t, transport.TLSNextProto, "h2")
+
+	b.ForceHTTP1 = true
+	httpClient, err = b.createHTTPClient()
+	require.NoError(t, err)
+	transport = httpClient.Transport.(*http.Transport)
+	require.NotNil(t, transport.TLSNextProto)
+	require.NotContains(t, transport.TLSNextProto, "h2")
+}
+
+func TestGatherMultipleWorkspaces(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme":    `{"values": [{"slug": "api"}]}`,
+		"/repositories/initech": `{"values": [{"slug": "tps"}]}`,
+		"/repositories/initech/tps/pullrequests": `{
+			"values": [{"id": 1, "state": "OPEN", "updated_on": "2999-01-02T15:04:05.000000+00:00"}]
+		}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Workspaces = []*WorkspaceConfig{
+		{Workspace: "initech", GatherPullRequests: true},
+	}
+	require.NoError(t, b.Init())
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	require.Len(t, b.workspaces, 2)
+	require.Equal(t, b.PullRequestStates, b.workspaces[1].PullRequestStates)
+	require.True(t, acc.HasTag("bitbucket_pull_request", "repository"))
+	acc.AssertContainsTaggedFields(t, "bitbucket_up",
+		map[string]interface{}{"success": 1, "repos_gathered": 1, "prs_gathered": 0, "errors": 0},
+		map[string]string{"workspace": "acme"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_up",
+		map[string]interface{}{"success": 1, "repos_gathered": 1, "prs_gathered": 1, "errors": 0},
+		map[string]string{"workspace": "initech"})
+}
+
+func TestInitRequiresWorkspaceInBlocks(t *testing.T) {
+	b := &Bitbucket{Workspaces: []*WorkspaceConfig{{}}}
+	require.Error(t, b.Init())
+}
+
+func TestInitRejectsInvalidGlobs(t *testing.T) {
+	b := newBitbucket()
+	b.Workspace = "acme"
+	b.QueueBranches = []string{"release/["}
+	require.EqualError(t, b.Init(), "compiling queue_branches failed: unexpected end of input")
+
+	b.QueueBranches = nil
+	b.Workspaces = []*WorkspaceConfig{{Workspace: "initech", PathInclude: []string{"src/["}}}
+	require.EqualError(t, b.Init(), "compiling path_include failed: unexpected end of input for initech")
+}
+
+func TestCreateWorkspacesKeepsNoneOnFailure(t *testing.T) {
+	b := newTestBitbucket(t, "http://127.0.0.1")
+	b.Workspaces = []*WorkspaceConfig{{Workspace: "initech"}}
+	require.NoError(t, b.Init())
+	b.newAuthProvider = func(cfg WorkspaceConfig) (bitbucketapi.AuthProvider, error) {
+		if cfg.Workspace == "initech" {
+			return nil, errors.New("no credentials")
+		}
+		return headerAuth{}, nil
+	}
+
+	require.EqualError(t, b.createWorkspaces(context.Background()), "no credentials for initech")
+	require.Nil(t, b.workspaces)
+}
+
+func TestInitRequiresCompleteCredentialsInBlocks(t *testing.T) {
+	b := &Bitbucket{Workspaces: []*WorkspaceConfig{{Workspace: "acme", ClientSecret: "secret"}}}
+	require.Error(t, b.Init())
+}
+
+func TestWorkspaceInheritsCredentials(t *testing.T) {
+	parent := WorkspaceConfig{ClientID: "key", ClientSecret: "secret"}
+
+	cfg := WorkspaceConfig{Workspace: "acme"}
+	cfg.inherit(parent)
+	require.Equal(t, "key", cfg.ClientID)
+	require.Equal(t, "secret", cfg.ClientSecret)
+
+	cfg = WorkspaceConfig{Workspace: "initech", ClientID: "other", ClientSecret: "othersecret"}
+	cfg.inherit(parent)
+	require.Equal(t, "other", cfg.ClientID)
+	require.Equal(t, "othersecret", cfg.ClientSecret)
+}
+
+func TestInitRejectsInvalidUserField(t *testing.T) {
+	b := newBitbucket()
+	b.Workspace = "acme"
+	b.UserField = "email"
+	require.Error(t, b.Init())
+}
+
+func TestInitRejectsInvalidDurationUnit(t *testing.T) {
+	b := newBitbucket()
+	b.Workspace = "acme"
+	b.DurationUnit = "d"
+	require.Error(t, b.Init())
+}
+
+func TestGatherDaysSinceLastCommit(t *testing.T) {
+	committed := time.Now().Add(-50 * time.Hour).UTC().Format(time.RFC3339)
+	updated := time.Now().Add(-25 * time.Hour).UTC().Format(time.RFC3339)
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api":              `{"slug": "api", "mainbranch": {"name": "main"}, "updated_on": "` + updated + `"}`,
+		"/repositories/acme/api/commits/main": `{"values": [{"date": "` + committed + `"}]}`,
+		"/repositories/acme/web":              `{"slug": "web", "updated_on": "` + updated + `"}`,
+	})
+	defer ts.Close()
+
+	gather := func(lastActivity bool) map[string]interface{} {
+		b := newTestBitbucket(t, ts.URL)
+		b.Repositories = []string{"api", "web"}
+		b.GatherLastActivity = lastActivity
+		var acc testutil.Accumulator
+		require.NoError(t, acc.GatherError(b.Gather))
+		since := make(map[string]interface{})
+		for _, m := range acc.Metrics {
+			if m.Measurement == "bitbucket_repository" {
+				since[m.Tags["repository"]] = m.Fields["days_since_last_commit"]
+			}
+		}
+		return since
+	}
+
+	// By default the last update of the repository is taken, the commits
+	// are only requested with gather_last_activity.
+	require.Equal(t, map[string]interface{}{"api": int64(1), "web": int64(1)}, gather(false))
+	require.Equal(t, map[string]interface{}{"api": int64(2), "web": nil}, gather(true))
+}
+
+func TestGatherRepositoriesExcludeForks(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme": `{"values": [
+			{"slug": "api"},
+			{"slug": "api-fork", "parent": {"full_name": "acme/api"}}
+		]}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.ExcludeForks = true
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	var slugs []string
+	for _, m := range acc.Metrics {
+		if m.Measurement == "bitbucket_repository" {
+			slugs = append(slugs, m.Tags["repository"])
+		}
+	}
+	require.Equal(t, []string{"api"}, slugs)
+}
+
+func TestGetRepositoriesUpdatedWithin(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme": `{"values": [{"slug": "api"}]}`,
+	})
+	defer ts.Close()
+	var requests []*url.URL
+	ts.Config.Handler = recordRequests(ts.Config.Handler, &requests)
+
+	b := newTestBitbucket(t, ts.URL)
+	b.RepoUpdatedWithin = internal.Duration{Duration: 720 * time.Hour}
+	require.NoError(t, b.Init())
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	require.NotEmpty(t, requests)
+	q := requests[0].Query().Get("q")
+	require.True(t, strings.HasPrefix(q, "updated_on >= "), q)
+	since, err := time.Parse(time.RFC3339, strings.TrimPrefix(q, "updated_on >= "))
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(-720*time.Hour), since, time.Minute)
+}
@@ -0,0 +1,123 @@
+package bitbucket
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// weekdays maps the names and abbreviations of business_days to weekdays.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// businessCalendar counts durations in business hours only, the hours
+// between start and end of the business days in the time zone.
+type businessCalendar struct {
+	days       [7]bool
+	start, end time.Duration
+	loc        *time.Location
+}
+
+// newBusinessCalendar returns the calendar of the business_days,
+// business_hours and business_timezone options, Monday to Friday, the whole
+// day and UTC when not set.
+func newBusinessCalendar(days []string, hours, timezone string) (*businessCalendar, error) {
+	c := &businessCalendar{end: 24 * time.Hour, loc: time.UTC}
+	if len(days) == 0 {
+		days = []string{"mon", "tue", "wed", "thu", "fri"}
+	}
+	for _, name := range days {
+		day, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid day in business_days %q", name)
+		}
+		c.days[day] = true
+	}
+
+	if hours != "" {
+		parts := strings.Split(hours, "-")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid business_hours %q", hours)
+		}
+		var err error
+		if c.start, err = parseClock(parts[0]); err != nil {
+			return nil, fmt.Errorf("invalid business_hours %q: %v", hours, err)
+		}
+		if c.end, err = parseClock(parts[1]); err != nil {
+			return nil, fmt.Errorf("invalid business_hours %q: %v", hours, err)
+		}
+		if c.start >= c.end {
+			return nil, fmt.Errorf("invalid business_hours %q: end not after start", hours)
+		}
+	}
+
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid business_timezone %q: %v", timezone, err)
+		}
+		c.loc = loc
+	}
+	return c, nil
+}
+
+// parseClock parses a time of day of the form "15:04", up to "24:00".
+func parseClock(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("%q is not of the form hh:mm", s)
+	}
+	h, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("%q is not of the form hh:mm", s)
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("%q is not of the form hh:mm", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m > 0) {
+		return 0, fmt.Errorf("%q is not a time of day", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// elapsed returns the time from from to to.  With a calendar only the
+// business hours in between count.
+func (c *businessCalendar) elapsed(from, to time.Time) time.Duration {
+	if c == nil {
+		return to.Sub(from)
+	}
+	if !to.After(from) {
+		return 0
+	}
+
+	from = from.In(c.loc)
+	to = to.In(c.loc)
+	var d time.Duration
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, c.loc)
+	for !day.After(to) {
+		if c.days[day.Weekday()] {
+			begin := day.Add(c.start)
+			end := day.Add(c.end)
+			if begin.Before(from) {
+				begin = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			if end.After(begin) {
+				d += end.Sub(begin)
+			}
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, c.loc)
+	}
+	return d
+}
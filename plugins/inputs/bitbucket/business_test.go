@@ -0,0 +1,88 @@
+package bitbucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBusinessCalendarElapsed(t *testing.T) {
+	c, err := newBusinessCalendar(nil, "09:00-17:00", "Europe/Berlin")
+	require.NoError(t, err)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	at := func(day, hour, min int) time.Time {
+		// February 2020 starts on a Saturday.
+		return time.Date(2020, 2, day, hour, min, 0, 0, berlin)
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		expected time.Duration
+	}{
+		{"within a day", at(3, 10, 0), at(3, 12, 30), 150 * time.Minute},
+		{"after hours", at(3, 18, 0), at(3, 23, 0), 0},
+		{"overnight", at(3, 16, 0), at(4, 10, 0), 2 * time.Hour},
+		{"over the weekend", at(7, 16, 0), at(10, 10, 0), 2 * time.Hour},
+		{"weekend only", at(8, 10, 0), at(9, 18, 0), 0},
+		{"two weeks", at(3, 9, 0), at(17, 9, 0), 10 * 8 * time.Hour},
+		{"reversed", at(4, 10, 0), at(3, 10, 0), 0},
+		{"other time zone", at(3, 10, 0).UTC(), at(3, 11, 0).UTC(), time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, c.elapsed(tt.from, tt.to))
+		})
+	}
+
+	var none *businessCalendar
+	require.Equal(t, 50*time.Hour, none.elapsed(at(8, 10, 0), at(10, 12, 0)))
+}
+
+func TestNewBusinessCalendar(t *testing.T) {
+	c, err := newBusinessCalendar([]string{"Sun", "monday"}, "", "")
+	require.NoError(t, err)
+	require.Equal(t, [7]bool{true, true}, c.days)
+	require.Equal(t, 24*time.Hour, c.end)
+	require.Equal(t, time.UTC, c.loc)
+
+	for _, tt := range []struct {
+		days     []string
+		hours    string
+		timezone string
+	}{
+		{days: []string{"someday"}},
+		{hours: "9-17"},
+		{hours: "09:00"},
+		{hours: "17:00-09:00"},
+		{hours: "09:00-24:30"},
+		{timezone: "Nowhere/Special"},
+	} {
+		_, err := newBusinessCalendar(tt.days, tt.hours, tt.timezone)
+		require.Error(t, err, "%v", tt)
+	}
+}
+
+func TestBusinessHoursAge(t *testing.T) {
+	// Opened Friday 16:00 UTC, gathered Monday 10:00 UTC.
+	created := time.Date(2020, 2, 7, 16, 0, 0, 0, time.UTC)
+	now := time.Date(2020, 2, 10, 10, 0, 0, 0, time.UTC)
+	b := newBitbucket()
+	b.Workspace = "acme"
+	b.BusinessHours = "09:00-17:00"
+	b.Log = testutil.Logger{}
+	require.NoError(t, b.Init())
+
+	w := &workspace{
+		WorkspaceConfig: WorkspaceConfig{Workspace: "acme"},
+		durationUnit:    "h",
+		calendar:        b.calendar,
+	}
+	var acc testutil.Accumulator
+	w.addPullRequest(&acc, repository{Slug: "api"}, pullRequest{ID: 1, State: "OPEN", CreatedOn: created}, now)
+	require.Len(t, acc.Metrics, 1)
+	require.Equal(t, 2.0, acc.Metrics[0].Fields["age"])
+}
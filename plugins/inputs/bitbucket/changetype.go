@@ -0,0 +1,54 @@
+package bitbucket
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// conventionalTitle matches the type prefix of a conventional commit style
+// title such as "feat(api)!: add endpoint".
+var conventionalTitle = regexp.MustCompile(`^\s*([A-Za-z]+)(\([^)]*\))?!?:`)
+
+// changeTypePattern classifies the titles matching a regular expression.
+type changeTypePattern struct {
+	changeType string
+	re         *regexp.Regexp
+}
+
+// compileChangeTypes compiles the patterns of change_type_patterns, ordered
+// by change type so that the first matching one is stable.
+func compileChangeTypes(patterns map[string]string) ([]changeTypePattern, error) {
+	compiled := make([]changeTypePattern, 0, len(patterns))
+	for changeType, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling change type %q failed: %v", changeType, err)
+		}
+		compiled = append(compiled, changeTypePattern{changeType: changeType, re: re})
+	}
+	sort.Slice(compiled, func(i, j int) bool {
+		return compiled[i].changeType < compiled[j].changeType
+	})
+	return compiled, nil
+}
+
+// changeType returns the change type of a pull request title.  Without
+// change_type_patterns the lower-cased conventional commit prefix is used.
+func (w *workspace) changeType(title string) (string, bool) {
+	if len(w.changeTypes) == 0 {
+		m := conventionalTitle.FindStringSubmatch(title)
+		if m == nil {
+			return "", false
+		}
+		return strings.ToLower(m[1]), true
+	}
+
+	for _, p := range w.changeTypes {
+		if p.re.MatchString(title) {
+			return p.changeType, true
+		}
+	}
+	return "", false
+}
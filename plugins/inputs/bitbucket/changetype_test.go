@@ -0,0 +1,52 @@
+package bitbucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeTypeConventional(t *testing.T) {
+	w := &workspace{classifyChangeType: true}
+	for title, expected := range map[string]string{
+		"feat: add endpoint":         "feat",
+		"Fix(api)!: reject requests": "fix",
+		"chore(deps): bump library":  "chore",
+		"Add endpoint":               "",
+	} {
+		changeType, _ := w.changeType(title)
+		require.Equal(t, expected, changeType, title)
+	}
+}
+
+func TestChangeTypePatterns(t *testing.T) {
+	b := newTestBitbucket(t, "")
+	b.ClassifyChangeType = true
+	b.ChangeTypePatterns = map[string]string{
+		"bugfix":  `^(fix|hotfix)(\(.*\))?:`,
+		"feature": `^feat(\(.*\))?:`,
+		"other":   `.`,
+	}
+	require.NoError(t, b.Init())
+
+	w := &workspace{classifyChangeType: b.ClassifyChangeType, changeTypes: b.changeTypes}
+	var acc testutil.Accumulator
+	now := time.Now()
+	w.addPullRequest(&acc, repository{Slug: "api"}, pullRequest{ID: 1, Title: "hotfix: restore login"}, now)
+	w.addPullRequest(&acc, repository{Slug: "api"}, pullRequest{ID: 2, Title: "feat(api): add endpoint"}, now)
+	w.addPullRequest(&acc, repository{Slug: "api"}, pullRequest{ID: 3, Title: "Update README"}, now)
+
+	changeTypes := make(map[int64]string)
+	for _, m := range acc.Metrics {
+		changeTypes[m.Fields["id"].(int64)] = m.Tags["change_type"]
+	}
+	require.Equal(t, map[int64]string{1: "bugfix", 2: "feature", 3: "other"}, changeTypes)
+}
+
+func TestChangeTypePatternsInvalid(t *testing.T) {
+	b := newTestBitbucket(t, "")
+	b.ChangeTypePatterns = map[string]string{"bugfix": "("}
+	require.Error(t, b.Init())
+}
@@ -0,0 +1,116 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/tidwall/gjson"
+)
+
+// decodePullRequests decodes a page of pull requests, keeping the document
+// of each when keepRaw is set.
+func decodePullRequests(values json.RawMessage, keepRaw bool) ([]pullRequest, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(values, &raw); err != nil {
+		return nil, err
+	}
+
+	prs := make([]pullRequest, len(raw))
+	for i, r := range raw {
+		if err := json.Unmarshal(r, &prs[i]); err != nil {
+			return nil, err
+		}
+		if keepRaw {
+			prs[i].raw = r
+		}
+	}
+	return prs, nil
+}
+
+// decodePullRequestsFast is like decodePullRequests but extracts the
+// reported attributes in a single pass over each document, without
+// reflection.  Malformed timestamps decode as the zero time rather than
+// failing.
+func decodePullRequestsFast(values json.RawMessage, keepRaw bool) ([]pullRequest, error) {
+	page := gjson.ParseBytes(values)
+	if !page.IsArray() {
+		return nil, errors.New("pull requests are not an array")
+	}
+
+	var prs []pullRequest
+	var err error
+	page.ForEach(func(_, value gjson.Result) bool {
+		if !value.IsObject() {
+			err = errors.New("pull request is not an object")
+			return false
+		}
+		pr := decodePullRequestFast(value)
+		if keepRaw {
+			pr.raw = json.RawMessage(value.Raw)
+		}
+		prs = append(prs, pr)
+		return true
+	})
+	return prs, err
+}
+
+func decodePullRequestFast(value gjson.Result) pullRequest {
+	var pr pullRequest
+	value.ForEach(func(key, value gjson.Result) bool {
+		switch key.Str {
+		case "id":
+			pr.ID = value.Int()
+		case "title":
+			pr.Title = value.String()
+		case "description":
+			pr.Description = value.String()
+		case "state":
+			pr.State = value.String()
+		case "created_on":
+			pr.CreatedOn = value.Time()
+		case "updated_on":
+			pr.UpdatedOn = value.Time()
+		case "comment_count":
+			pr.CommentCount = int(value.Int())
+		case "task_count":
+			pr.TaskCount = int(value.Int())
+		case "source":
+			pr.Source = decodeEndpointFast(value)
+		case "destination":
+			pr.Destination = decodeEndpointFast(value)
+		case "merge_commit":
+			pr.MergeCommit.Hash = value.Get("hash").String()
+		case "author":
+			pr.Author = decodeUserFast(value)
+		case "participants":
+			value.ForEach(func(_, value gjson.Result) bool {
+				pr.Participants = append(pr.Participants, participant{
+					Role:           value.Get("role").String(),
+					Approved:       value.Get("approved").Bool(),
+					State:          value.Get("state").String(),
+					ParticipatedOn: value.Get("participated_on").Time(),
+					User:           decodeUserFast(value.Get("user")),
+				})
+				return true
+			})
+		}
+		return true
+	})
+	return pr
+}
+
+func decodeEndpointFast(value gjson.Result) prEndpoint {
+	var e prEndpoint
+	e.Branch.Name = value.Get("branch.name").String()
+	e.Commit.Hash = value.Get("commit.hash").String()
+	return e
+}
+
+func decodeUserFast(value gjson.Result) prUser {
+	return prUser{
+		DisplayName: value.Get("display_name").String(),
+		Nickname:    value.Get("nickname").String(),
+		AccountID:   value.Get("account_id").String(),
+		UUID:        value.Get("uuid").String(),
+	}
+}
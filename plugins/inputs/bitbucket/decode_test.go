@@ -0,0 +1,78 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const pullRequestPage = `[
+	{"id": 7, "title": "feat: add endpoint", "description": "Adds [api] endpoint", "state": "OPEN",
+		"created_on": "2020-01-31T10:00:00.123456+00:00", "updated_on": "2020-02-01T08:30:00.5+00:00",
+		"comment_count": 4, "task_count": 1,
+		"source": {"branch": {"name": "feature/a"}, "commit": {"hash": "aaaaaaaaaaaa"}},
+		"destination": {"branch": {"name": "master"}},
+		"author": {"display_name": "Jane Doe", "nickname": "jdoe", "account_id": "557058:1"},
+		"participants": [
+			{"role": "REVIEWER", "approved": true, "state": "approved", "participated_on": "2020-01-31T12:00:00+00:00",
+				"user": {"display_name": "John Doe", "nickname": "john", "account_id": "557058:2", "uuid": "{2}"}},
+			{"role": "PARTICIPANT", "approved": false, "state": null,
+				"user": {"display_name": "Erika \"E\" Mustermann", "uuid": "{3}"}}
+		]},
+	{"id": 6, "state": "MERGED", "merge_commit": {"hash": "bbbbbbbbbbbb"}}
+]`
+
+func TestDecodePullRequestsFast(t *testing.T) {
+	expected, err := decodePullRequests(json.RawMessage(pullRequestPage), false)
+	require.NoError(t, err)
+	actual, err := decodePullRequestsFast(json.RawMessage(pullRequestPage), false)
+	require.NoError(t, err)
+	require.Equal(t, expected, actual)
+	require.Len(t, actual, 2)
+	require.Equal(t, "bbbbbbbbbbbb", actual[1].MergeCommit.Hash)
+}
+
+func TestDecodePullRequestsFastRaw(t *testing.T) {
+	prs, err := decodePullRequestsFast(json.RawMessage(`[{"id": 1}]`), true)
+	require.NoError(t, err)
+	require.Equal(t, `{"id": 1}`, string(prs[0].raw))
+}
+
+func TestDecodePullRequestsFastInvalid(t *testing.T) {
+	_, err := decodePullRequestsFast(json.RawMessage(`{"id": 1}`), false)
+	require.Error(t, err)
+	_, err = decodePullRequestsFast(json.RawMessage(`[1]`), false)
+	require.Error(t, err)
+}
+
+func benchmarkPage() json.RawMessage {
+	inner := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(pullRequestPage), "["), "]")
+	docs := make([]string, 25)
+	for i := range docs {
+		docs[i] = inner
+	}
+	return json.RawMessage(fmt.Sprintf("[%s]", strings.Join(docs, ",")))
+}
+
+func BenchmarkDecodePullRequests(b *testing.B) {
+	page := benchmarkPage()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := decodePullRequests(page, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodePullRequestsFast(b *testing.B) {
+	page := benchmarkPage()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := decodePullRequestsFast(page, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// dialer resolves host names with an optional custom DNS server and caches
+// the results, so that the API host is not looked up for every connection.
+// The addresses of the API host can also be pinned to skip resolving it.
+// Addresses of the preferred IP family are dialed first.
+type dialer struct {
+	dialer   net.Dialer
+	resolver *net.Resolver
+
+	// preferIPv4 and preferIPv6 select the family dialed first, when
+	// neither is set the resolver order is kept.
+	preferIPv4 bool
+	preferIPv6 bool
+
+	pinnedHost string
+	pinnedIPs  []string
+
+	ttl   time.Duration
+	mu    sync.Mutex
+	cache map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+func newDialer(timeout time.Duration, dnsServer string, ttl time.Duration, pinnedHost string, pinnedIPs []string) *dialer {
+	d := &dialer{
+		dialer:     net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second},
+		resolver:   net.DefaultResolver,
+		pinnedHost: pinnedHost,
+		pinnedIPs:  pinnedIPs,
+		ttl:        ttl,
+		cache:      make(map[string]dnsEntry),
+	}
+	if dnsServer != "" {
+		d.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return d.dialer.DialContext(ctx, network, dnsServer)
+			},
+		}
+	}
+	return d
+}
+
+// DialContext connects to the resolved addresses of the host in turn until
+// one of them succeeds.
+func (d *dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs = d.sortByFamily(addrs)
+
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = errors.New("no addresses found for " + host)
+	}
+	return nil, firstErr
+}
+
+func (d *dialer) lookup(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	if host == d.pinnedHost && len(d.pinnedIPs) > 0 {
+		return d.pinnedIPs, nil
+	}
+
+	now := time.Now()
+	if d.ttl > 0 {
+		d.mu.Lock()
+		entry, ok := d.cache[host]
+		d.mu.Unlock()
+		if ok && now.Before(entry.expires) {
+			return entry.addrs, nil
+		}
+	}
+
+	addrs, err := d.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.ttl > 0 {
+		d.mu.Lock()
+		d.cache[host] = dnsEntry{addrs: addrs, expires: now.Add(d.ttl)}
+		d.mu.Unlock()
+	}
+	return addrs, nil
+}
+
+// sortByFamily moves the addresses of the preferred family to the front,
+// keeping the other ones as fallback.
+func (d *dialer) sortByFamily(addrs []string) []string {
+	if !d.preferIPv4 && !d.preferIPv6 {
+		return addrs
+	}
+
+	preferred := make([]string, 0, len(addrs))
+	var others []string
+	for _, addr := range addrs {
+		isIPv4 := net.ParseIP(addr).To4() != nil
+		if isIPv4 == d.preferIPv4 {
+			preferred = append(preferred, addr)
+		} else {
+			others = append(others, addr)
+		}
+	}
+	return append(preferred, others...)
+}
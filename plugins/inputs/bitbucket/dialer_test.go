@@ -0,0 +1,63 @@
+package bitbucket
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialerPinnedIPs(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+
+	d := newDialer(time.Second, "", 0, "bitbucket.invalid", []string{"127.0.0.1"})
+	conn, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("bitbucket.invalid", port))
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestDialerCache(t *testing.T) {
+	d := newDialer(time.Second, "", time.Hour, "", nil)
+	d.cache["bitbucket.invalid"] = dnsEntry{
+		addrs:   []string{"127.0.0.1"},
+		expires: time.Now().Add(time.Hour),
+	}
+
+	addrs, err := d.lookup(context.Background(), "bitbucket.invalid")
+	require.NoError(t, err)
+	require.Equal(t, []string{"127.0.0.1"}, addrs)
+
+	d.cache["bitbucket.invalid"] = dnsEntry{
+		addrs:   []string{"127.0.0.1"},
+		expires: time.Now().Add(-time.Second),
+	}
+	_, err = d.lookup(context.Background(), "bitbucket.invalid")
+	require.Error(t, err)
+}
+
+func TestInitRejectsInvalidPinnedIP(t *testing.T) {
+	b := newBitbucket()
+	b.Workspace = "acme"
+	b.PinnedIPs = []string{"api.bitbucket.org"}
+	require.Error(t, b.Init())
+}
+
+func TestDialerSortByFamily(t *testing.T) {
+	addrs := []string{"2001:db8::1", "192.0.2.1", "2001:db8::2", "192.0.2.2"}
+
+	d := newDialer(time.Second, "", 0, "", nil)
+	require.Equal(t, addrs, d.sortByFamily(addrs))
+
+	d.preferIPv4 = true
+	require.Equal(t, []string{"192.0.2.1", "192.0.2.2", "2001:db8::1", "2001:db8::2"}, d.sortByFamily(addrs))
+
+	d.preferIPv4 = false
+	d.preferIPv6 = true
+	require.Equal(t, []string{"2001:db8::1", "2001:db8::2", "192.0.2.1", "192.0.2.2"}, d.sortByFamily(addrs))
+}
@@ -0,0 +1,154 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+// diffstatEntry is the change of a single file of a pull request.
+type diffstatEntry struct {
+	Status       string        `json:"status"`
+	LinesAdded   int           `json:"lines_added"`
+	LinesRemoved int           `json:"lines_removed"`
+	Old          *diffstatFile `json:"old"`
+	New          *diffstatFile `json:"new"`
+}
+
+type diffstatFile struct {
+	Path string `json:"path"`
+}
+
+// paths returns the paths the change touches, both of them for renames.
+func (d diffstatEntry) paths() []string {
+	var paths []string
+	if d.New != nil {
+		paths = append(paths, d.New.Path)
+	}
+	if d.Old != nil && (d.New == nil || d.Old.Path != d.New.Path) {
+		paths = append(paths, d.Old.Path)
+	}
+	return paths
+}
+
+// getDiffstat returns the changed files of a pull request.
+func (w *workspace) getDiffstat(ctx context.Context, repo repository, pr pullRequest) ([]diffstatEntry, error) {
+	entries := []diffstatEntry{}
+	path := bitbucketapi.PullRequestPath(w.Workspace, repo.Slug, pr.ID) + "/diffstat"
+	err := w.client.GetPages(ctx, path, url.Values{"pagelen": {"500"}}, func(values json.RawMessage) error {
+		var p []diffstatEntry
+		if err := json.Unmarshal(values, &p); err != nil {
+			return err
+		}
+		entries = append(entries, p...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// addDiffstats fetches the diffstat of every pull request.  Pull requests
+// touching no path of path_include are left out, as are those whose diffstat
+// cannot be fetched while filtering by path.
+func (w *workspace) addDiffstats(ctx context.Context, acc telegraf.Accumulator, repo repository, prs []pullRequest) []pullRequest {
+	var wg sync.WaitGroup
+	errs := make([]error, len(prs))
+	for i := range prs {
+		wg.Add(1)
+		go func(pr *pullRequest, err *error) {
+			defer wg.Done()
+			pr.diffstat, *err = w.getDiffstat(ctx, repo, *pr)
+		}(&prs[i], &errs[i])
+	}
+	wg.Wait()
+
+	kept := prs[:0]
+	for i, pr := range prs {
+		if errs[i] != nil {
+			acc.AddError(fmt.Errorf("gathering diffstat of pull request %d of %s failed: %v", pr.ID, repo.Slug, errs[i]))
+			if w.pathInclude != nil {
+				continue
+			}
+		} else if w.pathInclude != nil && !w.touchesIncludedPath(pr) {
+			continue
+		}
+		kept = append(kept, pr)
+	}
+	return kept
+}
+
+func (w *workspace) touchesIncludedPath(pr pullRequest) bool {
+	for _, entry := range pr.diffstat {
+		for _, path := range entry.paths() {
+			if w.pathInclude.Match(path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// diffstatFields returns the size of the change of a pull request.
+func diffstatFields(entries []diffstatEntry) map[string]interface{} {
+	var added, removed int
+	for _, entry := range entries {
+		added += entry.LinesAdded
+		removed += entry.LinesRemoved
+	}
+	return map[string]interface{}{
+		"files_changed": len(entries),
+		"lines_added":   added,
+		"lines_removed": removed,
+		"lines_changed": added + removed,
+	}
+}
+
+// component returns the component with the most changed lines among the
+// files of a diffstat, preferring the first by name on ties.  Each file
+// counts for the component of the longest prefix of path_tag_map matching
+// its new path, or its old one when removed.
+func (w *workspace) component(entries []diffstatEntry) (string, bool) {
+	lines := make(map[string]int)
+	for _, entry := range entries {
+		paths := entry.paths()
+		if len(paths) == 0 {
+			continue
+		}
+		if component, ok := w.pathComponent(paths[0]); ok {
+			lines[component] += entry.LinesAdded + entry.LinesRemoved
+		}
+	}
+
+	return mostLines(lines)
+}
+
+// mostLines returns the key with the most lines, the first by name on ties.
+func mostLines(lines map[string]int) (string, bool) {
+	var best string
+	found := false
+	for key, n := range lines {
+		if !found || n > lines[best] || (n == lines[best] && key < best) {
+			best, found = key, true
+		}
+	}
+	return best, found
+}
+
+func (w *workspace) pathComponent(path string) (string, bool) {
+	var component, prefix string
+	found := false
+	for p, c := range w.components {
+		if strings.HasPrefix(path, p) && (!found || len(p) > len(prefix)) {
+			component, prefix, found = c, p, true
+		}
+	}
+	return component, found
+}
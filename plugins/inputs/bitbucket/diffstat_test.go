@@ -0,0 +1,133 @@
+package bitbucket
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherPullRequestsDiffstat(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(`{
+			"values": [
+				{"id": 3, "state": "OPEN", "updated_on": "RECENT"},
+				{"id": 2, "state": "OPEN", "updated_on": "RECENT"},
+				{"id": 1, "state": "OPEN", "updated_on": "RECENT"}
+			]
+		}`, "RECENT", recent, -1),
+		"/repositories/acme/api/pullrequests/3/diffstat": `{
+			"values": [
+				{"status": "modified", "lines_added": 10, "lines_removed": 2,
+					"old": {"path": "services/payments/api.go"}, "new": {"path": "services/payments/api.go"}}
+			],
+			"next": "{{URL}}/repositories/acme/api/pullrequests/3/diffstat?page=2"
+		}`,
+		"/repositories/acme/api/pullrequests/3/diffstat?page=2": `{
+			"values": [
+				{"status": "added", "lines_added": 5, "lines_removed": 0, "old": null, "new": {"path": "README.md"}}
+			]
+		}`,
+		"/repositories/acme/api/pullrequests/2/diffstat": `{
+			"values": [
+				{"status": "renamed", "lines_added": 0, "lines_removed": 0,
+					"old": {"path": "services/payments/old.go"}, "new": {"path": "lib/new.go"}}
+			]
+		}`,
+		"/repositories/acme/api/pullrequests/1/diffstat": `{
+			"values": [
+				{"status": "removed", "lines_added": 0, "lines_removed": 7, "old": {"path": "docs/index.md"}, "new": null}
+			]
+		}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.GatherDiffstat = true
+	b.PathInclude = []string{"services/payments/**"}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	var ids []int64
+	for _, m := range acc.Metrics {
+		if m.Measurement == "bitbucket_pull_request" {
+			ids = append(ids, m.Fields["id"].(int64))
+		}
+	}
+	require.Equal(t, []int64{3, 2}, ids)
+
+	fields, ok := acc.Get("bitbucket_pull_request")
+	require.True(t, ok)
+	require.Equal(t, 2, fields.Fields["files_changed"])
+	require.Equal(t, 15, fields.Fields["lines_added"])
+	require.Equal(t, 2, fields.Fields["lines_removed"])
+	require.Equal(t, 17, fields.Fields["lines_changed"])
+}
+
+func TestGatherPullRequestsDiffstatError(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(`{
+			"values": [{"id": 3, "state": "OPEN", "updated_on": "RECENT"}]
+		}`, "RECENT", recent, -1),
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.GatherDiffstat = true
+	var acc testutil.Accumulator
+	require.NoError(t, b.Gather(&acc))
+
+	require.Len(t, acc.Errors, 1)
+	fields, ok := acc.Get("bitbucket_pull_request")
+	require.True(t, ok)
+	require.NotContains(t, fields.Fields, "lines_changed")
+}
+
+func TestComponent(t *testing.T) {
+	w := &workspace{components: map[string]string{
+		"services/":          "services",
+		"services/payments/": "payments",
+		"web/":               "frontend",
+	}}
+	entry := func(oldPath, newPath string, added, removed int) diffstatEntry {
+		e := diffstatEntry{LinesAdded: added, LinesRemoved: removed}
+		if oldPath != "" {
+			e.Old = &diffstatFile{Path: oldPath}
+		}
+		if newPath != "" {
+			e.New = &diffstatFile{Path: newPath}
+		}
+		return e
+	}
+
+	component, ok := w.component([]diffstatEntry{
+		entry("services/payments/api.go", "services/payments/api.go", 3, 1),
+		entry("", "services/auth/api.go", 2, 0),
+		entry("web/old.js", "", 0, 3),
+		entry("README.md", "README.md", 50, 0),
+	})
+	require.True(t, ok)
+	require.Equal(t, "payments", component)
+
+	component, ok = w.component([]diffstatEntry{
+		entry("web/index.js", "web/index.js", 1, 1),
+		entry("", "services/auth/api.go", 2, 0),
+	})
+	require.True(t, ok)
+	require.Equal(t, "frontend", component)
+
+	_, ok = w.component([]diffstatEntry{entry("README.md", "README.md", 1, 0)})
+	require.False(t, ok)
+}
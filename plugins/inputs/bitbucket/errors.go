@@ -0,0 +1,194 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+type errorKey struct {
+	endpoint   string
+	repository string
+	class      string
+}
+
+// errorLog collects the failed API requests of a gather by endpoint,
+// repository and class.
+type errorLog struct {
+	mu      sync.Mutex
+	baseURL string
+	counts  map[errorKey]int
+	last    map[errorKey]string
+}
+
+func newErrorLog(baseURL string) *errorLog {
+	return &errorLog{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		counts:  make(map[errorKey]int),
+		last:    make(map[errorKey]string),
+	}
+}
+
+// record notes a failed request of rawURL.  Requests canceled through ctx
+// are not failures.
+func (l *errorLog) record(ctx context.Context, rawURL, class string, err error) {
+	if l == nil || ctx.Err() != nil {
+		return
+	}
+	endpoint, repo := l.endpoint(rawURL)
+	key := errorKey{endpoint: endpoint, repository: repo, class: class}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.counts[key]++
+	l.last[key] = err.Error()
+}
+
+// endpoint returns the path of a request below the API root, with the
+// workspace, repository, user and object identifiers replaced by
+// placeholders, along with the repository it belongs to.
+func (l *errorLog) endpoint(rawURL string) (string, string) {
+	path := strings.TrimPrefix(rawURL, l.baseURL)
+	if u, err := url.Parse(path); err == nil {
+		path = u.Path
+	}
+
+	var repo string
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, s := range segments {
+		switch {
+		case i == 1 && (segments[0] == "repositories" || segments[0] == "workspaces"):
+			segments[i] = "{workspace}"
+		case i == 2 && segments[0] == "repositories":
+			repo = s
+			segments[i] = "{repo_slug}"
+		case i == 1 && segments[0] == "users":
+			segments[i] = "{user}"
+		case strings.HasPrefix(s, "{"):
+			segments[i] = "{id}"
+		default:
+			if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+				segments[i] = "{id}"
+			}
+		}
+	}
+	return "/" + strings.Join(segments, "/"), repo
+}
+
+// requestObserver keeps the statistics and the failures of the requests of
+// a workspace.
+type requestObserver struct {
+	stats  *requestStats
+	errors *errorLog
+}
+
+func (o requestObserver) Request(ctx context.Context) context.Context {
+	countRequest(ctx)
+	if o.stats == nil {
+		return ctx
+	}
+	o.stats.requests.Incr(1)
+	return o.stats.withTrace(ctx)
+}
+
+// Failure counts every unsuccessful response and transport failure, except
+// of canceled prefetches, as a request error.  Only the responses the gathers
+// do not handle themselves are reported as bitbucket_errors.
+func (o requestObserver) Failure(ctx context.Context, url string, class string, err error) {
+	apiErr, isStatus := err.(bitbucketapi.APIError)
+	if o.stats != nil && class != bitbucketapi.ClassParse && ctx.Err() == nil {
+		o.stats.errors.Incr(1)
+	}
+	if isStatus && bitbucketapi.IsExpectedStatus(ctx, apiErr.StatusCode) {
+		return
+	}
+	o.errors.record(ctx, url, class, err)
+}
+
+// drain returns the collected failures and starts over.
+func (l *errorLog) drain() (map[errorKey]int, map[errorKey]string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	counts, last := l.counts, l.last
+	l.counts = make(map[errorKey]int)
+	l.last = make(map[errorKey]string)
+	return counts, last
+}
+
+// addErrors reports the failed API requests of the gather.
+func (w *workspace) addErrors(acc telegraf.Accumulator) {
+	if w.errors == nil {
+		return
+	}
+
+	now := time.Now()
+	counts, last := w.errors.drain()
+	for key, count := range counts {
+		tags := map[string]string{
+			"workspace": w.Workspace,
+			"endpoint":  key.endpoint,
+			"class":     key.class,
+		}
+		if key.repository != "" {
+			tags["repository"] = key.repository
+		}
+		fields := map[string]interface{}{
+			"count":      count,
+			"last_error": last[key],
+		}
+		acc.AddFields(measurementErrors, fields, tags, now)
+	}
+}
+
+// The values of error_mode.
+const (
+	errorModeLenient = "lenient"
+	errorModeStrict  = "strict"
+)
+
+// collectingAccumulator keeps the errors of a gather instead of passing them
+// on, so that they can be returned from Gather with error_mode "strict".
+type collectingAccumulator struct {
+	telegraf.Accumulator
+
+	mu     sync.Mutex
+	errors []error
+}
+
+func newCollectingAccumulator(acc telegraf.Accumulator) *collectingAccumulator {
+	return &collectingAccumulator{Accumulator: acc}
+}
+
+func (c *collectingAccumulator) AddError(err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	c.errors = append(c.errors, err)
+	c.mu.Unlock()
+}
+
+// err returns the collected errors as one, or nil if there were none.
+func (c *collectingAccumulator) err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch len(c.errors) {
+	case 0:
+		return nil
+	case 1:
+		return c.errors[0]
+	}
+	msgs := make([]string, 0, len(c.errors))
+	for _, err := range c.errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Errorf("%d errors: %s", len(c.errors), strings.Join(msgs, "; "))
+}
@@ -0,0 +1,114 @@
+package bitbucket
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorLogEndpoint(t *testing.T) {
+	l := newErrorLog("https://api.bitbucket.org/2.0/")
+	for rawURL, expected := range map[string][2]string{
+		"https://api.bitbucket.org/2.0/repositories/acme?pagelen=100":                       {"/repositories/{workspace}", ""},
+		"https://api.bitbucket.org/2.0/repositories/acme/api/pullrequests?page=2":           {"/repositories/{workspace}/{repo_slug}/pullrequests", "api"},
+		"https://api.bitbucket.org/2.0/repositories/acme/api/pullrequests/7/diffstat":       {"/repositories/{workspace}/{repo_slug}/pullrequests/{id}/diffstat", "api"},
+		"https://api.bitbucket.org/2.0/repositories/acme/api/hooks/%7Bhook-1%7D/deliveries": {"/repositories/{workspace}/{repo_slug}/hooks/{id}/deliveries", "api"},
+		"https://api.bitbucket.org/2.0/workspaces/acme/members":                             {"/workspaces/{workspace}/members", ""},
+		"https://api.bitbucket.org/2.0/users/557058:1/ssh-keys":                             {"/users/{user}/ssh-keys", ""},
+	} {
+		endpoint, repo := l.endpoint(rawURL)
+		require.Equal(t, expected[0], endpoint, rawURL)
+		require.Equal(t, expected[1], repo, rawURL)
+	}
+}
+
+func TestGatherErrors(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api":  `{"slug": "api"}`,
+		"/repositories/acme/web":  `{"slug": "web"}`,
+		"/repositories/acme/docs": `{"slug": "docs"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(`{
+			"values": [{"id": 3, "state": "OPEN", "updated_on": "RECENT"}]
+		}`, "RECENT", recent, -1),
+		"/repositories/acme/web/pullrequests":            `{"values": [`,
+		"/repositories/acme/api/pullrequests/3/diffstat": `{"values": []}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api", "web", "docs"}
+	b.GatherPullRequests = true
+	var acc testutil.Accumulator
+	require.NoError(t, b.Gather(&acc))
+	require.Len(t, acc.Errors, 2)
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_errors",
+		map[string]interface{}{
+			"count":      1,
+			"last_error": "unexpected end of JSON input",
+		},
+		map[string]string{
+			"workspace":  "acme",
+			"repository": "web",
+			"endpoint":   "/repositories/{workspace}/{repo_slug}/pullrequests",
+			"class":      "parse",
+		})
+	var found bool
+	for _, m := range acc.GetTelegrafMetrics() {
+		if m.Name() != "bitbucket_errors" || m.Tags()["repository"] != "docs" {
+			continue
+		}
+		found = true
+		require.Equal(t, map[string]string{
+			"workspace":  "acme",
+			"repository": "docs",
+			"endpoint":   "/repositories/{workspace}/{repo_slug}/pullrequests",
+			"class":      "api",
+		}, m.Tags())
+		require.Equal(t, int64(1), m.Fields()["count"])
+		require.Contains(t, m.Fields()["last_error"], "404 Not Found: not found")
+	}
+	require.True(t, found)
+}
+
+func TestGatherErrorMode(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api":              `{"slug": "api"}`,
+		"/repositories/acme/web":              `{"slug": "web"}`,
+		"/repositories/acme/api/pullrequests": `{"values": [`,
+	})
+	defer ts.Close()
+
+	for _, mode := range []string{"", "lenient", "strict"} {
+		t.Run(mode, func(t *testing.T) {
+			b := newTestBitbucket(t, ts.URL)
+			b.Repositories = []string{"api", "web"}
+			b.GatherPullRequests = true
+			b.ErrorMode = mode
+			require.NoError(t, b.Init())
+
+			var acc testutil.Accumulator
+			err := b.Gather(&acc)
+			require.True(t, acc.HasMeasurement("bitbucket_repository"))
+			if mode == "strict" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "2 errors")
+				require.Empty(t, acc.Errors)
+			} else {
+				require.NoError(t, err)
+				require.Len(t, acc.Errors, 2)
+			}
+		})
+	}
+}
+
+func TestInitErrorMode(t *testing.T) {
+	b := newTestBitbucket(t, "http://localhost")
+	b.ErrorMode = "abort"
+	require.EqualError(t, b.Init(), `invalid error_mode "abort"`)
+}
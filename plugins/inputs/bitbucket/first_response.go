@@ -0,0 +1,122 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+// activityEntry is an entry of the activity log of a pull request, holding
+// either a comment, an approval or an update.
+type activityEntry struct {
+	Comment *struct {
+		CreatedOn time.Time `json:"created_on"`
+		User      prUser    `json:"user"`
+	} `json:"comment"`
+	Approval *struct {
+		Date time.Time `json:"date"`
+		User prUser    `json:"user"`
+	} `json:"approval"`
+}
+
+// sameUser returns whether both users are the same account.
+func sameUser(a, b prUser) bool {
+	if a.UUID != "" && b.UUID != "" {
+		return a.UUID == b.UUID
+	}
+	return a.AccountID != "" && a.AccountID == b.AccountID
+}
+
+// firstResponses keeps the time of the first response to the pull requests
+// of a workspace, which never changes once there was one.
+type firstResponses struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+func newFirstResponses() *firstResponses {
+	return &firstResponses{times: make(map[string]time.Time)}
+}
+
+func firstResponseKey(repo repository, pr pullRequest) string {
+	return repo.Slug + "/" + strconv.FormatInt(pr.ID, 10)
+}
+
+func (f *firstResponses) get(key string) (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.times[key]
+	return t, ok
+}
+
+func (f *firstResponses) set(key string, t time.Time) {
+	f.mu.Lock()
+	f.times[key] = t
+	f.mu.Unlock()
+}
+
+// getFirstResponse returns the time of the first comment or approval on a
+// pull request by someone other than its author, walking its activity log.
+func (w *workspace) getFirstResponse(ctx context.Context, repo repository, pr pullRequest) (time.Time, error) {
+	var first time.Time
+	respond := func(t time.Time, user prUser) {
+		if sameUser(user, pr.Author) {
+			return
+		}
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+	}
+
+	params := url.Values{"pagelen": {"50"}}
+	err := w.client.GetPages(ctx, bitbucketapi.PullRequestActivityPath(w.Workspace, repo.Slug, pr.ID), params, func(values json.RawMessage) error {
+		var page []activityEntry
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		for _, e := range page {
+			if e.Comment != nil {
+				respond(e.Comment.CreatedOn, e.Comment.User)
+			}
+			if e.Approval != nil {
+				respond(e.Approval.Date, e.Approval.User)
+			}
+		}
+		return nil
+	})
+	return first, err
+}
+
+// addFirstResponses attaches the time of the first response to the pull
+// requests.  Pull requests with a known first response cost no requests.
+func (w *workspace) addFirstResponses(ctx context.Context, acc telegraf.Accumulator, repo repository, prs []pullRequest) {
+	var wg sync.WaitGroup
+	for i := range prs {
+		key := firstResponseKey(repo, prs[i])
+		if t, ok := w.firstResponses.get(key); ok {
+			prs[i].firstResponse = t
+			continue
+		}
+		wg.Add(1)
+		go func(pr *pullRequest) {
+			defer wg.Done()
+			t, err := w.getFirstResponse(ctx, repo, *pr)
+			if err != nil {
+				acc.AddError(fmt.Errorf("gathering activity of pull request %d of %s failed: %v", pr.ID, repo.Slug, err))
+				return
+			}
+			if !t.IsZero() {
+				pr.firstResponse = t
+				w.firstResponses.set(key, t)
+			}
+		}(&prs[i])
+	}
+	wg.Wait()
+}
@@ -0,0 +1,70 @@
+package bitbucket
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherFirstResponse(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(`{"values": [
+			{"id": 1, "state": "OPEN", "created_on": "2020-02-10T08:00:00Z", "updated_on": "RECENT", "author": {"uuid": "{1}"}},
+			{"id": 2, "state": "OPEN", "created_on": "2020-02-10T08:00:00Z", "updated_on": "RECENT", "author": {"uuid": "{1}"}}
+		]}`, "RECENT", recent, -1),
+		"/repositories/acme/api/pullrequests/1/activity": `{"values": [
+			{"update": {"date": "2020-02-10T08:00:00Z"}},
+			{"comment": {"created_on": "2020-02-10T08:30:00Z", "user": {"uuid": "{1}"}}},
+			{"approval": {"date": "2020-02-10T10:00:00Z", "user": {"uuid": "{3}"}}},
+			{"comment": {"created_on": "2020-02-10T09:00:00Z", "user": {"uuid": "{2}"}}}
+		]}`,
+		"/repositories/acme/api/pullrequests/2/activity": `{"values": [
+			{"comment": {"created_on": "2020-02-10T08:30:00Z", "user": {"uuid": "{1}"}}}
+		]}`,
+	})
+	defer ts.Close()
+	var requests []*url.URL
+	ts.Config.Handler = recordRequests(ts.Config.Handler, &requests)
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.GatherFirstResponse = true
+	require.NoError(t, b.Init())
+
+	firstResponses := func() map[int64]interface{} {
+		var acc testutil.Accumulator
+		require.NoError(t, acc.GatherError(b.Gather))
+		responses := make(map[int64]interface{})
+		for _, m := range acc.Metrics {
+			if m.Measurement == "bitbucket_pull_request" {
+				responses[m.Fields["id"].(int64)] = m.Fields["seconds_to_first_response"]
+			}
+		}
+		return responses
+	}
+	activityRequests := func() int {
+		n := 0
+		for _, u := range requests {
+			if strings.HasSuffix(u.Path, "/activity") {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Comments by the author do not count as a response.
+	expected := map[int64]interface{}{1: int64(3600), 2: nil}
+	require.Equal(t, expected, firstResponses())
+	require.Equal(t, 2, activityRequests())
+
+	// The first response of pull request 1 is known, only 2 is walked.
+	require.Equal(t, expected, firstResponses())
+	require.Equal(t, 3, activityRequests())
+}
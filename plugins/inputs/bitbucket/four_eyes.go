@@ -0,0 +1,39 @@
+package bitbucket
+
+// isBypassAccount returns whether a user is one of bypass_accounts, matched
+// by account ID, UUID, nickname or display name.
+func (w *workspace) isBypassAccount(u prUser) bool {
+	for _, key := range []string{u.AccountID, u.UUID, u.Nickname, u.DisplayName} {
+		if key != "" && w.bypassAccounts[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// approvedBy returns whether any participant approved the pull request.
+func approvedBy(pr pullRequest) bool {
+	for _, p := range pr.Participants {
+		if p.Approved {
+			return true
+		}
+	}
+	return false
+}
+
+// selfApproved returns whether every approval of a pull request, by any
+// participant, came from its author or a bypass account, so that no second
+// person approved it.  It is not known for pull requests without approvals.
+func (w *workspace) selfApproved(pr pullRequest) (self, known bool) {
+	self = true
+	for _, p := range pr.Participants {
+		if !p.Approved {
+			continue
+		}
+		known = true
+		if !sameUser(p.User, pr.Author) && !w.isBypassAccount(p.User) {
+			self = false
+		}
+	}
+	return self && known, known
+}
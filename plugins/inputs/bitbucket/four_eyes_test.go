@@ -0,0 +1,35 @@
+package bitbucket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfApproved(t *testing.T) {
+	w := &workspace{bypassAccounts: map[string]bool{"deploy-bot": true}}
+	jane := prUser{DisplayName: "Jane Doe", AccountID: "557058:1", UUID: "{1}"}
+	john := prUser{DisplayName: "John Doe", AccountID: "557058:2", UUID: "{2}"}
+	bot := prUser{Nickname: "deploy-bot", UUID: "{3}"}
+
+	tests := []struct {
+		name         string
+		participants []participant
+		self, known  bool
+	}{
+		{"no approvals", []participant{{Role: "REVIEWER", User: john}}, false, false},
+		{"by the author", []participant{{Role: "PARTICIPANT", User: jane, Approved: true}}, true, true},
+		{"by a bypass account", []participant{{Role: "REVIEWER", User: bot, Approved: true}}, true, true},
+		{"by a reviewer", []participant{
+			{Role: "PARTICIPANT", User: jane, Approved: true},
+			{Role: "REVIEWER", User: john, Approved: true},
+		}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			self, known := w.selfApproved(pullRequest{Author: jane, Participants: tt.participants})
+			require.Equal(t, tt.self, self)
+			require.Equal(t, tt.known, known)
+		})
+	}
+}
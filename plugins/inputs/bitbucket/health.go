@@ -0,0 +1,65 @@
+package bitbucket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// countingAccumulator counts the metrics added per measurement and the errors
+// passed on to the wrapped accumulator during a gather.
+type countingAccumulator struct {
+	telegraf.Accumulator
+
+	mu      sync.Mutex
+	metrics map[string]int
+	errors  int
+}
+
+func newCountingAccumulator(acc telegraf.Accumulator) *countingAccumulator {
+	return &countingAccumulator{
+		Accumulator: acc,
+		metrics:     make(map[string]int),
+	}
+}
+
+func (c *countingAccumulator) AddFields(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	c.mu.Lock()
+	c.metrics[measurement]++
+	c.mu.Unlock()
+	c.Accumulator.AddFields(measurement, fields, tags, t...)
+}
+
+func (c *countingAccumulator) AddError(err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	c.errors++
+	c.mu.Unlock()
+	c.Accumulator.AddError(err)
+}
+
+// addUp reports the health of a gather, err being the error failing it.
+func (w *workspace) addUp(acc telegraf.Accumulator, counter *countingAccumulator, err error) {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	success, errors := 1, counter.errors
+	if err != nil {
+		success = 0
+		errors++
+	}
+
+	tags := map[string]string{
+		"workspace": w.Workspace,
+	}
+	fields := map[string]interface{}{
+		"success":        success,
+		"repos_gathered": counter.metrics[measurementRepository],
+		"prs_gathered":   counter.metrics[measurementPullRequest],
+		"errors":         errors,
+	}
+	acc.AddFields(measurementUp, fields, tags, time.Now())
+}
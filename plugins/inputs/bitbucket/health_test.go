@@ -0,0 +1,38 @@
+package bitbucket
+
+import (
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherUp(t *testing.T) {
+	responses := map[string]string{
+		"/repositories/acme": `{"values": [{"slug": "api"}, {"slug": "web"}]}`,
+		"/repositories/acme/api/pullrequests": `{
+			"values": [
+				{"id": 1, "state": "OPEN", "updated_on": "2999-01-02T15:04:05.000000+00:00"},
+				{"id": 2, "state": "OPEN", "updated_on": "2999-01-02T15:04:05.000000+00:00"}
+			]
+		}`,
+	}
+	ts := newTestServer(t, responses)
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.GatherPullRequests = true
+	var acc testutil.Accumulator
+	require.NoError(t, b.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	acc.AssertContainsTaggedFields(t, "bitbucket_up",
+		map[string]interface{}{"success": 1, "repos_gathered": 2, "prs_gathered": 2, "errors": 1},
+		map[string]string{"workspace": "acme"})
+
+	delete(responses, "/repositories/acme")
+	acc.ClearMetrics()
+	require.Error(t, acc.GatherError(b.Gather))
+	acc.AssertContainsTaggedFields(t, "bitbucket_up",
+		map[string]interface{}{"success": 0, "repos_gathered": 0, "prs_gathered": 0, "errors": 1},
+		map[string]string{"workspace": "acme"})
+}
@@ -0,0 +1,99 @@
+package bitbucket
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// histogram counts observations into cumulative buckets, in the form the
+// prometheus_client output expects: one field per upper bound along with the
+// count and sum.
+type histogram struct {
+	bounds []float64
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) fields() map[string]interface{} {
+	fields := make(map[string]interface{}, len(h.bounds)+3)
+	for i, bound := range h.bounds {
+		fields[strconv.FormatFloat(bound, 'f', -1, 64)] = h.counts[i]
+	}
+	fields["+Inf"] = h.count
+	fields["count"] = h.count
+	fields["sum"] = h.sum
+	return fields
+}
+
+// validBuckets returns whether the bucket bounds are finite and strictly
+// increasing.
+func validBuckets(bounds []float64) bool {
+	for i, bound := range bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return false
+		}
+		if i > 0 && bound <= bounds[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// durationValue returns d in the duration unit as a float, for observations
+// of histograms.
+func (w *workspace) durationValue(d time.Duration) float64 {
+	switch w.durationUnit {
+	case "m":
+		return d.Minutes()
+	case "h":
+		return d.Hours()
+	default:
+		return d.Seconds()
+	}
+}
+
+// addHistograms reports the distributions of the age of the open and the
+// time to merge of the merged pull requests of the repository.
+func (w *workspace) addHistograms(acc telegraf.Accumulator, repo repository, prs []pullRequest, now time.Time) {
+	age := newHistogram(w.histogramBuckets)
+	timeToMerge := newHistogram(w.histogramBuckets)
+	for _, pr := range prs {
+		switch pr.State {
+		case "OPEN":
+			age.observe(w.durationValue(w.calendar.elapsed(pr.CreatedOn, now)))
+		case "MERGED":
+			timeToMerge.observe(w.durationValue(w.calendar.elapsed(pr.CreatedOn, pr.UpdatedOn)))
+		}
+	}
+
+	tags := func() map[string]string {
+		tags := w.repositoryTags(repo)
+		if repo.Project.Key != "" {
+			tags["project"] = repo.Project.Key
+		}
+		return tags
+	}
+	acc.AddHistogram(measurementAgeHistogram, age.fields(), tags(), now)
+	acc.AddHistogram(measurementTimeToMergeHistogram, timeToMerge.fields(), tags(), now)
+}
@@ -0,0 +1,63 @@
+package bitbucket
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]float64{1, 2.5, 10})
+	for _, v := range []float64{0.5, 1, 2, 11} {
+		h.observe(v)
+	}
+	require.Equal(t, map[string]interface{}{
+		"1":     int64(2),
+		"2.5":   int64(3),
+		"10":    int64(3),
+		"+Inf":  int64(4),
+		"count": int64(4),
+		"sum":   14.5,
+	}, h.fields())
+}
+
+func TestValidBuckets(t *testing.T) {
+	require.True(t, validBuckets(nil))
+	require.True(t, validBuckets([]float64{1, 2, 3}))
+	require.False(t, validBuckets([]float64{1, 1}))
+	require.False(t, validBuckets([]float64{2, 1}))
+	require.False(t, validBuckets([]float64{1, math.Inf(1)}))
+}
+
+func TestAddHistograms(t *testing.T) {
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	w := &workspace{
+		WorkspaceConfig:  WorkspaceConfig{Workspace: "acme"},
+		durationUnit:     "h",
+		histogramBuckets: []float64{1, 24},
+	}
+	prs := []pullRequest{
+		{State: "OPEN", CreatedOn: now.Add(-30 * time.Minute)},
+		{State: "OPEN", CreatedOn: now.Add(-48 * time.Hour)},
+		{State: "MERGED", CreatedOn: now.Add(-4 * time.Hour), UpdatedOn: now.Add(-2 * time.Hour)},
+		{State: "DECLINED", CreatedOn: now.Add(-4 * time.Hour), UpdatedOn: now},
+	}
+
+	var acc testutil.Accumulator
+	w.addHistograms(&acc, repository{Slug: "api"}, prs, now)
+
+	tags := map[string]string{"workspace": "acme", "repository": "api"}
+	expected := []telegraf.Metric{
+		testutil.MustMetric("bitbucket_pull_request_age", tags,
+			map[string]interface{}{"1": int64(1), "24": int64(1), "+Inf": int64(2), "count": int64(2), "sum": 48.5},
+			now, telegraf.Histogram),
+		testutil.MustMetric("bitbucket_pull_request_time_to_merge", tags,
+			map[string]interface{}{"1": int64(0), "24": int64(1), "+Inf": int64(1), "count": int64(1), "sum": 2.0},
+			now, telegraf.Histogram),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics())
+}
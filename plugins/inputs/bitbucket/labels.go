@@ -0,0 +1,47 @@
+package bitbucket
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// compileLabelPatterns compiles the expressions of label_patterns.
+func compileLabelPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling label pattern %q failed: %v", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// labels returns the labels marked in the title and description of a pull
+// request, lower-cased, sorted and without duplicates.  A label is the
+// first group of a matching expression, or the whole match without groups.
+func (w *workspace) labels(pr pullRequest) []string {
+	seen := make(map[string]bool)
+	var labels []string
+	for _, text := range []string{pr.Title, pr.Description} {
+		for _, re := range w.labelPatterns {
+			for _, m := range re.FindAllStringSubmatch(text, -1) {
+				label := m[0]
+				if len(m) > 1 {
+					label = m[1]
+				}
+				label = strings.ToLower(strings.TrimSpace(label))
+				if label == "" || seen[label] {
+					continue
+				}
+				seen[label] = true
+				labels = append(labels, label)
+			}
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
@@ -0,0 +1,67 @@
+package bitbucket
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabels(t *testing.T) {
+	patterns, err := compileLabelPatterns([]string{`\[([A-Za-z0-9_-]+)\]`, `(?i)\bCVE-\d+-\d+`})
+	require.NoError(t, err)
+	w := &workspace{labelPatterns: patterns}
+
+	require.Equal(t, []string{"cve-2020-1234", "hotfix", "security"}, w.labels(pullRequest{
+		Title:       "[Hotfix] Escape input",
+		Description: "Fixes CVE-2020-1234.\n\n[security] [hotfix]",
+	}))
+	require.Empty(t, w.labels(pullRequest{Title: "Add endpoint"}))
+}
+
+func TestLabelPatternsInvalid(t *testing.T) {
+	b := newBitbucket()
+	b.Workspace = "acme"
+	b.LabelPatterns = []string{`[`}
+	require.Error(t, b.Init())
+}
+
+func TestGatherLabels(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(`{"values": [
+			{"id": 1, "state": "OPEN", "title": "[hotfix] Escape input", "description": "[security]", "updated_on": "RECENT"},
+			{"id": 2, "state": "OPEN", "title": "Add endpoint", "updated_on": "RECENT"}
+		]}`, "RECENT", recent, -1),
+	})
+	defer ts.Close()
+	var requests []*url.URL
+	ts.Config.Handler = recordRequests(ts.Config.Handler, &requests)
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.LabelPatterns = []string{`\[(\w+)\]`}
+	require.NoError(t, b.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	labels := make(map[int64]string)
+	for _, m := range acc.Metrics {
+		if m.Measurement == "bitbucket_pull_request" {
+			labels[m.Fields["id"].(int64)] = m.Tags["labels"]
+		}
+	}
+	require.Equal(t, map[int64]string{1: "hotfix,security", 2: ""}, labels)
+
+	for _, u := range requests {
+		if listsPullRequests(u) {
+			require.Contains(t, u.Query().Get("fields"), "values.description")
+		}
+	}
+}
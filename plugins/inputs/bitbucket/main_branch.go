@@ -0,0 +1,113 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+// The combined build states of a commit.
+const (
+	buildSuccessful = "successful"
+	buildFailed     = "failed"
+	buildPending    = "pending"
+)
+
+type commit struct {
+	Hash string    `json:"hash"`
+	Date time.Time `json:"date"`
+}
+
+type commitStatus struct {
+	State string `json:"state"`
+}
+
+// buildState combines the build statuses of a commit: failed when any build
+// failed or was stopped, pending while any is in progress and successful
+// once all succeeded.  Commits without builds have no state.
+func buildState(statuses []commitStatus) string {
+	if len(statuses) == 0 {
+		return ""
+	}
+	state := buildSuccessful
+	for _, s := range statuses {
+		switch s.State {
+		case "FAILED", "STOPPED":
+			return buildFailed
+		case "INPROGRESS":
+			state = buildPending
+		}
+	}
+	return state
+}
+
+// gatherMainBranch reports whether the builds of the main branch pass, by
+// the latest of its commits whose builds completed, and how long ago the
+// last commit with passing builds was made.  Only the main_branch_depth most
+// recent commits are examined.
+func (w *workspace) gatherMainBranch(ctx context.Context, acc telegraf.Accumulator, repo repository) error {
+	branch := repo.MainBranch.Name
+	if branch == "" {
+		return nil
+	}
+
+	depth := w.MainBranchDepth
+	if depth <= 0 {
+		depth = 20
+	}
+	params := url.Values{
+		"pagelen": {strconv.Itoa(depth)},
+		"fields":  {"values.hash,values.date"},
+	}
+	var commits struct {
+		Values []commit `json:"values"`
+	}
+	if err := w.client.Get(ctx, bitbucketapi.CommitsPath(w.Workspace, repo.Slug, branch), params, &commits); err != nil {
+		return fmt.Errorf("listing commits of %s of %s failed: %v", branch, repo.Slug, err)
+	}
+
+	var latest string
+	var lastGreen time.Time
+	for _, c := range commits.Values {
+		var statuses struct {
+			Values []commitStatus `json:"values"`
+		}
+		params := url.Values{"pagelen": {"100"}, "fields": {"values.state"}}
+		if err := w.client.Get(ctx, bitbucketapi.CommitStatusesPath(w.Workspace, repo.Slug, c.Hash), params, &statuses); err != nil {
+			return fmt.Errorf("getting build statuses of %s of %s failed: %v", c.Hash, repo.Slug, err)
+		}
+		state := buildState(statuses.Values)
+		if state != buildSuccessful && state != buildFailed {
+			continue
+		}
+		if latest == "" {
+			latest = state
+		}
+		if state == buildSuccessful {
+			lastGreen = c.Date
+			break
+		}
+	}
+	if latest == "" {
+		return nil
+	}
+
+	tags := w.repositoryTags(repo)
+	tags["branch"] = branch
+	fields := map[string]interface{}{
+		"main_branch_green": latest == buildSuccessful,
+		"state":             latest,
+	}
+	if latest == buildSuccessful {
+		fields["since_last_green"] = w.duration(0)
+	} else if !lastGreen.IsZero() {
+		fields["since_last_green"] = w.duration(time.Since(lastGreen))
+	}
+	acc.AddFields(measurementMainBranch, fields, tags)
+	return nil
+}
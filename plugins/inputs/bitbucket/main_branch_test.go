@@ -0,0 +1,63 @@
+package bitbucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildState(t *testing.T) {
+	require.Equal(t, "", buildState(nil))
+	require.Equal(t, buildSuccessful, buildState([]commitStatus{{State: "SUCCESSFUL"}, {State: "SUCCESSFUL"}}))
+	require.Equal(t, buildPending, buildState([]commitStatus{{State: "SUCCESSFUL"}, {State: "INPROGRESS"}}))
+	require.Equal(t, buildFailed, buildState([]commitStatus{{State: "INPROGRESS"}, {State: "STOPPED"}}))
+	require.Equal(t, buildFailed, buildState([]commitStatus{{State: "FAILED"}, {State: "SUCCESSFUL"}}))
+}
+
+func TestGatherMainBranch(t *testing.T) {
+	green := time.Now().Add(-2 * time.Hour).UTC()
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api", "mainbranch": {"name": "main"}}`,
+		"/repositories/acme/web": `{"slug": "web", "mainbranch": {"name": "master"}}`,
+		"/repositories/acme/api/commits/main": `{"values": [
+			{"hash": "c3", "date": "2020-02-11T16:00:00Z"},
+			{"hash": "c2", "date": "2020-02-11T15:00:00Z"},
+			{"hash": "c1", "date": "` + green.Format(time.RFC3339) + `"}
+		]}`,
+		"/repositories/acme/api/commit/c3/statuses": `{"values": [{"state": "INPROGRESS"}]}`,
+		"/repositories/acme/api/commit/c2/statuses": `{"values": [{"state": "SUCCESSFUL"}, {"state": "FAILED"}]}`,
+		"/repositories/acme/api/commit/c1/statuses": `{"values": [{"state": "SUCCESSFUL"}]}`,
+		"/repositories/acme/web/commits/master":     `{"values": [{"hash": "d1", "date": "2020-02-11T16:00:00Z"}]}`,
+		"/repositories/acme/web/commit/d1/statuses": `{"values": [{"state": "SUCCESSFUL"}]}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api", "web"}
+	b.GatherMainBranch = true
+	require.NoError(t, b.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	fields := make(map[string]map[string]interface{})
+	for _, m := range acc.Metrics {
+		if m.Measurement == "bitbucket_main_branch" {
+			fields[m.Tags["repository"]+"@"+m.Tags["branch"]] = m.Fields
+		}
+	}
+	require.Len(t, fields, 2)
+
+	api := fields["api@main"]
+	require.Equal(t, false, api["main_branch_green"])
+	require.Equal(t, "failed", api["state"])
+	require.InDelta(t, 2*time.Hour.Seconds(), api["since_last_green"], 60)
+
+	require.Equal(t, map[string]interface{}{
+		"main_branch_green": true,
+		"state":             "successful",
+		"since_last_green":  int64(0),
+	}, fields["web@master"])
+}
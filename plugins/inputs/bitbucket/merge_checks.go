@@ -0,0 +1,182 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+// The kinds of branch restrictions checked before merging.
+const (
+	checkApprovals          = "require_approvals_to_merge"
+	checkPassingBuilds      = "require_passing_builds_to_merge"
+	checkTasksCompleted     = "require_tasks_to_be_completed"
+	checkNoChangesRequested = "require_no_changes_requested"
+)
+
+type branchRestriction struct {
+	Kind            string `json:"kind"`
+	BranchMatchKind string `json:"branch_match_kind"`
+	Pattern         string `json:"pattern"`
+	Value           int    `json:"value"`
+}
+
+// mergeChecks are the merge checks applying to a branch pattern.
+type mergeChecks struct {
+	pattern string
+	branch  filter.Filter
+
+	approvals          int
+	passingBuilds      int
+	tasksCompleted     bool
+	noChangesRequested bool
+}
+
+// getMergeChecks returns the merge checks of a repository by branch
+// pattern.  Restrictions matching branches by the branching model are not
+// supported and left out.
+func (w *workspace) getMergeChecks(ctx context.Context, repo repository) ([]*mergeChecks, error) {
+	var checks []*mergeChecks
+	byPattern := make(map[string]*mergeChecks)
+	params := url.Values{"pagelen": {"100"}}
+	err := w.client.GetPages(ctx, bitbucketapi.BranchRestrictionsPath(w.Workspace, repo.Slug), params, func(values json.RawMessage) error {
+		var page []branchRestriction
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		for _, r := range page {
+			if r.BranchMatchKind != "glob" {
+				continue
+			}
+			switch r.Kind {
+			case checkApprovals, checkPassingBuilds, checkTasksCompleted, checkNoChangesRequested:
+			default:
+				continue
+			}
+
+			c, ok := byPattern[r.Pattern]
+			if !ok {
+				branch, err := filter.Compile([]string{r.Pattern})
+				if err != nil {
+					return fmt.Errorf("invalid branch pattern %q: %v", r.Pattern, err)
+				}
+				c = &mergeChecks{pattern: r.Pattern, branch: branch}
+				byPattern[r.Pattern] = c
+				checks = append(checks, c)
+			}
+			switch r.Kind {
+			case checkApprovals:
+				c.approvals = r.Value
+			case checkPassingBuilds:
+				c.passingBuilds = r.Value
+			case checkTasksCompleted:
+				c.tasksCompleted = true
+			case checkNoChangesRequested:
+				c.noChangesRequested = true
+			}
+		}
+		return nil
+	})
+	return checks, err
+}
+
+// mergeChecksFor returns the strictest combination of the merge checks
+// applying to a branch.
+func mergeChecksFor(checks []*mergeChecks, branch string) mergeChecks {
+	var combined mergeChecks
+	for _, c := range checks {
+		if !c.branch.Match(branch) {
+			continue
+		}
+		if c.approvals > combined.approvals {
+			combined.approvals = c.approvals
+		}
+		if c.passingBuilds > combined.passingBuilds {
+			combined.passingBuilds = c.passingBuilds
+		}
+		combined.tasksCompleted = combined.tasksCompleted || c.tasksCompleted
+		combined.noChangesRequested = combined.noChangesRequested || c.noChangesRequested
+	}
+	return combined
+}
+
+// satisfied returns whether the pull request passes the checks, given the
+// build statuses of its source commit.  The required number of builds must
+// have succeeded with none failed or still running.
+func (c mergeChecks) satisfied(pr pullRequest, statuses []commitStatus) bool {
+	var approvals int
+	for _, p := range pr.Participants {
+		if p.Approved {
+			approvals++
+		}
+		if c.noChangesRequested && p.State == "changes_requested" {
+			return false
+		}
+	}
+	if approvals < c.approvals {
+		return false
+	}
+	if c.tasksCompleted && pr.TaskCount > 0 {
+		return false
+	}
+	if c.passingBuilds > 0 {
+		if buildState(statuses) != buildSuccessful || len(statuses) < c.passingBuilds {
+			return false
+		}
+	}
+	return true
+}
+
+// addMergeChecks reports the merge checks of the repository and determines
+// whether its open pull requests currently satisfy them.  The build statuses
+// of a pull request are only requested when its branch requires builds.
+func (w *workspace) addMergeChecks(ctx context.Context, acc telegraf.Accumulator, repo repository, prs []pullRequest) {
+	checks, err := w.getMergeChecks(ctx, repo)
+	if err != nil {
+		acc.AddError(fmt.Errorf("gathering merge checks of %s failed: %v", repo.Slug, err))
+		return
+	}
+	for _, c := range checks {
+		tags := w.repositoryTags(repo)
+		tags["branch_pattern"] = c.pattern
+		acc.AddFields(measurementMergeChecks, map[string]interface{}{
+			"min_approvals":                c.approvals,
+			"min_successful_builds":        c.passingBuilds,
+			"require_tasks_completed":      c.tasksCompleted,
+			"require_no_changes_requested": c.noChangesRequested,
+		}, tags)
+	}
+
+	var wg sync.WaitGroup
+	for i := range prs {
+		if prs[i].State != "OPEN" {
+			continue
+		}
+		wg.Add(1)
+		go func(pr *pullRequest) {
+			defer wg.Done()
+			c := mergeChecksFor(checks, pr.Destination.Branch.Name)
+			var statuses []commitStatus
+			if c.passingBuilds > 0 {
+				var page struct {
+					Values []commitStatus `json:"values"`
+				}
+				params := url.Values{"pagelen": {"100"}, "fields": {"values.state"}}
+				if err := w.client.Get(ctx, bitbucketapi.PullRequestStatusesPath(w.Workspace, repo.Slug, pr.ID), params, &page); err != nil {
+					acc.AddError(fmt.Errorf("gathering build statuses of pull request %d of %s failed: %v", pr.ID, repo.Slug, err))
+					return
+				}
+				statuses = page.Values
+			}
+			mergeable := c.satisfied(*pr, statuses)
+			pr.mergeable = &mergeable
+		}(&prs[i])
+	}
+	wg.Wait()
+}
@@ -0,0 +1,82 @@
+package bitbucket
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherMergeChecks(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/branch-restrictions": `{"values": [
+			{"kind": "require_approvals_to_merge", "branch_match_kind": "glob", "pattern": "master", "value": 2},
+			{"kind": "require_passing_builds_to_merge", "branch_match_kind": "glob", "pattern": "master", "value": 1},
+			{"kind": "require_tasks_to_be_completed", "branch_match_kind": "glob", "pattern": "release/*"},
+			{"kind": "push", "branch_match_kind": "glob", "pattern": "master"},
+			{"kind": "require_approvals_to_merge", "branch_match_kind": "branching_model", "branch_type": "production", "value": 3}
+		]}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(`{"values": [
+			{"id": 1, "state": "OPEN", "updated_on": "RECENT", "destination": {"branch": {"name": "master"}},
+				"participants": [{"role": "REVIEWER", "approved": true}, {"role": "REVIEWER", "approved": true}]},
+			{"id": 2, "state": "OPEN", "updated_on": "RECENT", "destination": {"branch": {"name": "master"}},
+				"participants": [{"role": "REVIEWER", "approved": true}, {"role": "PARTICIPANT", "approved": true}]},
+			{"id": 3, "state": "OPEN", "updated_on": "RECENT", "destination": {"branch": {"name": "master"}},
+				"participants": [{"role": "REVIEWER", "approved": true}]},
+			{"id": 4, "state": "OPEN", "updated_on": "RECENT", "task_count": 1, "destination": {"branch": {"name": "release/1.0"}}},
+			{"id": 5, "state": "OPEN", "updated_on": "RECENT", "destination": {"branch": {"name": "feature"}}},
+			{"id": 6, "state": "MERGED", "updated_on": "RECENT", "destination": {"branch": {"name": "master"}}}
+		]}`, "RECENT", recent, -1),
+		"/repositories/acme/api/pullrequests/1/statuses": `{"values": [{"state": "SUCCESSFUL"}]}`,
+		"/repositories/acme/api/pullrequests/2/statuses": `{"values": [{"state": "SUCCESSFUL"}, {"state": "INPROGRESS"}]}`,
+		"/repositories/acme/api/pullrequests/3/statuses": `{"values": [{"state": "SUCCESSFUL"}]}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.GatherMergeChecks = true
+	require.NoError(t, b.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	mergeable := make(map[int64]interface{})
+	checks := make(map[string]map[string]interface{})
+	for _, m := range acc.Metrics {
+		switch m.Measurement {
+		case "bitbucket_pull_request":
+			mergeable[m.Fields["id"].(int64)] = m.Fields["mergeable"]
+		case "bitbucket_merge_checks":
+			checks[m.Tags["branch_pattern"]] = m.Fields
+		}
+	}
+
+	require.Equal(t, map[int64]interface{}{
+		1: true,
+		2: false, // a build is still running
+		3: false, // a single approval
+		4: false, // an open task
+		5: true,
+		6: nil,
+	}, mergeable)
+	require.Equal(t, map[string]map[string]interface{}{
+		"master": {
+			"min_approvals":                2,
+			"min_successful_builds":        1,
+			"require_tasks_completed":      false,
+			"require_no_changes_requested": false,
+		},
+		"release/*": {
+			"min_approvals":                0,
+			"min_successful_builds":        0,
+			"require_tasks_completed":      true,
+			"require_no_changes_requested": false,
+		},
+	}, checks)
+}
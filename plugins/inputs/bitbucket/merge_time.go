@@ -0,0 +1,83 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+// maxMergeTimes bounds the merge times kept, all are forgotten once it is
+// reached and fetched again as needed.
+const maxMergeTimes = 10000
+
+// mergeTimes keeps the time of the merge commits of the pull requests of a
+// workspace, which never changes.
+type mergeTimes struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+func newMergeTimes() *mergeTimes {
+	return &mergeTimes{times: make(map[string]time.Time)}
+}
+
+func (m *mergeTimes) get(key string) (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.times[key]
+	return t, ok
+}
+
+func (m *mergeTimes) set(key string, t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.times) >= maxMergeTimes {
+		m.times = make(map[string]time.Time)
+	}
+	m.times[key] = t
+}
+
+// getMergeTime returns the date of the merge commit of a pull request.  The
+// last update of a merged pull request moves with later comments, the merge
+// commit does not.
+func (w *workspace) getMergeTime(ctx context.Context, repo repository, pr pullRequest) (time.Time, error) {
+	var c commit
+	params := url.Values{"fields": {"date"}}
+	err := w.client.Get(ctx, bitbucketapi.CommitPath(w.Workspace, repo.Slug, pr.MergeCommit.Hash), params, &c)
+	return c.Date, err
+}
+
+// addMergeTimes attaches the time of the merge to the merged pull requests.
+// Pull requests with a known merge time cost no requests.
+func (w *workspace) addMergeTimes(ctx context.Context, acc telegraf.Accumulator, repo repository, prs []pullRequest) {
+	var wg sync.WaitGroup
+	for i := range prs {
+		if prs[i].State != "MERGED" || prs[i].MergeCommit.Hash == "" {
+			continue
+		}
+		key := repo.Slug + "/" + prs[i].MergeCommit.Hash
+		if t, ok := w.mergeTimes.get(key); ok {
+			prs[i].mergedOn = t
+			continue
+		}
+		wg.Add(1)
+		go func(pr *pullRequest) {
+			defer wg.Done()
+			t, err := w.getMergeTime(ctx, repo, *pr)
+			if err != nil {
+				acc.AddError(fmt.Errorf("getting the merge commit of pull request %d of %s failed: %v", pr.ID, repo.Slug, err))
+				return
+			}
+			if !t.IsZero() {
+				pr.mergedOn = t
+				w.mergeTimes.set(key, t)
+			}
+		}(&prs[i])
+	}
+	wg.Wait()
+}
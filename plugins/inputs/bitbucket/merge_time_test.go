@@ -0,0 +1,50 @@
+package bitbucket
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherMergeTimes(t *testing.T) {
+	merged := time.Now().Add(-2 * time.Hour).Truncate(time.Second).UTC()
+	commented := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": `{"values": [
+			{"id": 1, "state": "MERGED", "created_on": "` + commented + `", "updated_on": "` + commented + `",
+				"merge_commit": {"hash": "abc"}}
+		]}`,
+		"/repositories/acme/api/commit/abc": `{"date": "` + merged.Format(time.RFC3339) + `"}`,
+	})
+	defer ts.Close()
+
+	var requests []*url.URL
+	ts.Config.Handler = recordRequests(ts.Config.Handler, &requests)
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+
+	// The merge time is taken from the merge commit, which is only
+	// requested once.
+	for i := 0; i < 2; i++ {
+		var acc testutil.Accumulator
+		require.NoError(t, acc.GatherError(b.Gather))
+		require.Empty(t, acc.Errors)
+		pr, ok := acc.Get("bitbucket_pull_request")
+		require.True(t, ok)
+		require.Equal(t, merged.Unix(), pr.Fields["merged_on"])
+	}
+	var commits int
+	for _, u := range requests {
+		if strings.HasSuffix(u.Path, "/commit/abc") {
+			commits++
+		}
+	}
+	require.Equal(t, 1, commits)
+}
@@ -0,0 +1,98 @@
+package bitbucket
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddOverdueReviews(t *testing.T) {
+	now := time.Date(2020, 2, 11, 16, 0, 0, 0, time.UTC)
+	w := &workspace{
+		WorkspaceConfig: WorkspaceConfig{
+			Workspace:      "acme",
+			OverdueReviews: internal.Duration{Duration: 24 * time.Hour},
+		},
+		userField:    "display_name",
+		durationUnit: "h",
+		teams:        map[string]string{"557058:1": "platform"},
+	}
+	jane := prUser{DisplayName: "Jane Doe", AccountID: "557058:1", UUID: "{1}"}
+	john := prUser{DisplayName: "John Doe", AccountID: "557058:2", UUID: "{2}"}
+	erika := prUser{DisplayName: "Erika Mustermann", AccountID: "557058:3", UUID: "{3}"}
+	prs := []pullRequest{
+		{ID: 1, Title: "Add API", State: "OPEN", CreatedOn: now.Add(-48 * time.Hour), Participants: []participant{
+			{Role: "REVIEWER", User: jane},
+			{Role: "REVIEWER", User: john, Approved: true},
+			{Role: "REVIEWER", User: erika, State: "changes_requested"},
+			{Role: "PARTICIPANT", User: prUser{DisplayName: "Max"}},
+		}},
+		{ID: 2, Title: "Fix typo", State: "OPEN", CreatedOn: now.Add(-time.Hour), Participants: []participant{
+			{Role: "REVIEWER", User: jane},
+		}},
+		{ID: 3, Title: "Old", State: "MERGED", CreatedOn: now.Add(-72 * time.Hour), Participants: []participant{
+			{Role: "REVIEWER", User: jane},
+		}},
+	}
+
+	var acc testutil.Accumulator
+	w.addOverdueReviews(&acc, repository{Slug: "api"}, prs, now)
+	acc.AssertContainsTaggedFields(t, measurementOverdueReview,
+		map[string]interface{}{
+			"id":                  int64(1),
+			"title":               "Add API",
+			"waiting":             48.0,
+			"reviewer_account_id": "557058:1",
+			"reviewer_uuid":       "{1}",
+		},
+		map[string]string{"workspace": "acme", "repository": "api", "reviewer": "Jane Doe", "team": "platform"})
+	require.Len(t, acc.Metrics, 1)
+}
+
+func TestGatherOverdueReviewsBeyondLookback(t *testing.T) {
+	old := time.Now().Add(-30 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+	})
+	defer ts.Close()
+
+	// The pull request was not updated within the lookback window, it is
+	// only listed by the query for overdue reviews.
+	handler := ts.Config.Handler
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repositories/acme/api/pullrequests" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		query := r.URL.Query()
+		switch {
+		case query.Get("fields") == "size":
+			fmt.Fprint(w, `{"size": 1}`)
+		case strings.HasPrefix(query.Get("q"), "created_on < "):
+			require.Equal(t, []string{"OPEN"}, query["state"])
+			fmt.Fprint(w, `{"values": [{"id": 1, "title": "Add API", "state": "OPEN", "created_on": "`+old+`", "updated_on": "`+old+`",
+				"participants": [{"role": "REVIEWER", "user": {"display_name": "Jane Doe"}}]}]}`)
+		default:
+			fmt.Fprint(w, `{"values": []}`)
+		}
+	})
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.OverdueReviews.Duration = 24 * time.Hour
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	require.Empty(t, acc.Errors)
+	require.False(t, acc.HasMeasurement("bitbucket_pull_request"))
+	require.True(t, acc.HasPoint(measurementOverdueReview,
+		map[string]string{"workspace": "acme", "repository": "api", "reviewer": "Jane Doe"},
+		"id", int64(1)))
+}
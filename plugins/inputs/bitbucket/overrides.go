@@ -0,0 +1,106 @@
+package bitbucket
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal"
+)
+
+// RepoOverride overrides options of the workspaces for the repositories
+// matching one of its slugs or globs.  Options not set keep the value of
+// the workspace.
+type RepoOverride struct {
+	Repositories []string `toml:"repositories"`
+
+	PullRequestStates   []string          `toml:"pull_request_states"`
+	PullRequestLookback internal.Duration `toml:"pull_request_lookback"`
+	Query               string            `toml:"query"`
+	ParticipantRoles    []string          `toml:"participant_roles"`
+	RequireReviewers    *bool             `toml:"require_reviewers"`
+
+	OverdueReviews internal.Duration `toml:"overdue_reviews"`
+
+	GatherDiffstat      *bool `toml:"gather_diffstat"`
+	GatherCIState       *bool `toml:"gather_ci_state"`
+	GatherMergeChecks   *bool `toml:"gather_merge_checks"`
+	GatherFirstResponse *bool `toml:"gather_first_response"`
+}
+
+// apply sets the options of the override in c.
+func (o *RepoOverride) apply(c *WorkspaceConfig) {
+	if len(o.PullRequestStates) > 0 {
+		c.PullRequestStates = o.PullRequestStates
+	}
+	if o.PullRequestLookback.Duration != 0 {
+		c.PullRequestLookback = o.PullRequestLookback
+	}
+	if o.Query != "" {
+		c.Query = o.Query
+	}
+	if len(o.ParticipantRoles) > 0 {
+		c.ParticipantRoles = o.ParticipantRoles
+	}
+	if o.RequireReviewers != nil {
+		c.RequireReviewers = *o.RequireReviewers
+	}
+	if o.OverdueReviews.Duration != 0 {
+		c.OverdueReviews = o.OverdueReviews
+	}
+	if o.GatherDiffstat != nil {
+		c.GatherDiffstat = *o.GatherDiffstat
+	}
+	if o.GatherCIState != nil {
+		c.GatherCIState = *o.GatherCIState
+	}
+	if o.GatherMergeChecks != nil {
+		c.GatherMergeChecks = *o.GatherMergeChecks
+	}
+	if o.GatherFirstResponse != nil {
+		c.GatherFirstResponse = *o.GatherFirstResponse
+	}
+}
+
+// repoOverride is a repo_override block with its compiled repositories.
+type repoOverride struct {
+	*RepoOverride
+	repositories filter.Filter
+}
+
+func compileRepoOverrides(overrides []*RepoOverride) ([]repoOverride, error) {
+	compiled := make([]repoOverride, 0, len(overrides))
+	for i, o := range overrides {
+		if len(o.Repositories) == 0 {
+			return nil, errors.New("repo_override requires repositories")
+		}
+		f, err := filter.Compile(o.Repositories)
+		if err != nil {
+			return nil, fmt.Errorf("compiling repositories of repo_override %d failed: %v", i+1, err)
+		}
+		compiled = append(compiled, repoOverride{RepoOverride: o, repositories: f})
+	}
+	return compiled, nil
+}
+
+// forRepository returns the workspace with the options of the repo_override
+// blocks matching the repository applied, in their order, or the workspace
+// itself when none match.  The copy shares the client and the state of the
+// workspace.
+func (w *workspace) forRepository(repo repository) *workspace {
+	var rw *workspace
+	for _, o := range w.overrides {
+		if !o.repositories.Match(repo.Slug) {
+			continue
+		}
+		if rw == nil {
+			c := *w
+			rw = &c
+		}
+		o.apply(&rw.WorkspaceConfig)
+	}
+	if rw == nil {
+		return w
+	}
+	return rw
+}
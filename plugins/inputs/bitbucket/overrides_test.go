@@ -0,0 +1,96 @@
+package bitbucket
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForRepository(t *testing.T) {
+	yes := true
+	overrides, err := compileRepoOverrides([]*RepoOverride{
+		{Repositories: []string{"payments*"}, OverdueReviews: internal.Duration{Duration: 4 * time.Hour}, GatherCIState: &yes},
+		{Repositories: []string{"payments-legacy"}, OverdueReviews: internal.Duration{Duration: 48 * time.Hour}},
+	})
+	require.NoError(t, err)
+	w := &workspace{
+		WorkspaceConfig: WorkspaceConfig{
+			Workspace:      "acme",
+			Query:          `title ~ "fix"`,
+			OverdueReviews: internal.Duration{Duration: 24 * time.Hour},
+		},
+		overrides: overrides,
+	}
+
+	require.True(t, w.forRepository(repository{Slug: "api"}) == w)
+
+	payments := w.forRepository(repository{Slug: "payments"})
+	require.Equal(t, 4*time.Hour, payments.OverdueReviews.Duration)
+	require.True(t, payments.GatherCIState)
+	require.Equal(t, `title ~ "fix"`, payments.Query)
+
+	legacy := w.forRepository(repository{Slug: "payments-legacy"})
+	require.Equal(t, 48*time.Hour, legacy.OverdueReviews.Duration)
+	require.True(t, legacy.GatherCIState)
+
+	// The workspace itself is left alone.
+	require.Equal(t, 24*time.Hour, w.OverdueReviews.Duration)
+	require.False(t, w.GatherCIState)
+}
+
+func TestInitRepoOverrideRequiresRepositories(t *testing.T) {
+	b := newBitbucket()
+	b.Workspace = "acme"
+	b.RepoOverrides = []*RepoOverride{{Query: `state = "OPEN"`}}
+	require.Error(t, b.Init())
+}
+
+func TestGatherRepoOverride(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	pullRequests := strings.Replace(`{"values": [
+		{"id": 1, "state": "OPEN", "created_on": "2020-02-10T08:00:00Z", "updated_on": "RECENT"}
+	]}`, "RECENT", recent, -1)
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api":                              `{"slug": "api"}`,
+		"/repositories/acme/payments":                         `{"slug": "payments"}`,
+		"/repositories/acme/api/pullrequests":                 pullRequests,
+		"/repositories/acme/payments/pullrequests":            pullRequests,
+		"/repositories/acme/payments/pullrequests/1/activity": `{"values": []}`,
+	})
+	defer ts.Close()
+	var requests []*url.URL
+	ts.Config.Handler = recordRequests(ts.Config.Handler, &requests)
+
+	yes := true
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api", "payments"}
+	b.GatherPullRequests = true
+	b.RepoOverrides = []*RepoOverride{{
+		Repositories:        []string{"pay*"},
+		Query:               `title ~ "payment"`,
+		GatherFirstResponse: &yes,
+	}}
+	require.NoError(t, b.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	queries := make(map[string]string)
+	var activity []string
+	for _, u := range requests {
+		switch {
+		case listsPullRequests(u):
+			queries[u.Path] = u.Query().Get("q")
+		case strings.HasSuffix(u.Path, "/activity"):
+			activity = append(activity, u.Path)
+		}
+	}
+	require.Equal(t, "", queries["/repositories/acme/api/pullrequests"])
+	require.Equal(t, `title ~ "payment"`, queries["/repositories/acme/payments/pullrequests"])
+	require.Equal(t, []string{"/repositories/acme/payments/pullrequests/1/activity"}, activity)
+}
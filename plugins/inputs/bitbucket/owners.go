@@ -0,0 +1,91 @@
+package bitbucket
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// ownershipRule assigns the paths matching a pattern to a team.
+type ownershipRule struct {
+	pattern glob.Glob
+	team    string
+}
+
+// loadOwnership reads a CODEOWNERS-like file.  Each line holds a path pattern
+// followed by the owning team, the first owner being used when several are
+// given and a leading @ being dropped.  Blank lines and lines starting with #
+// are ignored.
+func loadOwnership(path string) ([]ownershipRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ownershipRule
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("parsing %s failed: line %d has no owner", path, n)
+		}
+		pattern, err := compileOwnershipPattern(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s failed: line %d: %v", path, n, err)
+		}
+		rules = append(rules, ownershipRule{
+			pattern: pattern,
+			team:    strings.TrimPrefix(fields[1], "@"),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// compileOwnershipPattern follows the CODEOWNERS rules: a pattern is
+// anchored at the repository root when it starts with or contains a slash,
+// matches at any depth otherwise, and covers everything below a matching
+// directory.
+func compileOwnershipPattern(pattern string) (glob.Glob, error) {
+	p := strings.TrimSuffix(pattern, "/")
+	alternatives := []string{p}
+	if strings.Contains(p, "/") {
+		alternatives[0] = strings.TrimPrefix(p, "/")
+	} else {
+		alternatives = append(alternatives, "**/"+p)
+	}
+	for _, a := range alternatives {
+		alternatives = append(alternatives, a+"/**")
+	}
+	return glob.Compile("{"+strings.Join(alternatives, ",")+"}", '/')
+}
+
+// owningTeam returns the team owning the most changed lines among the files
+// of a diffstat, preferring the first by name on ties.  As with CODEOWNERS
+// the last matching rule of the ownership file decides the owner of a file.
+func (w *workspace) owningTeam(entries []diffstatEntry) (string, bool) {
+	lines := make(map[string]int)
+	for _, entry := range entries {
+		paths := entry.paths()
+		if len(paths) == 0 {
+			continue
+		}
+		for i := len(w.ownership) - 1; i >= 0; i-- {
+			if w.ownership[i].pattern.Match(paths[0]) {
+				lines[w.ownership[i].team] += entry.LinesAdded + entry.LinesRemoved
+				break
+			}
+		}
+	}
+	return mostLines(lines)
+}
@@ -0,0 +1,65 @@
+package bitbucket
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnershipFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "owners")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`# Default owners
+*              platform
+*.js           frontend
+/services/     @services
+services/payments/ payments finance
+`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	b := newTestBitbucket(t, "")
+	b.OwnershipFile = f.Name()
+	require.NoError(t, b.Init())
+	w := &workspace{ownership: b.ownership}
+
+	owner := func(path string, lines int) diffstatEntry {
+		return diffstatEntry{New: &diffstatFile{Path: path}, LinesAdded: lines}
+	}
+	for path, expected := range map[string]string{
+		"README.md":                     "platform",
+		"web/app/index.js":              "frontend",
+		"services/auth/api.go":          "services",
+		"services/payments/api.go":      "payments",
+		"services/payments/web/pay.js":  "payments",
+		"lib/services/payments/util.go": "platform",
+	} {
+		team, ok := w.owningTeam([]diffstatEntry{owner(path, 1)})
+		require.True(t, ok, path)
+		require.Equal(t, expected, team, path)
+	}
+
+	team, ok := w.owningTeam([]diffstatEntry{
+		owner("README.md", 4),
+		owner("services/payments/api.go", 3),
+		owner("services/payments/db.go", 2),
+	})
+	require.True(t, ok)
+	require.Equal(t, "payments", team)
+}
+
+func TestOwnershipFileInvalid(t *testing.T) {
+	f, err := ioutil.TempFile("", "owners")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("/docs/\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	b := newTestBitbucket(t, "")
+	b.OwnershipFile = f.Name()
+	require.Error(t, b.Init())
+}
@@ -0,0 +1,120 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+type userPermission struct {
+	Permission string `json:"permission"`
+	User       struct {
+		DisplayName string `json:"display_name"`
+		AccountID   string `json:"account_id"`
+	} `json:"user"`
+}
+
+type groupPermission struct {
+	Permission string `json:"permission"`
+	Group      struct {
+		Slug string `json:"slug"`
+		Name string `json:"name"`
+	} `json:"group"`
+}
+
+// gatherPermissions reports the explicit user and group permissions of a
+// repository, counted per permission level, along with every admin grant.
+func (w *workspace) gatherPermissions(ctx context.Context, acc telegraf.Accumulator, repo repository) error {
+	var users []userPermission
+	err := w.client.GetPages(ctx, w.repositoryPath(repo.Slug)+"/permissions-config/users", url.Values{"pagelen": {"100"}},
+		func(values json.RawMessage) error {
+			var p []userPermission
+			if err := json.Unmarshal(values, &p); err != nil {
+				return err
+			}
+			users = append(users, p...)
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("gathering user permissions of %s failed: %v", repo.Slug, err)
+	}
+
+	var groups []groupPermission
+	err = w.client.GetPages(ctx, w.repositoryPath(repo.Slug)+"/permissions-config/groups", url.Values{"pagelen": {"100"}},
+		func(values json.RawMessage) error {
+			var p []groupPermission
+			if err := json.Unmarshal(values, &p); err != nil {
+				return err
+			}
+			groups = append(groups, p...)
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("gathering group permissions of %s failed: %v", repo.Slug, err)
+	}
+
+	now := time.Now()
+
+	userLevels := make([]string, 0, len(users))
+	for _, u := range users {
+		userLevels = append(userLevels, u.Permission)
+		if u.Permission == "admin" {
+			tags := w.repositoryTags(repo)
+			tags["principal_type"] = "user"
+			tags["principal"] = u.User.DisplayName
+			fields := map[string]interface{}{
+				"account_id": u.User.AccountID,
+			}
+			acc.AddFields(measurementAdminGrant, fields, tags, now)
+		}
+	}
+
+	groupLevels := make([]string, 0, len(groups))
+	for _, g := range groups {
+		groupLevels = append(groupLevels, g.Permission)
+		if g.Permission == "admin" {
+			tags := w.repositoryTags(repo)
+			tags["principal_type"] = "group"
+			tags["principal"] = g.Group.Slug
+			fields := map[string]interface{}{
+				"name": g.Group.Name,
+			}
+			acc.AddFields(measurementAdminGrant, fields, tags, now)
+		}
+	}
+
+	tags := w.repositoryTags(repo)
+	tags["principal_type"] = "user"
+	acc.AddFields(measurementPermissions, permissionFields(userLevels), tags, now)
+
+	tags = w.repositoryTags(repo)
+	tags["principal_type"] = "group"
+	acc.AddFields(measurementPermissions, permissionFields(groupLevels), tags, now)
+
+	return nil
+}
+
+// permissionFields counts the grants of each permission level.
+func permissionFields(levels []string) map[string]interface{} {
+	var read, write, admin int
+	for _, level := range levels {
+		switch level {
+		case "read":
+			read++
+		case "write":
+			write++
+		case "admin":
+			admin++
+		}
+	}
+	return map[string]interface{}{
+		"read":  read,
+		"write": write,
+		"admin": admin,
+		"total": len(levels),
+	}
+}
@@ -0,0 +1,95 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+// pipelineFields restricts the pipeline listing to the identifier, state
+// and commit.
+var pipelineFields = strings.Join([]string{
+	"values.uuid",
+	"values.state.name",
+	"values.state.result.name",
+	"values.target.commit.hash",
+}, ",")
+
+type pipeline struct {
+	UUID  string `json:"uuid"`
+	State struct {
+		Name   string `json:"name"`
+		Result struct {
+			Name string `json:"name"`
+		} `json:"result"`
+	} `json:"state"`
+	Target struct {
+		Commit struct {
+			Hash string `json:"hash"`
+		} `json:"commit"`
+	} `json:"target"`
+}
+
+// ciState returns the result of a completed pipeline or the state of a
+// running one, in lower case.
+func (p pipeline) ciState() string {
+	if p.State.Name == "COMPLETED" && p.State.Result.Name != "" {
+		return strings.ToLower(p.State.Result.Name)
+	}
+	return strings.ToLower(p.State.Name)
+}
+
+// getCIPipeline returns the latest pipeline run for the source commit of a
+// pull request, looking at the recent pipelines of its source branch.
+func (w *workspace) getCIPipeline(ctx context.Context, repo repository, pr pullRequest) (pipeline, bool, error) {
+	params := url.Values{
+		"target.branch": {pr.Source.Branch.Name},
+		"sort":          {"-created_on"},
+		"pagelen":       {"10"},
+		"fields":        {pipelineFields},
+	}
+	var page struct {
+		Values []pipeline `json:"values"`
+	}
+	if err := w.client.Get(ctx, bitbucketapi.PipelinesPath(w.Workspace, repo.Slug), params, &page); err != nil {
+		return pipeline{}, false, err
+	}
+
+	// The pull request carries an abbreviated hash.
+	for _, p := range page.Values {
+		if pr.Source.Commit.Hash != "" && strings.HasPrefix(p.Target.Commit.Hash, pr.Source.Commit.Hash) {
+			return p, true, nil
+		}
+	}
+	return pipeline{}, false, nil
+}
+
+// addCIStates attaches the pipeline state and identifier to the open pull
+// requests.
+func (w *workspace) addCIStates(ctx context.Context, acc telegraf.Accumulator, repo repository, prs []pullRequest) {
+	var wg sync.WaitGroup
+	for i := range prs {
+		if prs[i].State != "OPEN" || prs[i].Source.Branch.Name == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(pr *pullRequest) {
+			defer wg.Done()
+			p, ok, err := w.getCIPipeline(ctx, repo, *pr)
+			if err != nil {
+				acc.AddError(fmt.Errorf("gathering pipeline state of pull request %d of %s failed: %v", pr.ID, repo.Slug, err))
+				return
+			}
+			if ok {
+				pr.ciState = p.ciState()
+				pr.ciPipeline = p.UUID
+			}
+		}(&prs[i])
+	}
+	wg.Wait()
+}
@@ -0,0 +1,74 @@
+package bitbucket
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherPullRequestsCIState(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	var requests []*url.URL
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(`{
+			"values": [
+				{"id": 3, "state": "OPEN", "updated_on": "RECENT",
+					"source": {"branch": {"name": "feature/a"}, "commit": {"hash": "aaaaaaaaaaaa"}}},
+				{"id": 2, "state": "OPEN", "updated_on": "RECENT",
+					"source": {"branch": {"name": "feature/b"}, "commit": {"hash": "bbbbbbbbbbbb"}}},
+				{"id": 1, "state": "MERGED", "updated_on": "RECENT",
+					"source": {"branch": {"name": "feature/c"}, "commit": {"hash": "cccccccccccc"}}}
+			]
+		}`, "RECENT", recent, -1),
+		"/repositories/acme/api/pipelines/": `{
+			"values": [
+				{"state": {"name": "IN_PROGRESS"}, "target": {"commit": {"hash": "dddddddddddddddddddd"}}},
+				{"uuid": "{p1}", "state": {"name": "COMPLETED", "result": {"name": "SUCCESSFUL"}}, "target": {"commit": {"hash": "aaaaaaaaaaaaaaaaaaaa"}}}
+			]
+		}`,
+	})
+	defer ts.Close()
+	ts.Config.Handler = recordRequests(ts.Config.Handler, &requests)
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.GatherCIState = true
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	states := make(map[int64]interface{})
+	pipelines := make(map[int64]interface{})
+	for _, m := range acc.Metrics {
+		if m.Measurement == "bitbucket_pull_request" {
+			states[m.Fields["id"].(int64)] = m.Fields["ci_state"]
+			pipelines[m.Fields["id"].(int64)] = m.Fields["ci_pipeline_uuid"]
+		}
+	}
+	require.Equal(t, map[int64]interface{}{3: "successful", 2: nil, 1: nil}, states)
+	require.Equal(t, map[int64]interface{}{3: "{p1}", 2: nil, 1: nil}, pipelines)
+
+	var branches []string
+	for _, u := range requests {
+		if u.Path == "/repositories/acme/api/pipelines/" {
+			branches = append(branches, u.Query().Get("target.branch"))
+			require.Equal(t, "-created_on", u.Query().Get("sort"))
+		}
+	}
+	require.ElementsMatch(t, []string{"feature/a", "feature/b"}, branches)
+}
+
+func TestPipelineCIState(t *testing.T) {
+	var p pipeline
+	p.State.Name = "IN_PROGRESS"
+	require.Equal(t, "in_progress", p.ciState())
+	p.State.Name = "COMPLETED"
+	p.State.Result.Name = "FAILED"
+	require.Equal(t, "failed", p.ciState())
+}
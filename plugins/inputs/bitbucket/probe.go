@@ -0,0 +1,107 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+// impliedScopes lists the OAuth scopes which are granted along with a scope
+// without being reported separately.
+var impliedScopes = map[string][]string{
+	"pullrequest": {"repository"},
+}
+
+// requiredScopes returns the OAuth scopes needed by the enabled gathers.
+func (w *workspace) requiredScopes() []string {
+	scopes := []string{"repository"}
+	if w.GatherPipelinesConfig || (w.GatherPullRequests && w.GatherCIState) {
+		scopes = append(scopes, "pipeline")
+	}
+	if w.GatherPullRequests {
+		scopes = append(scopes, "pullrequest")
+	}
+	if w.GatherPermissions || (w.GatherPullRequests && w.GatherMergeChecks) {
+		scopes = append(scopes, "repository:admin")
+	}
+	if w.GatherSSHKeys || w.GatherTwoStep || w.GatherSecurity || w.GatherConsumers {
+		scopes = append(scopes, "account")
+	}
+	if w.GatherWebhooks {
+		scopes = append(scopes, "webhook")
+	}
+	return scopes
+}
+
+// probeScopes reports scope problems of the OAuth consumers once up front
+// rather than as opaque 403s of the individual gathers.  Rejected
+// credentials fail, other problems are only logged.  Reading the workspace
+// needs the account scope, which collecting may not, so a denied probe is
+// only logged as well.
+func (b *Bitbucket) probeScopes(ctx context.Context) error {
+	for _, w := range b.workspaces {
+		if w.authMethod() != authOAuth {
+			continue
+		}
+		missing, err := w.probe(ctx)
+		switch {
+		case bitbucketapi.IsStatus(err, http.StatusUnauthorized):
+			return fmt.Errorf("credentials rejected for workspace %s: %v", w.Workspace, err)
+		case err != nil && len(missing) > 0:
+			b.Log.Warnf("Probing workspace %s failed: %v; the OAuth consumer is missing the scopes %s required by the enabled gathers",
+				w.Workspace, err, strings.Join(missing, ", "))
+		case err != nil:
+			b.Log.Warnf("Probing workspace %s failed: %v", w.Workspace, err)
+		case len(missing) > 0:
+			b.Log.Warnf("OAuth consumer is missing the scopes %s required by the enabled gathers of %s",
+				strings.Join(missing, ", "), w.Workspace)
+		}
+	}
+	return nil
+}
+
+// probe fetches the workspace to verify the credentials and returns the
+// scopes required by the enabled gathers which were not granted to them,
+// also when fetching the workspace was denied.  No scopes are reported
+// missing when the API does not list the granted scopes, as for
+// unauthenticated requests.
+func (w *workspace) probe(ctx context.Context) ([]string, error) {
+	var ws map[string]interface{}
+	header, err := w.client.GetHeader(ctx, w.workspacePath(), nil, &ws)
+	if err != nil && !bitbucketapi.IsStatus(err, http.StatusForbidden) {
+		return nil, err
+	}
+
+	granted := header.Get("X-OAuth-Scopes")
+	if granted == "" {
+		return nil, err
+	}
+	return missingScopes(strings.Split(granted, ","), w.requiredScopes()), err
+}
+
+// missingScopes returns the required scopes not covered by the granted ones.
+// A scope such as "repository:admin" also covers "repository".
+func missingScopes(granted, required []string) []string {
+	covered := make(map[string]bool)
+	for _, scope := range granted {
+		scope = strings.TrimSpace(scope)
+		covered[scope] = true
+		for _, implied := range impliedScopes[scope] {
+			covered[implied] = true
+		}
+		if i := strings.Index(scope, ":"); i > 0 {
+			covered[scope[:i]] = true
+		}
+	}
+
+	var missing []string
+	for _, scope := range required {
+		if !covered[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
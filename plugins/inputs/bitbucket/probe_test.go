@@ -0,0 +1,117 @@
+package bitbucket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeMissingScopes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/workspaces/acme", r.URL.Path)
+		w.Header().Set("X-OAuth-Scopes", "pullrequest, pipeline, account:write")
+		w.Write([]byte(`{"slug": "acme"}`))
+	}))
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.GatherPullRequests = true
+	b.GatherPermissions = true
+	b.GatherTwoStep = true
+	b.GatherWebhooks = true
+	w := &workspace{
+		WorkspaceConfig: b.WorkspaceConfig,
+		client:          bitbucketapi.NewClient(ts.Client(), ts.URL, make(chan struct{}, 1)),
+	}
+
+	missing, err := w.probe(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"repository:admin", "webhook"}, missing)
+}
+
+func TestProbeDenied(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-OAuth-Scopes", "repository")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.GatherPullRequests = true
+	w := &workspace{
+		WorkspaceConfig: b.WorkspaceConfig,
+		client:          bitbucketapi.NewClient(ts.Client(), ts.URL, make(chan struct{}, 1)),
+	}
+
+	missing, err := w.probe(context.Background())
+	require.True(t, bitbucketapi.IsStatus(err, http.StatusForbidden))
+	require.Equal(t, []string{"pullrequest"}, missing)
+}
+
+func TestProbeWorkspaceNotFound(t *testing.T) {
+	ts := newTestServer(t, map[string]string{})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	w := &workspace{
+		WorkspaceConfig: b.WorkspaceConfig,
+		client:          bitbucketapi.NewClient(ts.Client(), ts.URL, make(chan struct{}, 1)),
+	}
+
+	_, err := w.probe(context.Background())
+	require.Error(t, err)
+}
+
+func TestRequiredScopesPipeline(t *testing.T) {
+	w := &workspace{}
+	require.Equal(t, []string{"repository"}, w.requiredScopes())
+
+	w.GatherPipelinesConfig = true
+	require.Equal(t, []string{"repository", "pipeline"}, w.requiredScopes())
+
+	w.GatherPipelinesConfig = false
+	w.GatherPullRequests = true
+	w.GatherCIState = true
+	require.Equal(t, []string{"repository", "pipeline", "pullrequest"}, w.requiredScopes())
+}
+
+func TestStartProbesScopes(t *testing.T) {
+	status := http.StatusOK
+	var probes int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/workspaces/acme", r.URL.Path)
+		probes++
+		w.Header().Set("X-OAuth-Scopes", "repository")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"slug": "acme"}`))
+	}))
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.ClientID = "key"
+	b.ClientSecret = "secret"
+	b.newAuthProvider = func(WorkspaceConfig) (bitbucketapi.AuthProvider, error) {
+		return headerAuth{}, nil
+	}
+
+	// Missing scopes are only logged.
+	b.GatherPullRequests = true
+	require.NoError(t, b.Start(nil))
+	require.Equal(t, 1, probes)
+	b.Stop()
+
+	// A consumer without the account scope cannot read the workspace, but
+	// may still collect.
+	status = http.StatusForbidden
+	require.NoError(t, b.Start(nil))
+	b.Stop()
+
+	status = http.StatusUnauthorized
+	err := b.Start(nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "credentials rejected for workspace acme")
+}
@@ -0,0 +1,654 @@
+package bitbucket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+// pullRequestFields restricts the pull request listing to the attributes
+// which are reported, including the participants which are left out by
+// default.
+var pullRequestFields = strings.Join([]string{
+	"next",
+	"values.id",
+	"values.title",
+	"values.state",
+	"values.created_on",
+	"values.updated_on",
+	"values.comment_count",
+	"values.task_count",
+	"values.source.branch.name",
+	"values.source.commit.hash",
+	"values.destination.branch.name",
+	"values.merge_commit.hash",
+	"values.author.display_name",
+	"values.author.nickname",
+	"values.author.account_id",
+	"values.participants.role",
+	"values.participants.approved",
+	"values.participants.state",
+	"values.participants.participated_on",
+	"values.participants.user.display_name",
+	"values.participants.user.nickname",
+	"values.participants.user.account_id",
+	"values.participants.user.uuid",
+}, ",")
+
+// pullRequestFields returns the fields of the pull request listing, with
+// the descriptions when labels are extracted from them.
+func (w *workspace) pullRequestFields() string {
+	if len(w.labelPatterns) > 0 {
+		return pullRequestFields + ",values.description"
+	}
+	return pullRequestFields
+}
+
+type pullRequest struct {
+	ID           int64      `json:"id"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	State        string     `json:"state"`
+	CreatedOn    time.Time  `json:"created_on"`
+	UpdatedOn    time.Time  `json:"updated_on"`
+	CommentCount int        `json:"comment_count"`
+	TaskCount    int        `json:"task_count"`
+	Source       prEndpoint `json:"source"`
+	Destination  prEndpoint `json:"destination"`
+	MergeCommit  struct {
+		Hash string `json:"hash"`
+	} `json:"merge_commit"`
+	Author       prUser        `json:"author"`
+	Participants []participant `json:"participants"`
+
+	// diffstat holds the changed files, when gathered.
+	diffstat []diffstatEntry
+
+	// ciState and ciPipeline hold the state and identifier of the pipeline
+	// of the source commit, when gathered.
+	ciState    string
+	ciPipeline string
+
+	// mergedOn holds the time of the merge commit of a merged pull
+	// request, when known.
+	mergedOn time.Time
+
+	// mergeable holds whether an open pull request satisfies the merge
+	// checks of its destination branch, when gathered.
+	mergeable *bool
+
+	// firstResponse holds the time of the first comment or approval by
+	// someone other than the author, when gathered and responded to.
+	firstResponse time.Time
+
+	// raw holds the document the pull request was decoded from, with
+	// include_raw_json.
+	raw json.RawMessage
+}
+
+type prEndpoint struct {
+	Branch struct {
+		Name string `json:"name"`
+	} `json:"branch"`
+	Commit struct {
+		Hash string `json:"hash"`
+	} `json:"commit"`
+}
+
+type prUser struct {
+	DisplayName string `json:"display_name"`
+	Nickname    string `json:"nickname"`
+	AccountID   string `json:"account_id"`
+	UUID        string `json:"uuid"`
+}
+
+// userName returns the attribute of the user selected by user_field.
+func (w *workspace) userName(u prUser) string {
+	switch w.userField {
+	case "nickname":
+		return u.Nickname
+	case "account_id":
+		return u.AccountID
+	default:
+		return u.DisplayName
+	}
+}
+
+// isReviewer returns whether the participant has one of the participant
+// roles, only reviewers count when none are set.
+func (w *workspace) isReviewer(p participant) bool {
+	if len(w.ParticipantRoles) == 0 {
+		return p.Role == "REVIEWER"
+	}
+	for _, role := range w.ParticipantRoles {
+		if strings.EqualFold(p.Role, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// awaitsReview returns whether the user of awaiting_review_by is a reviewer
+// of the pull request who neither approved nor requested changes yet.
+func (w *workspace) awaitsReview(pr pullRequest) bool {
+	if pr.State != "OPEN" {
+		return false
+	}
+	for _, p := range pr.Participants {
+		if p.Role == "REVIEWER" && p.User.UUID == w.AwaitingReviewBy {
+			return !p.Approved && p.State != "changes_requested"
+		}
+	}
+	return false
+}
+
+type participant struct {
+	Role           string    `json:"role"`
+	Approved       bool      `json:"approved"`
+	State          string    `json:"state"`
+	ParticipatedOn time.Time `json:"participated_on"`
+	User           prUser    `json:"user"`
+}
+
+// gatherPullRequests reports the pull requests of a repository which were
+// updated within the lookback window.  When pull requests are sorted most
+// recently updated first, paging stops at the first page reaching past the
+// window.
+func (w *workspace) gatherPullRequests(ctx context.Context, acc telegraf.Accumulator, repo repository) error {
+	now := time.Now()
+	cutoff := now.Add(-w.PullRequestLookback.Duration)
+	newestFirst := w.Sort == "-updated_on"
+
+	// Repositories not updated since the last fetch keep their pull
+	// requests and totals, the pull requests are only checked against the
+	// lookback window again.
+	if prs, totals, ok := w.activity.cachedPullRequests(repo.Slug); ok {
+		kept := make([]pullRequest, 0, len(prs))
+		for _, pr := range prs {
+			if w.PullRequestLookback.Duration <= 0 || !pr.UpdatedOn.Before(cutoff) {
+				kept = append(kept, pr)
+			}
+		}
+		w.addPullRequests(acc, repo, w.newlyClosed(repo, kept, cutoff), totals, now)
+		return nil
+	}
+
+	params := url.Values{
+		"pagelen": {"50"},
+		"fields":  {w.pullRequestFields()},
+		"state":   w.PullRequestStates,
+	}
+	if w.Sort != "" {
+		params.Set("sort", w.Sort)
+	}
+	if w.Query != "" {
+		params.Set("q", w.Query)
+	}
+
+	// Only open pull requests can await a review, narrowing the query down
+	// to the reviewer saves fetching the others.
+	if w.AwaitingReviewBy != "" {
+		params["state"] = []string{"OPEN"}
+		q := fmt.Sprintf("reviewers.uuid = %q", w.AwaitingReviewBy)
+		if w.Query != "" {
+			q = "(" + w.Query + ") AND " + q
+		}
+		params.Set("q", q)
+	}
+
+	var prs []pullRequest
+	var pages int
+	var limited bool
+	start := time.Now()
+	err := w.client.GetPages(ctx, bitbucketapi.PullRequestsPath(w.Workspace, repo.Slug), params,
+		func(values json.RawMessage) error {
+			decode := decodePullRequests
+			if w.fastDecode {
+				decode = decodePullRequestsFast
+			}
+			page, err := decode(values, w.includeRawJSON)
+			if err != nil {
+				return err
+			}
+			for _, pr := range page {
+				if w.PullRequestLookback.Duration > 0 && pr.UpdatedOn.Before(cutoff) {
+					if newestFirst {
+						return bitbucketapi.ErrStopPaging
+					}
+					continue
+				}
+				if w.AwaitingReviewBy != "" && !w.awaitsReview(pr) {
+					continue
+				}
+				prs = append(prs, pr)
+				if w.MaxPRsPerRepo > 0 && len(prs) >= w.MaxPRsPerRepo {
+					limited = true
+					return bitbucketapi.ErrStopPaging
+				}
+			}
+			pages++
+			if (w.MaxPages > 0 && pages >= w.MaxPages) ||
+				(w.MaxPullRequestRequests > 0 && requestCount(ctx) >= int64(w.MaxPullRequestRequests)) {
+				limited = true
+				return bitbucketapi.ErrStopPaging
+			}
+			return nil
+		})
+	w.timings.track(phasePullRequestFetch, start)
+	if err != nil {
+		return fmt.Errorf("gathering pull requests of %s failed: %v", repo.Slug, err)
+	}
+
+	// Whether max_prs_per_repo, max_pages or max_pull_request_requests left
+	// out any pull requests is only known by counting them.
+	if limited && w.truncation != nil {
+		var since time.Time
+		if w.PullRequestLookback.Duration > 0 {
+			since = cutoff
+		}
+		total, err := w.countPullRequests(ctx, repo, params, since)
+		if err != nil {
+			acc.AddError(fmt.Errorf("counting pull requests of %s failed: %v", repo.Slug, err))
+		} else if total > len(prs) {
+			w.truncation.add(total - len(prs))
+		}
+	}
+
+	var lastCreated time.Time
+	for _, pr := range prs {
+		if pr.CreatedOn.After(lastCreated) {
+			lastCreated = pr.CreatedOn
+		}
+	}
+
+	// Closed pull requests are left out first so that no requests are spent
+	// on those not emitted again.
+	prs = w.newlyClosed(repo, prs, cutoff)
+	w.addMergeTimes(ctx, acc, repo, prs)
+	if w.GatherDiffstat {
+		prs = w.addDiffstats(ctx, acc, repo, prs)
+	}
+	if w.GatherCIState {
+		w.addCIStates(ctx, acc, repo, prs)
+	}
+	if w.GatherMergeChecks {
+		w.addMergeChecks(ctx, acc, repo, prs)
+	}
+	if w.GatherFirstResponse {
+		w.addFirstResponses(ctx, acc, repo, prs)
+	}
+	totals := w.pullRequestTotals(ctx, acc, repo)
+	if totals.lastCreated.IsZero() {
+		totals.lastCreated = lastCreated
+	}
+	w.activity.record(repo.Slug, prs, totals)
+
+	w.addPullRequests(acc, repo, prs, totals, now)
+	return nil
+}
+
+// pullRequestTotals holds the figures of a repository which are not derived
+// from the gathered pull requests, those being limited by the lookback
+// window, the query and max_prs_per_repo.
+type pullRequestTotals struct {
+	open    int
+	hasOpen bool
+
+	// lastCreated is when the most recently opened of the gathered pull
+	// requests, or with gather_last_activity of any pull request, was
+	// opened, zero when there is none.
+	lastCreated time.Time
+
+	// overdue holds the open pull requests opened longer than
+	// overdue_reviews ago, with overdue_reviews.
+	overdue []pullRequest
+
+	// queues holds the open pull requests of the branches matching
+	// queue_branches, nil when they could not be fetched.
+	queues map[string]branchQueue
+}
+
+// pullRequestTotals fetches the totals of a repository.  Those which cannot
+// be fetched are left out.
+func (w *workspace) pullRequestTotals(ctx context.Context, acc telegraf.Accumulator, repo repository) pullRequestTotals {
+	var totals pullRequestTotals
+	params := url.Values{"state": {"OPEN"}, "fields": {"size"}}
+	var page struct {
+		Size int `json:"size"`
+	}
+	if err := w.client.Get(ctx, bitbucketapi.PullRequestsPath(w.Workspace, repo.Slug), params, &page); err != nil {
+		acc.AddError(fmt.Errorf("counting open pull requests of %s failed: %v", repo.Slug, err))
+	} else {
+		totals.open, totals.hasOpen = page.Size, true
+	}
+
+	if w.GatherLastActivity {
+		params = url.Values{
+			"state":   {"OPEN", "MERGED", "DECLINED", "SUPERSEDED"},
+			"sort":    {"-created_on"},
+			"pagelen": {"1"},
+			"fields":  {"values.created_on"},
+		}
+		var newest struct {
+			Values []pullRequest `json:"values"`
+		}
+		if err := w.client.Get(ctx, bitbucketapi.PullRequestsPath(w.Workspace, repo.Slug), params, &newest); err != nil {
+			acc.AddError(fmt.Errorf("getting the newest pull request of %s failed: %v", repo.Slug, err))
+		} else if len(newest.Values) > 0 {
+			totals.lastCreated = newest.Values[0].CreatedOn
+		}
+	}
+
+	if w.OverdueReviews.Duration > 0 {
+		overdue, err := w.getOverdueCandidates(ctx, repo, time.Now())
+		if err != nil {
+			acc.AddError(fmt.Errorf("listing pull requests of %s with overdue reviews failed: %v", repo.Slug, err))
+		}
+		totals.overdue = overdue
+	}
+
+	if w.queueBranches != nil {
+		queues, err := w.getBranchQueues(ctx, repo)
+		if err != nil {
+			acc.AddError(fmt.Errorf("getting the branch queues of %s failed: %v", repo.Slug, err))
+		}
+		totals.queues = queues
+	}
+	return totals
+}
+
+// getOverdueCandidates lists the open pull requests opened longer than
+// overdue_reviews ago.  Those waiting longest for a review are likely not
+// updated within the lookback window, so they are listed apart from the
+// gathered pull requests, regardless of the window and max_prs_per_repo.
+func (w *workspace) getOverdueCandidates(ctx context.Context, repo repository, now time.Time) ([]pullRequest, error) {
+	q := "created_on < " + now.Add(-w.OverdueReviews.Duration).UTC().Format(time.RFC3339)
+	if w.Query != "" {
+		q = "(" + w.Query + ") AND " + q
+	}
+	params := url.Values{
+		"pagelen": {"50"},
+		"fields":  {pullRequestFields},
+		"state":   {"OPEN"},
+		"q":       {q},
+	}
+
+	var prs []pullRequest
+	err := w.client.GetPages(ctx, bitbucketapi.PullRequestsPath(w.Workspace, repo.Slug), params,
+		func(values json.RawMessage) error {
+			page, err := decodePullRequests(values, false)
+			if err != nil {
+				return err
+			}
+			prs = append(prs, page...)
+			return nil
+		})
+	return prs, err
+}
+
+// newlyClosed leaves out the closed pull requests already emitted, with
+// emit_closed_once.
+func (w *workspace) newlyClosed(repo repository, prs []pullRequest, cutoff time.Time) []pullRequest {
+	if w.state == nil {
+		return prs
+	}
+	var since time.Time
+	if w.PullRequestLookback.Duration > 0 {
+		since = cutoff
+	}
+	return w.state.newlyClosed(w.Workspace+"/"+repo.Slug, prs, since)
+}
+
+// markClosed remembers the closed pull requests as emitted, with
+// emit_closed_once.
+func (w *workspace) markClosed(repo repository, prs []pullRequest) {
+	if w.state != nil {
+		w.state.markClosed(w.Workspace+"/"+repo.Slug, prs)
+	}
+}
+
+// addPullRequests reports the pull requests of a repository along with the
+// metrics derived from them.
+func (w *workspace) addPullRequests(acc telegraf.Accumulator, repo repository, prs []pullRequest, totals pullRequestTotals, now time.Time) {
+	defer w.timings.track(phaseAccumulation, time.Now())
+	for _, pr := range prs {
+		w.addPullRequest(acc, repo, pr, now)
+		if w.reviewLoad != nil {
+			w.reviewLoad.add(w, pr)
+		}
+	}
+	w.markClosed(repo, prs)
+	if totals.queues != nil {
+		w.addBranchQueues(acc, repo, totals.queues, now)
+	}
+	w.addPullRequestCount(acc, repo, prs, totals, now)
+	if len(w.histogramBuckets) > 0 {
+		w.addHistograms(acc, repo, prs, now)
+	}
+	if len(w.reviewLatencyQuantiles) > 0 {
+		w.addReviewLatencySummary(acc, repo, prs, now)
+	}
+	if w.OverdueReviews.Duration > 0 {
+		w.addOverdueReviews(acc, repo, totals.overdue, now)
+	}
+}
+
+// addOverdueReviews reports the reviewers of the open pull requests opened
+// longer than overdue_reviews ago who neither approved nor requested changes
+// yet.  Bitbucket does not tell when a reviewer was added, the review is
+// taken as requested when the pull request was opened.
+func (w *workspace) addOverdueReviews(acc telegraf.Accumulator, repo repository, prs []pullRequest, now time.Time) {
+	for _, pr := range prs {
+		waiting := w.calendar.elapsed(pr.CreatedOn, now)
+		if pr.State != "OPEN" || waiting < w.OverdueReviews.Duration {
+			continue
+		}
+		for _, p := range pr.Participants {
+			if !w.isReviewer(p) || p.Approved || p.State == "changes_requested" {
+				continue
+			}
+			tags := w.repositoryTags(repo)
+			tags["reviewer"] = w.userName(p.User)
+			if team, ok := w.team(p.User); ok {
+				tags["team"] = team
+			}
+			fields := map[string]interface{}{
+				"id":      pr.ID,
+				"title":   pr.Title,
+				"waiting": w.duration(waiting),
+			}
+			if p.User.AccountID != "" {
+				fields["reviewer_account_id"] = p.User.AccountID
+			}
+			if p.User.UUID != "" {
+				fields["reviewer_uuid"] = p.User.UUID
+			}
+			acc.AddFields(measurementOverdueReview, fields, tags, now)
+		}
+	}
+}
+
+// addPullRequestCount reports the number of open pull requests of the
+// repository, also when there are none so that a repository without pull
+// requests can be told apart from one which was not gathered.  The count
+// covers every open pull request, not only the gathered ones.
+func (w *workspace) addPullRequestCount(acc telegraf.Accumulator, repo repository, prs []pullRequest, totals pullRequestTotals, now time.Time) {
+	var mergedWithoutApproval, reviewed, known int
+	for _, pr := range prs {
+		if pr.State == "MERGED" && !approvedBy(pr) {
+			mergedWithoutApproval++
+		}
+		if len(w.teams) > 0 {
+			r, k := w.crossTeamReviewed(pr)
+			if r {
+				reviewed++
+			}
+			if k {
+				known++
+			}
+		}
+	}
+
+	tags := w.repositoryTags(repo)
+	if repo.Project.Key != "" {
+		tags["project"] = repo.Project.Key
+	}
+	fields := map[string]interface{}{
+		"merged_without_approval_count": mergedWithoutApproval,
+	}
+	if totals.hasOpen {
+		fields["open_pr_count"] = totals.open
+	}
+	if !totals.lastCreated.IsZero() {
+		fields["days_since_last_pr"] = days(now.Sub(totals.lastCreated))
+	}
+	if known > 0 {
+		fields["cross_team_review_ratio"] = float64(reviewed) / float64(known)
+	}
+	acc.AddFields(measurementPullRequestCount, fields, tags, now)
+}
+
+func (w *workspace) addPullRequest(acc telegraf.Accumulator, repo repository, pr pullRequest, now time.Time) {
+	var reviewers, approvals, participantApprovals int
+	var approved, changesRequested []string
+	for _, p := range pr.Participants {
+		if !w.isReviewer(p) {
+			if p.Approved {
+				participantApprovals++
+			}
+			continue
+		}
+
+		reviewers++
+		if p.Approved {
+			approvals++
+			approved = append(approved, w.userName(p.User))
+		}
+		if p.State == "changes_requested" {
+			changesRequested = append(changesRequested, w.userName(p.User))
+		}
+	}
+
+	measurement := measurementPullRequest
+	if w.RequireReviewers && reviewers == 0 {
+		if w.UnreviewedMeasurement == "" {
+			return
+		}
+		measurement = w.UnreviewedMeasurement
+	}
+
+	tags := w.repositoryTags(repo)
+	tags["state"] = pr.State
+	tags["author"] = w.userName(pr.Author)
+	tags["destination_branch"] = pr.Destination.Branch.Name
+	if repo.Project.Key != "" {
+		tags["project"] = repo.Project.Key
+	}
+	if team, ok := w.team(pr.Author); ok {
+		tags["team"] = team
+	}
+	if component, ok := w.component(pr.diffstat); ok {
+		tags["component"] = component
+	}
+	if team, ok := w.owningTeam(pr.diffstat); ok {
+		tags["owning_team"] = team
+	}
+	if w.classifyChangeType {
+		if changeType, ok := w.changeType(pr.Title); ok {
+			tags["change_type"] = changeType
+		}
+	}
+	if len(w.labelPatterns) > 0 {
+		if labels := w.labels(pr); len(labels) > 0 {
+			tags["labels"] = strings.Join(labels, ",")
+		}
+	}
+
+	fields := map[string]interface{}{
+		"id":                    pr.ID,
+		"comment_count":         pr.CommentCount,
+		"task_count":            pr.TaskCount,
+		"reviewers":             reviewers,
+		"approvals":             approvals,
+		"approved":              strings.Join(approved, ","),
+		"changes_requested_by":  strings.Join(changesRequested, ","),
+		"participant_approvals": participantApprovals,
+	}
+	if pr.Author.AccountID != "" {
+		fields["author_account_id"] = pr.Author.AccountID
+	}
+	if pr.Author.Nickname != "" {
+		fields["author_nickname"] = pr.Author.Nickname
+	}
+	if pr.diffstat != nil {
+		for k, v := range diffstatFields(pr.diffstat) {
+			fields[k] = v
+		}
+	}
+	if pr.ciState != "" {
+		fields["ci_state"] = pr.ciState
+	}
+	if pr.ciPipeline != "" {
+		fields["ci_pipeline_uuid"] = pr.ciPipeline
+	}
+	if pr.mergeable != nil {
+		fields["mergeable"] = *pr.mergeable
+	}
+	if len(w.teams) > 0 {
+		approvedTeams, pendingTeams := w.teamCoverage(pr)
+		if len(approvedTeams) > 0 {
+			fields["approved_teams"] = strings.Join(approvedTeams, ",")
+		}
+		if len(pendingTeams) > 0 {
+			fields["pending_teams"] = strings.Join(pendingTeams, ",")
+		}
+	}
+	if !pr.firstResponse.IsZero() {
+		fields["seconds_to_first_response"] = int64(w.calendar.elapsed(pr.CreatedOn, pr.firstResponse).Seconds())
+	}
+	if pr.raw != nil {
+		if raw, ok := w.rawJSON(pr.raw); ok {
+			fields["raw_json"] = raw
+		} else {
+			w.Log.Debugf("Leaving out raw JSON of pull request %d of %s of %d bytes", pr.ID, repo.Slug, len(pr.raw))
+		}
+	}
+	switch pr.State {
+	case "OPEN":
+		fields["age"] = w.duration(w.calendar.elapsed(pr.CreatedOn, now))
+	case "MERGED":
+		// The last update moves with comments after the merge.
+		merged := pr.UpdatedOn
+		if !pr.mergedOn.IsZero() {
+			merged = pr.mergedOn
+			fields["merged_on"] = merged.Unix()
+		}
+		fields["time_to_merge"] = w.duration(w.calendar.elapsed(pr.CreatedOn, merged))
+		fields["merged_without_approval"] = !approvedBy(pr)
+		if self, ok := w.selfApproved(pr); ok {
+			fields["self_approved"] = self
+		}
+	}
+
+	acc.AddFields(measurement, fields, tags, now)
+}
+
+// rawJSON returns the compacted document, unless it exceeds
+// raw_json_max_size.  Truncating it would leave invalid JSON.
+func (w *workspace) rawJSON(raw json.RawMessage) (string, bool) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return "", false
+	}
+	if w.rawJSONMaxSize > 0 && buf.Len() > w.rawJSONMaxSize {
+		return "", false
+	}
+	return buf.String(), true
+}
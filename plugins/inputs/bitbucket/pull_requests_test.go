@@ -0,0 +1,500 @@
+package bitbucket
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// listsPullRequests tells the requests listing pull requests apart from
+// those counting them or getting the newest.
+func listsPullRequests(u *url.URL) bool {
+	return strings.HasSuffix(u.Path, "/pullrequests") && strings.Contains(u.Query().Get("fields"), "values.id")
+}
+
+func TestGatherPullRequestsStopsPagingPastLookback(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	old := time.Now().Add(-30 * 24 * time.Hour).UTC().Format(time.RFC3339)
+
+	// The second page is not served, requesting it fails the gather.
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(strings.Replace(`{
+			"values": [
+				{"id": 2, "state": "OPEN", "created_on": "RECENT", "updated_on": "RECENT"},
+				{"id": 1, "state": "MERGED", "created_on": "OLD", "updated_on": "OLD"}
+			],
+			"next": "{{URL}}/repositories/acme/api/pullrequests?page=2"
+		}`, "RECENT", recent, -1), "OLD", old, -1),
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	require.Len(t, acc.Errors, 0)
+	var ids []int64
+	for _, m := range acc.Metrics {
+		if m.Measurement == "bitbucket_pull_request" {
+			ids = append(ids, m.Fields["id"].(int64))
+		}
+	}
+	require.Equal(t, []int64{2}, ids)
+
+	// The newest of the gathered pull requests was opened today.
+	count, ok := acc.Get("bitbucket_repository_pull_requests")
+	require.True(t, ok)
+	require.Equal(t, int64(0), count.Fields["days_since_last_pr"])
+}
+
+func TestGatherPullRequestTotals(t *testing.T) {
+	old := time.Now().Add(-30 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+	})
+	defer ts.Close()
+
+	// None of the pull requests is within the lookback window, the totals
+	// are requested apart from the listing.
+	handler := ts.Config.Handler
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repositories/acme/api/pullrequests" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		query := r.URL.Query()
+		switch {
+		case query.Get("fields") == "size":
+			require.Equal(t, []string{"OPEN"}, query["state"])
+			fmt.Fprint(w, `{"size": 3}`)
+		case query.Get("sort") == "-created_on":
+			require.Equal(t, "1", query.Get("pagelen"))
+			require.Equal(t, []string{"OPEN", "MERGED", "DECLINED", "SUPERSEDED"}, query["state"])
+			fmt.Fprint(w, `{"values": [{"created_on": "`+old+`"}]}`)
+		default:
+			fmt.Fprint(w, `{"values": [{"id": 1, "state": "OPEN", "created_on": "`+old+`", "updated_on": "`+old+`"}]}`)
+		}
+	})
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	// The newest pull request is only requested with gather_last_activity.
+	require.False(t, acc.HasMeasurement("bitbucket_pull_request"))
+	acc.AssertContainsTaggedFields(t, "bitbucket_repository_pull_requests",
+		map[string]interface{}{"open_pr_count": 3, "merged_without_approval_count": 0},
+		map[string]string{"workspace": "acme", "repository": "api"})
+
+	b = newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.GatherLastActivity = true
+	acc = testutil.Accumulator{}
+	require.NoError(t, acc.GatherError(b.Gather))
+	acc.AssertContainsTaggedFields(t, "bitbucket_repository_pull_requests",
+		map[string]interface{}{"open_pr_count": 3, "merged_without_approval_count": 0, "days_since_last_pr": int64(30)},
+		map[string]string{"workspace": "acme", "repository": "api"})
+}
+
+func TestAddPullRequest(t *testing.T) {
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	w := &workspace{WorkspaceConfig: WorkspaceConfig{Workspace: "acme"}}
+
+	pr := pullRequest{
+		ID:           7,
+		State:        "MERGED",
+		CreatedOn:    now.Add(-3 * time.Hour),
+		UpdatedOn:    now,
+		CommentCount: 4,
+		TaskCount:    1,
+		Author:       prUser{DisplayName: "Jane Doe", Nickname: "jdoe", AccountID: "557058:1"},
+		Participants: []participant{
+			{Role: "REVIEWER", Approved: true, User: prUser{DisplayName: "John Doe"}},
+			{Role: "REVIEWER", Approved: false, State: "changes_requested", User: prUser{DisplayName: "Erika Mustermann"}},
+			{Role: "PARTICIPANT", Approved: true, User: prUser{DisplayName: "Max Mustermann"}},
+			{Role: "PARTICIPANT", Approved: false, User: prUser{DisplayName: "Erik Mustermann"}},
+		},
+	}
+	pr.Destination.Branch.Name = "master"
+	// Commented on after the merge.
+	pr.mergedOn = now.Add(-time.Hour)
+
+	repo := repository{Slug: "api"}
+	repo.Project.Key = "CORE"
+
+	var acc testutil.Accumulator
+	w.addPullRequest(&acc, repo, pr, now)
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_pull_request",
+		map[string]interface{}{
+			"id":                      int64(7),
+			"comment_count":           4,
+			"task_count":              1,
+			"reviewers":               2,
+			"approvals":               1,
+			"approved":                "John Doe",
+			"time_to_merge":           int64(7200),
+			"merged_on":               now.Add(-time.Hour).Unix(),
+			"author_account_id":       "557058:1",
+			"author_nickname":         "jdoe",
+			"participant_approvals":   1,
+			"changes_requested_by":    "Erika Mustermann",
+			"self_approved":           false,
+			"merged_without_approval": false,
+		},
+		map[string]string{
+			"workspace":          "acme",
+			"repository":         "api",
+			"state":              "MERGED",
+			"author":             "Jane Doe",
+			"destination_branch": "master",
+			"project":            "CORE",
+		})
+}
+
+func TestGatherPullRequestsSortQueryAndLimit(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	old := time.Now().Add(-30 * 24 * time.Hour).UTC().Format(time.RFC3339)
+
+	var requests []*url.URL
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(strings.Replace(`{
+			"values": [
+				{"id": 3, "state": "OPEN", "created_on": "RECENT", "updated_on": "RECENT"},
+				{"id": 2, "state": "OPEN", "created_on": "OLD", "updated_on": "OLD"}
+			],
+			"size": 4,
+			"next": "{{URL}}/repositories/acme/api/pullrequests?page=2"
+		}`, "RECENT", recent, -1), "OLD", old, -1),
+		"/repositories/acme/api/pullrequests?page=2": strings.Replace(`{
+			"values": [
+				{"id": 1, "state": "OPEN", "created_on": "RECENT", "updated_on": "RECENT"},
+				{"id": 0, "state": "OPEN", "created_on": "RECENT", "updated_on": "RECENT"}
+			]
+		}`, "RECENT", recent, -1),
+	})
+	defer ts.Close()
+	ts.Config.Handler = recordRequests(countTruncated(ts.Config.Handler, 3), &requests)
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.Sort = "-created_on"
+	b.Query = `author.nickname = "jdoe"`
+	b.MaxPRsPerRepo = 2
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	var ids []int64
+	for _, m := range acc.Metrics {
+		if m.Measurement == "bitbucket_pull_request" {
+			ids = append(ids, m.Fields["id"].(int64))
+		}
+	}
+	require.Equal(t, []int64{3, 1}, ids)
+	for _, u := range requests {
+		if u.Path != "/repositories/acme/api/pullrequests" || u.Query().Get("page") != "" {
+			continue
+		}
+		if listsPullRequests(u) {
+			require.Equal(t, `author.nickname = "jdoe"`, u.Query().Get("q"))
+			require.Equal(t, "-created_on", u.Query().Get("sort"))
+			continue
+		}
+		// The count of the truncated pull requests is limited to the
+		// lookback window like the listing.
+		if q := u.Query().Get("q"); q != "" {
+			require.True(t, strings.HasPrefix(q, `(author.nickname = "jdoe") AND updated_on >= `), q)
+			since, err := time.Parse(time.RFC3339, strings.TrimPrefix(q, `(author.nickname = "jdoe") AND updated_on >= `))
+			require.NoError(t, err)
+			require.WithinDuration(t, time.Now().Add(-7*24*time.Hour), since, time.Minute)
+		}
+	}
+
+	// Pull request 0 was left out by the limit, pull request 2 is outside
+	// the lookback window.
+	acc.AssertContainsTaggedFields(t, "bitbucket_pull_request_summary",
+		map[string]interface{}{
+			"reviewers":              0,
+			"reviewer_assignments":   0,
+			"truncated":              true,
+			"truncated_repositories": 1,
+			"skipped_pull_requests":  1,
+		},
+		map[string]string{"workspace": "acme"})
+}
+
+// countTruncated answers the count of the pull requests left out by the
+// limits with size, the count applies the lookback window unlike the test
+// server.
+func countTruncated(handler http.Handler, size int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("fields") == "size" && strings.Contains(query.Get("q"), "updated_on >= ") {
+			fmt.Fprintf(w, `{"size": %d}`, size)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func TestGatherPullRequestsMaxPagesAndRequests(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(`{
+			"values": [
+				{"id": 3, "state": "OPEN", "created_on": "RECENT", "updated_on": "RECENT"}
+			],
+			"next": "{{URL}}/repositories/acme/api/pullrequests?page=2"
+		}`, "RECENT", recent, -1),
+		"/repositories/acme/api/pullrequests?page=2": strings.Replace(`{
+			"values": [
+				{"id": 2, "state": "OPEN", "created_on": "RECENT", "updated_on": "RECENT"},
+				{"id": 1, "state": "OPEN", "created_on": "RECENT", "updated_on": "RECENT"}
+			]
+		}`, "RECENT", recent, -1),
+	})
+	defer ts.Close()
+	ts.Config.Handler = countTruncated(ts.Config.Handler, 3)
+
+	for name, limit := range map[string]func(b *Bitbucket){
+		"max_pages":                 func(b *Bitbucket) { b.MaxPages = 1 },
+		"max_pull_request_requests": func(b *Bitbucket) { b.MaxPullRequestRequests = 1 },
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := newTestBitbucket(t, ts.URL)
+			b.Repositories = []string{"api"}
+			b.GatherPullRequests = true
+			limit(b)
+			var acc testutil.Accumulator
+			require.NoError(t, acc.GatherError(b.Gather))
+			require.Empty(t, acc.Errors)
+
+			// Only the first page was listed.
+			var ids []int64
+			for _, m := range acc.Metrics {
+				if m.Measurement == "bitbucket_pull_request" {
+					ids = append(ids, m.Fields["id"].(int64))
+				}
+			}
+			require.Equal(t, []int64{3}, ids)
+			acc.AssertContainsTaggedFields(t, "bitbucket_pull_request_summary",
+				map[string]interface{}{
+					"reviewers":              0,
+					"reviewer_assignments":   0,
+					"truncated":              true,
+					"truncated_repositories": 1,
+					"skipped_pull_requests":  2,
+				},
+				map[string]string{"workspace": "acme"})
+		})
+	}
+}
+
+func TestAddPullRequestUserField(t *testing.T) {
+	pr := pullRequest{
+		ID:     7,
+		State:  "OPEN",
+		Author: prUser{DisplayName: "Jane Doe", Nickname: "jane", AccountID: "557058:1"},
+		Participants: []participant{
+			{Role: "REVIEWER", Approved: true, User: prUser{DisplayName: "John Doe", Nickname: "john", AccountID: "557058:2"}},
+		},
+	}
+
+	for field, expected := range map[string][2]string{
+		"display_name": {"Jane Doe", "John Doe"},
+		"nickname":     {"jane", "john"},
+		"account_id":   {"557058:1", "557058:2"},
+	} {
+		b := newTestBitbucket(t, "")
+		b.UserField = field
+		require.NoError(t, b.Init())
+		w := &workspace{WorkspaceConfig: b.WorkspaceConfig, userField: b.UserField}
+
+		var acc testutil.Accumulator
+		w.addPullRequest(&acc, repository{Slug: "api"}, pr, time.Now())
+		require.Equal(t, expected[0], acc.Metrics[0].Tags["author"], field)
+		require.Equal(t, expected[1], acc.Metrics[0].Fields["approved"], field)
+	}
+}
+
+func TestAddPullRequestParticipantRoles(t *testing.T) {
+	w := &workspace{WorkspaceConfig: WorkspaceConfig{
+		Workspace:        "acme",
+		ParticipantRoles: []string{"REVIEWER", "PARTICIPANT"},
+	}}
+	pr := pullRequest{
+		ID:    7,
+		State: "OPEN",
+		Participants: []participant{
+			{Role: "REVIEWER", Approved: true, User: prUser{DisplayName: "John Doe"}},
+			{Role: "PARTICIPANT", Approved: true, User: prUser{DisplayName: "Max Mustermann"}},
+			{Role: "PARTICIPANT", State: "changes_requested", User: prUser{DisplayName: "Erika Mustermann"}},
+		},
+	}
+
+	var acc testutil.Accumulator
+	w.addPullRequest(&acc, repository{Slug: "api"}, pr, time.Now())
+
+	fields := acc.Metrics[0].Fields
+	require.Equal(t, 3, fields["reviewers"])
+	require.Equal(t, 2, fields["approvals"])
+	require.Equal(t, "John Doe,Max Mustermann", fields["approved"])
+	require.Equal(t, "Erika Mustermann", fields["changes_requested_by"])
+	require.Equal(t, 0, fields["participant_approvals"])
+}
+
+func TestAddPullRequestDurationUnit(t *testing.T) {
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	pr := pullRequest{ID: 7, State: "OPEN", CreatedOn: now.Add(-90 * time.Minute)}
+
+	for unit, expected := range map[string]interface{}{
+		"s": int64(5400),
+		"m": 90.0,
+		"h": 1.5,
+	} {
+		w := &workspace{WorkspaceConfig: WorkspaceConfig{Workspace: "acme"}, durationUnit: unit}
+		var acc testutil.Accumulator
+		w.addPullRequest(&acc, repository{Slug: "api"}, pr, now)
+		require.Equal(t, expected, acc.Metrics[0].Fields["age"], unit)
+	}
+}
+
+func TestAddPullRequestRequireReviewers(t *testing.T) {
+	w := &workspace{WorkspaceConfig: WorkspaceConfig{Workspace: "acme", RequireReviewers: true}}
+	unreviewed := pullRequest{ID: 1, State: "OPEN"}
+	reviewed := pullRequest{ID: 2, State: "OPEN", Participants: []participant{{Role: "REVIEWER"}}}
+
+	var acc testutil.Accumulator
+	w.addPullRequest(&acc, repository{Slug: "api"}, unreviewed, time.Now())
+	w.addPullRequest(&acc, repository{Slug: "api"}, reviewed, time.Now())
+	require.Len(t, acc.Metrics, 1)
+	require.Equal(t, int64(2), acc.Metrics[0].Fields["id"])
+
+	w.UnreviewedMeasurement = "bitbucket_unreviewed_pull_request"
+	acc.ClearMetrics()
+	w.addPullRequest(&acc, repository{Slug: "api"}, unreviewed, time.Now())
+	require.True(t, acc.HasMeasurement("bitbucket_unreviewed_pull_request"))
+	require.False(t, acc.HasMeasurement("bitbucket_pull_request"))
+}
+
+func TestGatherPullRequestsAwaitingReview(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	var requests []*url.URL
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(`{
+			"values": [
+				{"id": 3, "state": "OPEN", "updated_on": "RECENT", "participants": [
+					{"role": "REVIEWER", "approved": false, "user": {"uuid": "{me}"}}
+				]},
+				{"id": 2, "state": "OPEN", "updated_on": "RECENT", "participants": [
+					{"role": "REVIEWER", "approved": true, "user": {"uuid": "{me}"}}
+				]},
+				{"id": 1, "state": "OPEN", "updated_on": "RECENT", "participants": [
+					{"role": "REVIEWER", "approved": false, "state": "changes_requested", "user": {"uuid": "{me}"}},
+					{"role": "REVIEWER", "approved": false, "user": {"uuid": "{other}"}}
+				]}
+			]
+		}`, "RECENT", recent, -1),
+	})
+	defer ts.Close()
+	ts.Config.Handler = recordRequests(ts.Config.Handler, &requests)
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.Query = `author.nickname = "jdoe"`
+	b.AwaitingReviewBy = "{me}"
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	var ids []int64
+	for _, m := range acc.Metrics {
+		if m.Measurement == "bitbucket_pull_request" {
+			ids = append(ids, m.Fields["id"].(int64))
+		}
+	}
+	require.Equal(t, []int64{3}, ids)
+	for _, u := range requests {
+		if listsPullRequests(u) {
+			require.Equal(t, []string{"OPEN"}, u.Query()["state"])
+			require.Equal(t, `(author.nickname = "jdoe") AND reviewers.uuid = "{me}"`, u.Query().Get("q"))
+		}
+	}
+}
+
+func TestGatherPullRequestsRawJSON(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(`{
+			"values": [
+				{"id": 2, "state": "OPEN", "updated_on": "RECENT"},
+				{"id": 1, "state": "OPEN", "updated_on": "RECENT", "title": "A title too long to be attached"}
+			]
+		}`, "RECENT", recent, -1),
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.IncludeRawJSON = true
+	b.RawJSONMaxSize = 80
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	raw := make(map[int64]interface{})
+	for _, m := range acc.Metrics {
+		if m.Measurement == "bitbucket_pull_request" {
+			raw[m.Fields["id"].(int64)] = m.Fields["raw_json"]
+		}
+	}
+	require.Equal(t, map[int64]interface{}{
+		2: `{"id":2,"state":"OPEN","updated_on":"` + recent + `"}`,
+		1: nil,
+	}, raw)
+}
+
+func TestAddPullRequestCount(t *testing.T) {
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	w := &workspace{WorkspaceConfig: WorkspaceConfig{Workspace: "acme"}}
+	repo := repository{Slug: "api"}
+
+	var acc testutil.Accumulator
+	w.addPullRequestCount(&acc, repo, []pullRequest{
+		{State: "OPEN", CreatedOn: now.Add(-72 * time.Hour)},
+		{State: "MERGED", CreatedOn: now.Add(-50 * time.Hour)},
+		{State: "OPEN", CreatedOn: now.Add(-100 * time.Hour)},
+		{State: "MERGED", CreatedOn: now.Add(-60 * time.Hour), Participants: []participant{{Approved: true}}},
+	}, pullRequestTotals{open: 5, hasOpen: true, lastCreated: now.Add(-50 * time.Hour)}, now)
+	w.addPullRequestCount(&acc, repository{Slug: "web"}, nil, pullRequestTotals{hasOpen: true}, now)
+	w.addPullRequestCount(&acc, repository{Slug: "docs"}, nil, pullRequestTotals{}, now)
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_repository_pull_requests",
+		map[string]interface{}{"open_pr_count": 5, "merged_without_approval_count": 1, "days_since_last_pr": int64(2)},
+		map[string]string{"workspace": "acme", "repository": "api"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_repository_pull_requests",
+		map[string]interface{}{"open_pr_count": 0, "merged_without_approval_count": 0},
+		map[string]string{"workspace": "acme", "repository": "web"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_repository_pull_requests",
+		map[string]interface{}{"merged_without_approval_count": 0},
+		map[string]string{"workspace": "acme", "repository": "docs"})
+}
@@ -0,0 +1,115 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+// branchQueue holds the open pull requests targeting a branch.
+type branchQueue struct {
+	open   int
+	oldest time.Time
+}
+
+// getBranchQueues fetches the queues of open pull requests of the branches
+// matching queue_branches, regardless of the lookback window and
+// max_prs_per_repo.  Branches given without wildcards are queried one by
+// one, fetching the count and the oldest pull request only, and are
+// reported even without open pull requests.  Wildcards require listing the
+// open pull requests, with nothing but their destination and creation.
+func (w *workspace) getBranchQueues(ctx context.Context, repo repository) (map[string]branchQueue, error) {
+	queues := make(map[string]branchQueue)
+	var wildcards bool
+	for _, branch := range w.QueueBranches {
+		if strings.ContainsAny(branch, "*?[") {
+			wildcards = true
+			continue
+		}
+		queues[branch] = branchQueue{}
+	}
+
+	path := bitbucketapi.PullRequestsPath(w.Workspace, repo.Slug)
+	if !wildcards {
+		for branch := range queues {
+			params := url.Values{
+				"state":   {"OPEN"},
+				"q":       {fmt.Sprintf("destination.branch.name = %q", branch)},
+				"sort":    {"created_on"},
+				"pagelen": {"1"},
+				"fields":  {"size,values.created_on"},
+			}
+			var page struct {
+				Size   int           `json:"size"`
+				Values []pullRequest `json:"values"`
+			}
+			if err := w.client.Get(ctx, path, params, &page); err != nil {
+				return nil, err
+			}
+			q := branchQueue{open: page.Size}
+			if len(page.Values) > 0 {
+				q.oldest = page.Values[0].CreatedOn
+			}
+			queues[branch] = q
+		}
+		return queues, nil
+	}
+
+	params := url.Values{
+		"state":   {"OPEN"},
+		"pagelen": {"50"},
+		"fields":  {"next,values.created_on,values.destination.branch.name"},
+	}
+	err := w.client.GetPages(ctx, path, params, func(values json.RawMessage) error {
+		var page []pullRequest
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		for _, pr := range page {
+			branch := pr.Destination.Branch.Name
+			if !w.queueBranches.Match(branch) {
+				continue
+			}
+			q := queues[branch]
+			q.open++
+			if q.oldest.IsZero() || pr.CreatedOn.Before(q.oldest) {
+				q.oldest = pr.CreatedOn
+			}
+			queues[branch] = q
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return queues, nil
+}
+
+// addBranchQueues reports the open pull requests waiting to be merged into
+// the branches matching queue_branches.
+func (w *workspace) addBranchQueues(acc telegraf.Accumulator, repo repository, queues map[string]branchQueue, now time.Time) {
+	branches := make([]string, 0, len(queues))
+	for branch := range queues {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+	for _, branch := range branches {
+		q := queues[branch]
+		tags := w.repositoryTags(repo)
+		tags["branch"] = branch
+		fields := map[string]interface{}{
+			"open_pull_requests": q.open,
+		}
+		if q.open > 0 {
+			fields["oldest_age"] = w.duration(w.calendar.elapsed(q.oldest, now))
+		}
+		acc.AddFields(measurementBranchQueue, fields, tags, now)
+	}
+}
@@ -0,0 +1,82 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetBranchQueues(t *testing.T) {
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	created := func(age time.Duration) string {
+		return now.Add(-age).Format(time.RFC3339)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/repositories/acme/api/pullrequests", r.URL.Path)
+		query := r.URL.Query()
+		require.Equal(t, []string{"OPEN"}, query["state"])
+		switch query.Get("q") {
+		case `destination.branch.name = "main"`:
+			require.Equal(t, "created_on", query.Get("sort"))
+			fmt.Fprintf(w, `{"size": 12, "values": [{"created_on": %q}]}`, created(21*24*time.Hour))
+		case `destination.branch.name = "develop"`:
+			fmt.Fprint(w, `{"size": 0, "values": []}`)
+		case "":
+			fmt.Fprintf(w, `{"values": [
+				{"created_on": %q, "destination": {"branch": {"name": "release/1.0"}}},
+				{"created_on": %q, "destination": {"branch": {"name": "release/1.0"}}},
+				{"created_on": %q, "destination": {"branch": {"name": "feature/x"}}}
+			]}`, created(time.Hour), created(3*time.Hour), created(7*time.Hour))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	newWorkspace := func(branches ...string) *workspace {
+		w := &workspace{
+			WorkspaceConfig: WorkspaceConfig{Workspace: "acme", QueueBranches: branches},
+			client:          bitbucketapi.NewClient(ts.Client(), ts.URL, make(chan struct{}, 1)),
+		}
+		var err error
+		w.queueBranches, err = filter.Compile(branches)
+		require.NoError(t, err)
+		return w
+	}
+
+	// Branches without wildcards are counted with a query each.
+	w := newWorkspace("main", "develop")
+	queues, err := w.getBranchQueues(context.Background(), repository{Slug: "api"})
+	require.NoError(t, err)
+	var acc testutil.Accumulator
+	w.addBranchQueues(&acc, repository{Slug: "api"}, queues, now)
+	require.Len(t, acc.Metrics, 2)
+	acc.AssertContainsTaggedFields(t, "bitbucket_branch_queue",
+		map[string]interface{}{"open_pull_requests": 0},
+		map[string]string{"workspace": "acme", "repository": "api", "branch": "develop"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_branch_queue",
+		map[string]interface{}{"open_pull_requests": 12, "oldest_age": int64(21 * 24 * 3600)},
+		map[string]string{"workspace": "acme", "repository": "api", "branch": "main"})
+
+	// Wildcards list the open pull requests.
+	w = newWorkspace("develop", "release/*")
+	queues, err = w.getBranchQueues(context.Background(), repository{Slug: "api"})
+	require.NoError(t, err)
+	acc = testutil.Accumulator{}
+	w.addBranchQueues(&acc, repository{Slug: "api"}, queues, now)
+	require.Len(t, acc.Metrics, 2)
+	acc.AssertContainsTaggedFields(t, "bitbucket_branch_queue",
+		map[string]interface{}{"open_pull_requests": 0},
+		map[string]string{"workspace": "acme", "repository": "api", "branch": "develop"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_branch_queue",
+		map[string]interface{}{"open_pull_requests": 2, "oldest_age": int64(10800)},
+		map[string]string{"workspace": "acme", "repository": "api", "branch": "release/1.0"})
+}
@@ -0,0 +1,92 @@
+package bitbucket
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// reviewLoad counts the open pull requests assigned to each reviewer of a
+// workspace during a gather.
+type reviewLoad struct {
+	mu          sync.Mutex
+	assignments map[string]int
+}
+
+func newReviewLoad() *reviewLoad {
+	return &reviewLoad{assignments: make(map[string]int)}
+}
+
+func (l *reviewLoad) add(w *workspace, pr pullRequest) {
+	if pr.State != "OPEN" {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, p := range pr.Participants {
+		if w.isReviewer(p) {
+			l.assignments[w.userName(p.User)]++
+		}
+	}
+}
+
+// fields returns the statistics of the assignments.  Only reviewers with at
+// least one assignment are known, so the minimum is at least one.
+func (l *reviewLoad) fields() map[string]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counts := make([]int, 0, len(l.assignments))
+	var total int
+	for _, n := range l.assignments {
+		counts = append(counts, n)
+		total += n
+	}
+	fields := map[string]interface{}{
+		"reviewers":            len(counts),
+		"reviewer_assignments": total,
+	}
+	if len(counts) == 0 {
+		return fields
+	}
+
+	sort.Ints(counts)
+	min, max := counts[0], counts[len(counts)-1]
+	fields["reviewer_assignments_min"] = min
+	fields["reviewer_assignments_max"] = max
+	fields["reviewer_assignments_max_min_ratio"] = float64(max) / float64(min)
+	fields["reviewer_assignments_gini"] = gini(counts, total)
+	return fields
+}
+
+// gini returns the Gini coefficient of the sorted counts, 0 when the load is
+// spread evenly and approaching 1 when it rests on a single reviewer.
+func gini(sorted []int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	n := float64(len(sorted))
+	var weighted float64
+	for i, c := range sorted {
+		weighted += float64(i+1) * float64(c)
+	}
+	g := (2*weighted)/(n*float64(total)) - (n+1)/n
+	return math.Max(g, 0)
+}
+
+// addPullRequestSummary reports the review load of the workspace and whether
+// its pull requests were truncated.
+func (w *workspace) addPullRequestSummary(acc telegraf.Accumulator, load *reviewLoad, trunc *truncation) {
+	tags := map[string]string{
+		"workspace": w.Workspace,
+	}
+	fields := load.fields()
+	for k, v := range trunc.fields() {
+		fields[k] = v
+	}
+	acc.AddFields(measurementPullRequestSummary, fields, tags, time.Now())
+}
@@ -0,0 +1,38 @@
+package bitbucket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReviewLoad(t *testing.T) {
+	w := &workspace{}
+	reviewer := func(name string) participant {
+		return participant{Role: "REVIEWER", User: prUser{DisplayName: name}}
+	}
+
+	load := newReviewLoad()
+	load.add(w, pullRequest{State: "OPEN", Participants: []participant{reviewer("Jane"), reviewer("John")}})
+	load.add(w, pullRequest{State: "OPEN", Participants: []participant{reviewer("Jane")}})
+	load.add(w, pullRequest{State: "OPEN", Participants: []participant{reviewer("Jane"), {Role: "PARTICIPANT"}}})
+	load.add(w, pullRequest{State: "MERGED", Participants: []participant{reviewer("John")}})
+
+	fields := load.fields()
+	require.Equal(t, 2, fields["reviewers"])
+	require.Equal(t, 4, fields["reviewer_assignments"])
+	require.Equal(t, 1, fields["reviewer_assignments_min"])
+	require.Equal(t, 3, fields["reviewer_assignments_max"])
+	require.Equal(t, 3.0, fields["reviewer_assignments_max_min_ratio"])
+	require.InDelta(t, 0.25, fields["reviewer_assignments_gini"], 1e-9)
+}
+
+func TestReviewLoadEmpty(t *testing.T) {
+	fields := newReviewLoad().fields()
+	require.Equal(t, map[string]interface{}{"reviewers": 0, "reviewer_assignments": 0}, fields)
+}
+
+func TestGini(t *testing.T) {
+	require.Equal(t, 0.0, gini([]int{2, 2, 2}, 6))
+	require.InDelta(t, 0.75, gini([]int{0, 0, 0, 4}, 4), 1e-9)
+}
@@ -0,0 +1,138 @@
+package bitbucket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// The gathers whose interval can be set in gather_intervals.
+const (
+	gatherRepositories = "repositories"
+	gatherPullRequests = "pull_requests"
+	gatherPermissions  = "permissions"
+	gatherWebhooks     = "webhooks"
+	gatherMainBranch   = "main_branch"
+	gatherSSHKeys      = "ssh_keys"
+	gatherTwoStep      = "two_step_verification"
+	gatherSecurity     = "security"
+	gatherConsumers    = "oauth_consumers"
+)
+
+var scheduledGathers = []string{
+	gatherRepositories,
+	gatherPullRequests,
+	gatherPermissions,
+	gatherWebhooks,
+	gatherMainBranch,
+	gatherSSHKeys,
+	gatherTwoStep,
+	gatherSecurity,
+	gatherConsumers,
+}
+
+// gatherSchedule runs the gathers of a workspace with an interval of their
+// own only when the interval elapsed, emitting the metrics of their last run
+// in the gathers between.
+type gatherSchedule struct {
+	intervals map[string]time.Duration
+
+	mu    sync.Mutex
+	runs  map[string]scheduledRun
+	repos []repository
+}
+
+type scheduledRun struct {
+	at      time.Time
+	metrics []telegraf.Metric
+}
+
+func newGatherSchedule(intervals map[string]time.Duration) *gatherSchedule {
+	return &gatherSchedule{
+		intervals: intervals,
+		runs:      make(map[string]scheduledRun),
+	}
+}
+
+// due returns whether the gather has to run at now, which is always the case
+// without an interval or a previous run.
+func (s *gatherSchedule) due(name string, now time.Time) bool {
+	if s == nil {
+		return true
+	}
+	interval, ok := s.intervals[name]
+	if !ok {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[name]
+	return !ok || now.Sub(run.at) >= interval
+}
+
+// recorder returns the accumulator a due gather adds its metrics to, which
+// records them when the gather has an interval.
+func (s *gatherSchedule) recorder(name string, acc telegraf.Accumulator) telegraf.Accumulator {
+	if s == nil {
+		return acc
+	}
+	if _, ok := s.intervals[name]; !ok {
+		return acc
+	}
+	return newRecordingAccumulator(acc)
+}
+
+// finish remembers the metrics recorded by the run of a gather at now.
+func (s *gatherSchedule) finish(name string, acc telegraf.Accumulator, now time.Time) {
+	rec, ok := acc.(*recordingAccumulator)
+	if s == nil || !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[name] = scheduledRun{at: now, metrics: rec.metrics}
+}
+
+// replay emits the metrics of the last run of a gather again.
+func (s *gatherSchedule) replay(name string, acc telegraf.Accumulator) {
+	s.mu.Lock()
+	metrics := s.runs[name].metrics
+	s.mu.Unlock()
+
+	for _, m := range metrics {
+		switch m.Type() {
+		case telegraf.Gauge:
+			acc.AddGauge(m.Name(), m.Fields(), m.Tags(), m.Time())
+		case telegraf.Counter:
+			acc.AddCounter(m.Name(), m.Fields(), m.Tags(), m.Time())
+		case telegraf.Summary:
+			acc.AddSummary(m.Name(), m.Fields(), m.Tags(), m.Time())
+		case telegraf.Histogram:
+			acc.AddHistogram(m.Name(), m.Fields(), m.Tags(), m.Time())
+		default:
+			acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
+		}
+	}
+}
+
+// repositories returns the repositories of the last listing.
+func (s *gatherSchedule) repositories() []repository {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.repos
+}
+
+func (s *gatherSchedule) setRepositories(repos []repository) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.repos = repos
+}
@@ -0,0 +1,84 @@
+package bitbucket
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherScheduleDue(t *testing.T) {
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	s := newGatherSchedule(map[string]time.Duration{gatherRepositories: time.Hour})
+
+	require.True(t, s.due(gatherRepositories, now))
+	require.True(t, s.due(gatherPullRequests, now))
+
+	var acc testutil.Accumulator
+	rec := s.recorder(gatherRepositories, &acc)
+	require.IsType(t, &recordingAccumulator{}, rec)
+	require.Equal(t, &acc, s.recorder(gatherPullRequests, &acc))
+	s.finish(gatherRepositories, rec, now)
+
+	require.False(t, s.due(gatherRepositories, now.Add(59*time.Minute)))
+	require.True(t, s.due(gatherRepositories, now.Add(time.Hour)))
+
+	var nilSchedule *gatherSchedule
+	require.True(t, nilSchedule.due(gatherRepositories, now))
+	require.Nil(t, nilSchedule.repositories())
+}
+
+func TestGatherIntervals(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api":              `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": `{"values": []}`,
+	})
+	defer ts.Close()
+
+	var requests []*url.URL
+	ts.Config.Handler = recordRequests(ts.Config.Handler, &requests)
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.GatherIntervals = map[string]internal.Duration{
+		"repositories": {Duration: time.Hour},
+	}
+	require.NoError(t, b.Init())
+
+	var first testutil.Accumulator
+	require.NoError(t, b.Gather(&first))
+	require.Len(t, first.Errors, 0)
+	firstRequests := len(requests)
+
+	var second testutil.Accumulator
+	require.NoError(t, b.Gather(&second))
+	require.Len(t, second.Errors, 0)
+
+	// Only the pull requests and their open count are requested again.
+	require.Len(t, requests, firstRequests+2)
+	for _, u := range requests[firstRequests:] {
+		require.Equal(t, "/repositories/acme/api/pullrequests", u.Path)
+	}
+
+	repo, ok := first.Get("bitbucket_repository")
+	require.True(t, ok)
+	replayed, ok := second.Get("bitbucket_repository")
+	require.True(t, ok)
+	require.Equal(t, repo.Fields, replayed.Fields)
+	require.Equal(t, repo.Time, replayed.Time)
+	require.True(t, second.HasMeasurement("bitbucket_pull_request_summary"))
+
+	up, ok := second.Get("bitbucket_up")
+	require.True(t, ok)
+	require.Equal(t, 1, up.Fields["repos_gathered"])
+}
+
+func TestInitGatherIntervals(t *testing.T) {
+	b := newTestBitbucket(t, "http://localhost")
+	b.GatherIntervals = map[string]internal.Duration{"pipelines": {Duration: time.Hour}}
+	require.EqualError(t, b.Init(), `invalid gather in gather_intervals "pipelines"`)
+}
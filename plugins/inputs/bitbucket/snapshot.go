@@ -0,0 +1,80 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/parsers/influx"
+	serializer "github.com/influxdata/telegraf/plugins/serializers/influx"
+)
+
+// snapshotMetric is the form a metric is kept in the snapshot_file, in line
+// protocol along with its type, which line protocol does not carry.
+type snapshotMetric struct {
+	Type telegraf.ValueType `json:"type"`
+	Line string             `json:"line"`
+}
+
+// saveSnapshot writes the metrics of a collection to path.
+func saveSnapshot(path string, metrics []telegraf.Metric) error {
+	s := serializer.NewSerializer()
+	snapshot := make([]snapshotMetric, 0, len(metrics))
+	for _, m := range metrics {
+		line, err := s.Serialize(m)
+		if err != nil {
+			return err
+		}
+		snapshot = append(snapshot, snapshotMetric{Type: m.Type(), Line: string(line)})
+	}
+	buf, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf)
+}
+
+// loadSnapshot reads the metrics written by saveSnapshot, none when the file
+// does not exist yet.
+func loadSnapshot(path string) ([]telegraf.Metric, error) {
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var snapshot []snapshotMetric
+	if err := json.Unmarshal(buf, &snapshot); err != nil {
+		return nil, err
+	}
+
+	parser := influx.NewParser(influx.NewMetricHandler())
+	metrics := make([]telegraf.Metric, 0, len(snapshot))
+	for _, s := range snapshot {
+		m, err := parser.ParseLine(s.Line)
+		if err != nil {
+			return nil, err
+		}
+		m, err = metric.New(m.Name(), m.Tags(), m.Fields(), m.Time(), s.Type)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+// addCached emits the metrics of the snapshot written before a restart,
+// marked with a cached field and the current time.
+func addCached(acc telegraf.Accumulator, metrics []telegraf.Metric) {
+	now := time.Now()
+	for _, m := range metrics {
+		m = m.Copy()
+		m.AddField("cached", true)
+		m.SetTime(now)
+		acc.AddMetric(m)
+	}
+}
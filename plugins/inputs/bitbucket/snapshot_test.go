@@ -0,0 +1,91 @@
+package bitbucket
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitbucket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+
+	metrics, err := loadSnapshot(path)
+	require.NoError(t, err)
+	require.Empty(t, metrics)
+
+	now := time.Unix(1580515200, 0)
+	expected := []telegraf.Metric{
+		testutil.MustMetric("bitbucket_repository",
+			map[string]string{"workspace": "acme", "repository": "api"},
+			map[string]interface{}{"size": int64(1024), "language": "go", "private": true},
+			now),
+		testutil.MustMetric("bitbucket_pull_request_age",
+			map[string]string{"workspace": "acme"},
+			map[string]interface{}{"3600": float64(2), "+Inf": float64(3), "count": float64(3), "sum": 7200.5},
+			now, telegraf.Histogram),
+	}
+	require.NoError(t, saveSnapshot(path, expected))
+
+	metrics, err = loadSnapshot(path)
+	require.NoError(t, err)
+	testutil.RequireMetricsEqual(t, expected, metrics)
+}
+
+func TestRefresherCached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitbucket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+
+	then := time.Unix(1580515200, 0)
+	r := &refresher{
+		snapshotFile: path,
+		cached: []telegraf.Metric{
+			testutil.MustMetric("bitbucket_up", map[string]string{"workspace": "acme"}, map[string]interface{}{"up": 1}, then),
+		},
+		collect: func(_ context.Context, acc telegraf.Accumulator) error {
+			acc.AddFields("bitbucket_up", map[string]interface{}{"up": 0}, map[string]string{"workspace": "acme"}, then)
+			return nil
+		},
+	}
+
+	// Before the first collection the cached metrics stand in.
+	var acc testutil.Accumulator
+	require.NoError(t, r.flush(&acc))
+	require.Len(t, acc.Metrics, 1)
+	require.Equal(t, map[string]interface{}{"up": int64(1), "cached": true}, acc.Metrics[0].Fields)
+	require.True(t, acc.Metrics[0].Time.After(then))
+
+	r.refresh(context.Background())
+	acc.ClearMetrics()
+	require.NoError(t, r.flush(&acc))
+	require.Len(t, acc.Metrics, 1)
+	require.Equal(t, map[string]interface{}{"up": int64(0)}, acc.Metrics[0].Fields)
+
+	saved, err := loadSnapshot(path)
+	require.NoError(t, err)
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{
+		testutil.MustMetric("bitbucket_up", map[string]string{"workspace": "acme"}, map[string]interface{}{"up": 0}, then),
+	}, saved)
+}
+
+func TestInitSnapshotFile(t *testing.T) {
+	b := &Bitbucket{WorkspaceConfig: WorkspaceConfig{Workspace: "acme"}, SnapshotFile: "snapshot.json"}
+	require.EqualError(t, b.Init(), "snapshot_file requires refresh_interval")
+
+	b.RefreshInterval = internal.Duration{Duration: time.Minute}
+	b.SnapshotFile = filepath.Join("testdata", "missing", "snapshot.json")
+	require.NoError(t, b.Init())
+	require.Empty(t, b.cached)
+}
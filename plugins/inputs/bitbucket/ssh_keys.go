@@ -0,0 +1,86 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+type sshKey struct {
+	Label     string    `json:"label"`
+	CreatedOn time.Time `json:"created_on"`
+}
+
+// gatherSSHKeys reports the SSH keys registered by the workspace members.
+// Members whose keys are not visible to the configured credentials are
+// skipped.
+func (w *workspace) gatherSSHKeys(ctx context.Context, acc telegraf.Accumulator) error {
+	members, err := w.getMembers(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range members {
+		var keys []sshKey
+		path := bitbucketapi.UserSSHKeysPath(m.User.AccountID)
+		keyCtx := bitbucketapi.ExpectStatus(ctx, http.StatusForbidden, http.StatusNotFound)
+		err := w.client.GetPages(keyCtx, path, url.Values{"pagelen": {"100"}}, func(values json.RawMessage) error {
+			var p []sshKey
+			if err := json.Unmarshal(values, &p); err != nil {
+				return err
+			}
+			keys = append(keys, p...)
+			return nil
+		})
+		if bitbucketapi.IsStatus(err, http.StatusForbidden, http.StatusNotFound) {
+			w.Log.Debugf("Skipping SSH keys of %s: %v", m.User.DisplayName, err)
+			continue
+		}
+		if err != nil {
+			acc.AddError(fmt.Errorf("gathering SSH keys of %s failed: %v", m.User.DisplayName, err))
+			continue
+		}
+
+		w.addSSHKeys(acc, m.User, keys, time.Now())
+	}
+	return nil
+}
+
+func (w *workspace) addSSHKeys(acc telegraf.Accumulator, u user, keys []sshKey, now time.Time) {
+	var stale int
+	for _, key := range keys {
+		age := now.Sub(key.CreatedOn)
+		isStale := w.SSHKeyMaxAge.Duration > 0 && age > w.SSHKeyMaxAge.Duration
+		if isStale {
+			stale++
+		}
+
+		tags := map[string]string{
+			"workspace": w.Workspace,
+			"user":      u.DisplayName,
+			"label":     key.Label,
+		}
+		fields := map[string]interface{}{
+			"age":   w.duration(age),
+			"stale": isStale,
+		}
+		acc.AddFields(measurementSSHKey, fields, tags, now)
+	}
+
+	tags := map[string]string{
+		"workspace": w.Workspace,
+		"user":      u.DisplayName,
+	}
+	fields := map[string]interface{}{
+		"account_id": u.AccountID,
+		"count":      len(keys),
+		"stale":      stale,
+	}
+	acc.AddFields(measurementSSHKeys, fields, tags, now)
+}
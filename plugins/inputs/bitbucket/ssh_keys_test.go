@@ -0,0 +1,58 @@
+package bitbucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherSSHKeys(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme": `{"values": []}`,
+		"/workspaces/acme/members": `{
+			"values": [
+				{"user": {"display_name": "Jane Doe", "account_id": "557058:1"}},
+				{"user": {"display_name": "John Doe", "account_id": "557058:2"}}
+			]
+		}`,
+		"/users/557058:1/ssh-keys": `{
+			"values": [
+				{"label": "laptop", "created_on": "2010-01-02T15:04:05.000000+00:00"},
+				{"label": "ci", "created_on": "2999-01-02T15:04:05.000000+00:00"}
+			]
+		}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.GatherSSHKeys = true
+	b.SSHKeyMaxAge.Duration = 24 * time.Hour
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_ssh_keys",
+		map[string]interface{}{"account_id": "557058:1", "count": 2, "stale": 1},
+		map[string]string{"workspace": "acme", "user": "Jane Doe"})
+	require.Len(t, acc.Metrics, 4) // including bitbucket_up
+}
+
+func TestAddSSHKeys(t *testing.T) {
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	w := &workspace{WorkspaceConfig: WorkspaceConfig{Workspace: "acme"}}
+	w.SSHKeyMaxAge.Duration = 48 * time.Hour
+
+	var acc testutil.Accumulator
+	w.addSSHKeys(&acc, user{DisplayName: "Jane Doe", AccountID: "557058:1"}, []sshKey{
+		{Label: "laptop", CreatedOn: now.Add(-72 * time.Hour)},
+		{Label: "ci", CreatedOn: now.Add(-time.Hour)},
+	}, now)
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_ssh_key",
+		map[string]interface{}{"age": int64(259200), "stale": true},
+		map[string]string{"workspace": "acme", "user": "Jane Doe", "label": "laptop"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_ssh_key",
+		map[string]interface{}{"age": int64(3600), "stale": false},
+		map[string]string{"workspace": "acme", "user": "Jane Doe", "label": "ci"})
+}
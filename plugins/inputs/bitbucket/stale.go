@@ -0,0 +1,82 @@
+package bitbucket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// recordingAccumulator passes metrics on to the wrapped accumulator while
+// keeping a copy of them, so that they can be served again when a later
+// gather fails.
+type recordingAccumulator struct {
+	telegraf.Accumulator
+
+	mu      sync.Mutex
+	metrics []telegraf.Metric
+}
+
+func newRecordingAccumulator(acc telegraf.Accumulator) *recordingAccumulator {
+	return &recordingAccumulator{Accumulator: acc}
+}
+
+func (r *recordingAccumulator) AddFields(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	r.record(measurement, fields, tags, telegraf.Untyped, t)
+	r.Accumulator.AddFields(measurement, fields, tags, t...)
+}
+
+func (r *recordingAccumulator) AddGauge(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	r.record(measurement, fields, tags, telegraf.Gauge, t)
+	r.Accumulator.AddGauge(measurement, fields, tags, t...)
+}
+
+func (r *recordingAccumulator) AddCounter(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	r.record(measurement, fields, tags, telegraf.Counter, t)
+	r.Accumulator.AddCounter(measurement, fields, tags, t...)
+}
+
+func (r *recordingAccumulator) AddSummary(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	r.record(measurement, fields, tags, telegraf.Summary, t)
+	r.Accumulator.AddSummary(measurement, fields, tags, t...)
+}
+
+func (r *recordingAccumulator) AddHistogram(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	r.record(measurement, fields, tags, telegraf.Histogram, t)
+	r.Accumulator.AddHistogram(measurement, fields, tags, t...)
+}
+
+func (r *recordingAccumulator) AddMetric(m telegraf.Metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m.Copy())
+	r.mu.Unlock()
+	r.Accumulator.AddMetric(m)
+}
+
+func (r *recordingAccumulator) record(measurement string, fields map[string]interface{}, tags map[string]string, tp telegraf.ValueType, t []time.Time) {
+	tm := time.Now()
+	if len(t) > 0 {
+		tm = t[0]
+	}
+	m, err := metric.New(measurement, tags, fields, tm, tp)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mu.Unlock()
+}
+
+// addStale emits the metrics of the last successful gather again, marked
+// with a stale field and the current time.
+func addStale(acc telegraf.Accumulator, metrics []telegraf.Metric) {
+	now := time.Now()
+	for _, m := range metrics {
+		m = m.Copy()
+		m.AddField("stale", true)
+		m.SetTime(now)
+		acc.AddMetric(m)
+	}
+}
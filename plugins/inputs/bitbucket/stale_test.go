@@ -0,0 +1,40 @@
+package bitbucket
+
+import (
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeStale(t *testing.T) {
+	responses := map[string]string{
+		"/repositories/acme": `{"values": [{"slug": "api", "size": 1024}]}`,
+	}
+	ts := newTestServer(t, responses)
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.ServeStale = true
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+	require.Equal(t, uint64(2), acc.NMetrics())
+	require.False(t, acc.HasField("bitbucket_repository", "stale"))
+
+	delete(responses, "/repositories/acme")
+	acc.ClearMetrics()
+	require.Error(t, acc.GatherError(b.Gather))
+	acc.AssertContainsTaggedFields(t, "bitbucket_repository",
+		map[string]interface{}{
+			"size":       int64(1024),
+			"is_private": false,
+			"has_issues": false,
+			"has_wiki":   false,
+			"stale":      true,
+		},
+		map[string]string{
+			"workspace":  "acme",
+			"repository": "api",
+			"language":   "",
+		})
+}
@@ -0,0 +1,227 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"golang.org/x/oauth2"
+)
+
+// gatherState is the state kept between gathers, persisted to state_file
+// when given.
+type gatherState struct {
+	mu   sync.Mutex
+	path string
+
+	// log reports the failures to save the state after a refresh token was
+	// rotated, if set.
+	log telegraf.Logger
+
+	// caches holds the token caches handed out, one per consumer, so that
+	// the clients of workspaces sharing a consumer share its lock.
+	caches map[string]*stateTokenCache
+
+	// Closed holds the merged and declined pull requests already emitted,
+	// keyed by workspace/repository and pull request ID, along with their
+	// last update.
+	Closed map[string]map[string]time.Time `json:"closed"`
+
+	// Tokens holds the OAuth tokens obtained, keyed by consumer.
+	Tokens map[string]*oauth2.Token `json:"tokens,omitempty"`
+
+	// Sizes holds the last gathered sizes of the repositories, keyed by
+	// workspace/repository.
+	Sizes map[string]int64 `json:"sizes,omitempty"`
+}
+
+// loadState reads the state from path, starting empty when the file does
+// not exist yet or no path is given.
+func loadState(path string) (*gatherState, error) {
+	s := &gatherState{path: path, Closed: make(map[string]map[string]time.Time)}
+	if path == "" {
+		return s, nil
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, s); err != nil {
+		return nil, err
+	}
+	if s.Closed == nil {
+		s.Closed = make(map[string]map[string]time.Time)
+	}
+	return s, nil
+}
+
+// save writes the state to its file.
+func (s *gatherState) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	buf, err := json.Marshal(s)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, buf)
+}
+
+// writeFileAtomic replaces the file at path by one holding buf, so that
+// readers never see a partially written file.
+func writeFileAtomic(path string, buf []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// maxClosed bounds the closed pull requests remembered per repository.
+const maxClosed = 10000
+
+// newlyClosed returns the pull requests which are still open or were not
+// emitted as closed before.  Entries older than since are forgotten, as
+// such pull requests are no longer listed.  Without since the entries are
+// only bounded by maxClosed, as pull requests missing from prs may merely
+// have been left out by max_prs_per_repo or other limits.
+func (s *gatherState) newlyClosed(key string, prs []pullRequest, since time.Time) []pullRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	closed := s.Closed[key]
+	if !since.IsZero() {
+		for id, updated := range closed {
+			if updated.Before(since) {
+				delete(closed, id)
+			}
+		}
+	}
+
+	kept := prs[:0]
+	for _, pr := range prs {
+		if pr.State != "OPEN" {
+			if _, ok := closed[strconv.FormatInt(pr.ID, 10)]; ok {
+				continue
+			}
+		}
+		kept = append(kept, pr)
+	}
+	return kept
+}
+
+// markClosed marks the closed pull requests as emitted, once their metrics
+// were added.  Past maxClosed entries the least recently updated pull
+// requests are forgotten.
+func (s *gatherState) markClosed(key string, prs []pullRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	closed := s.Closed[key]
+	if closed == nil {
+		closed = make(map[string]time.Time)
+		s.Closed[key] = closed
+	}
+	for _, pr := range prs {
+		if pr.State != "OPEN" {
+			closed[strconv.FormatInt(pr.ID, 10)] = pr.UpdatedOn
+		}
+	}
+
+	if len(closed) <= maxClosed {
+		return
+	}
+	ids := make([]string, 0, len(closed))
+	for id := range closed {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return closed[ids[i]].Before(closed[ids[j]])
+	})
+	for _, id := range ids[:len(ids)-maxClosed] {
+		delete(closed, id)
+	}
+}
+
+// swapSize stores the size of a repository and returns the previous one, if
+// any.
+func (s *gatherState) swapSize(key string, size int64) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Sizes == nil {
+		s.Sizes = make(map[string]int64)
+	}
+	previous, ok := s.Sizes[key]
+	s.Sizes[key] = size
+	return previous, ok
+}
+
+// tokenCache returns the cache of the OAuth tokens of a consumer, the same
+// one for every call with the key.
+func (s *gatherState) tokenCache(key string) *stateTokenCache {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.caches == nil {
+		s.caches = make(map[string]*stateTokenCache)
+	}
+	c, ok := s.caches[key]
+	if !ok {
+		c = &stateTokenCache{state: s, key: key}
+		s.caches[key] = c
+	}
+	return c
+}
+
+// stateTokenCache keeps the OAuth tokens of a consumer in the state, to be
+// saved with it.  A rotated refresh token is saved right away, as the
+// previous one is revoked.  The cache is locked by the refresh token grant
+// while refreshing.
+type stateTokenCache struct {
+	sync.Mutex
+
+	state *gatherState
+	key   string
+}
+
+func (c *stateTokenCache) Token() *oauth2.Token {
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+	return c.state.Tokens[c.key]
+}
+
+func (c *stateTokenCache) SetToken(token *oauth2.Token) {
+	c.state.mu.Lock()
+	if c.state.Tokens == nil {
+		c.state.Tokens = make(map[string]*oauth2.Token)
+	}
+	previous := c.state.Tokens[c.key]
+	c.state.Tokens[c.key] = token
+	c.state.mu.Unlock()
+
+	if token.RefreshToken == "" || previous != nil && token.RefreshToken == previous.RefreshToken {
+		return
+	}
+	if err := c.state.save(); err != nil && c.state.log != nil {
+		c.state.log.Errorf("Saving the rotated refresh token failed: %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+package bitbucket
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestEmitClosedOnce(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(`{
+			"values": [
+				{"id": 3, "state": "OPEN", "updated_on": "RECENT"},
+				{"id": 2, "state": "MERGED", "updated_on": "RECENT"},
+				{"id": 1, "state": "DECLINED", "updated_on": "RECENT"}
+			]
+		}`, "RECENT", recent, -1),
+	})
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "bitbucket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	gather := func() []int64 {
+		b := newTestBitbucket(t, ts.URL)
+		b.Repositories = []string{"api"}
+		b.GatherPullRequests = true
+		b.EmitClosedOnce = true
+		b.StateFile = stateFile
+		require.NoError(t, b.Init())
+
+		var acc testutil.Accumulator
+		require.NoError(t, acc.GatherError(b.Gather))
+		var ids []int64
+		for _, m := range acc.Metrics {
+			if m.Measurement == "bitbucket_pull_request" {
+				ids = append(ids, m.Fields["id"].(int64))
+			}
+		}
+		return ids
+	}
+
+	require.Equal(t, []int64{3, 2, 1}, gather())
+	// A restarted plugin picks up the state from the file.
+	require.Equal(t, []int64{3}, gather())
+}
+
+func TestStateNewlyClosedForgetsOld(t *testing.T) {
+	now := time.Now()
+	s, err := loadState("")
+	require.NoError(t, err)
+
+	prs := []pullRequest{
+		{ID: 2, State: "MERGED", UpdatedOn: now.Add(-2 * time.Hour)},
+		{ID: 1, State: "MERGED", UpdatedOn: now},
+	}
+	require.Len(t, s.newlyClosed("acme/api", prs, time.Time{}), 2)
+	require.Empty(t, s.Closed["acme/api"])
+	s.markClosed("acme/api", prs)
+	require.Len(t, s.Closed["acme/api"], 2)
+	require.Empty(t, s.newlyClosed("acme/api", prs, time.Time{}))
+
+	s.newlyClosed("acme/api", nil, now.Add(-time.Hour))
+	require.Equal(t, []string{"1"}, keys(s.Closed["acme/api"]))
+}
+
+func TestStateNewlyClosedKeepsUnlisted(t *testing.T) {
+	s, err := loadState("")
+	require.NoError(t, err)
+
+	closed := []pullRequest{{ID: 2, State: "MERGED"}, {ID: 1, State: "DECLINED"}}
+	s.markClosed("acme/api", closed)
+
+	// Without a lookback window pull request 1 is remembered while it is
+	// not listed, e.g. left out by max_prs_per_repo for one gather.
+	prs := []pullRequest{{ID: 3, State: "OPEN"}, {ID: 2, State: "MERGED"}}
+	require.Equal(t, []pullRequest{{ID: 3, State: "OPEN"}}, s.newlyClosed("acme/api", prs, time.Time{}))
+	require.ElementsMatch(t, []string{"1", "2"}, keys(s.Closed["acme/api"]))
+	require.Empty(t, s.newlyClosed("acme/api", closed, time.Time{}))
+}
+
+func TestStateMarkClosedBounded(t *testing.T) {
+	now := time.Now()
+	s, err := loadState("")
+	require.NoError(t, err)
+
+	prs := make([]pullRequest, 0, maxClosed+1)
+	for i := 0; i <= maxClosed; i++ {
+		prs = append(prs, pullRequest{ID: int64(i), State: "MERGED", UpdatedOn: now.Add(time.Duration(i) * time.Second)})
+	}
+	s.markClosed("acme/api", prs)
+	require.Len(t, s.Closed["acme/api"], maxClosed)
+	require.NotContains(t, s.Closed["acme/api"], "0")
+	require.Contains(t, s.Closed["acme/api"], "1")
+}
+
+func TestEmitClosedOnceHiddenByLimit(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(`{
+			"values": [
+				{"id": 2, "state": "MERGED", "updated_on": "RECENT"},
+				{"id": 1, "state": "MERGED", "updated_on": "RECENT"}
+			]
+		}`, "RECENT", recent, -1),
+	})
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "bitbucket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	gather := func(limit int) []int64 {
+		b := newTestBitbucket(t, ts.URL)
+		b.Repositories = []string{"api"}
+		b.GatherPullRequests = true
+		b.PullRequestLookback.Duration = 0
+		b.MaxPRsPerRepo = limit
+		b.EmitClosedOnce = true
+		b.StateFile = stateFile
+		require.NoError(t, b.Init())
+
+		var acc testutil.Accumulator
+		require.NoError(t, acc.GatherError(b.Gather))
+		var ids []int64
+		for _, m := range acc.Metrics {
+			if m.Measurement == "bitbucket_pull_request" {
+				ids = append(ids, m.Fields["id"].(int64))
+			}
+		}
+		return ids
+	}
+
+	require.Equal(t, []int64{2, 1}, gather(0))
+	// max_prs_per_repo hides pull request 1 for a gather, it is not
+	// emitted again once listed.
+	require.Empty(t, gather(1))
+	require.Empty(t, gather(0))
+}
+
+func TestEmitClosedOnceAfterFilter(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/pullrequests": strings.Replace(`{
+			"values": [{"id": 2, "state": "MERGED", "updated_on": "RECENT"}]
+		}`, "RECENT", recent, -1),
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	b.GatherDiffstat = true
+	b.PathInclude = []string{"src/**"}
+	b.EmitClosedOnce = true
+	require.NoError(t, b.Init())
+
+	// The diffstat cannot be fetched, so path_include leaves out the pull
+	// request, which stays due.
+	var acc testutil.Accumulator
+	require.NoError(t, b.Gather(&acc))
+	require.False(t, acc.HasMeasurement("bitbucket_pull_request"))
+	require.Empty(t, b.state.Closed["acme/api"])
+}
+
+func keys(m map[string]time.Time) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestPersistTokens(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitbucket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	b := &Bitbucket{WorkspaceConfig: WorkspaceConfig{Workspace: "acme"}, PersistTokens: true}
+	require.EqualError(t, b.Init(), "persist_tokens requires state_file")
+
+	state, err := loadState(stateFile)
+	require.NoError(t, err)
+	provider := cacheTokens(bitbucketapi.ClientCredentials{ClientID: "key", ClientSecret: "secret"}, state)
+	expiry := time.Now().Add(time.Hour).Round(time.Second)
+	provider.(bitbucketapi.ClientCredentials).Cache.SetToken(&oauth2.Token{AccessToken: "issued", Expiry: expiry})
+	require.NoError(t, state.save())
+
+	// A restarted plugin picks up the token from the file.
+	state, err = loadState(stateFile)
+	require.NoError(t, err)
+	token := state.tokenCache("key").Token()
+	require.NotNil(t, token)
+	require.Equal(t, "issued", token.AccessToken)
+	require.True(t, expiry.Equal(token.Expiry))
+
+	provider = cacheTokens(bitbucketapi.PasswordCredentials{ClientID: "key", Username: "jdoe"}, state)
+	require.Nil(t, provider.(bitbucketapi.PasswordCredentials).Cache.Token())
+	require.Equal(t, bitbucketapi.NoAuth{}, cacheTokens(bitbucketapi.NoAuth{}, state))
+
+	// Rotated refresh tokens are saved right away and survive a restart.
+	provider = cacheTokens(bitbucketapi.RefreshTokenCredentials{ClientID: "key", RefreshToken: "initial"}, state)
+	provider.(bitbucketapi.RefreshTokenCredentials).Cache.SetToken(&oauth2.Token{AccessToken: "issued", RefreshToken: "rotated"})
+	state, err = loadState(stateFile)
+	require.NoError(t, err)
+	provider = cacheTokens(bitbucketapi.RefreshTokenCredentials{ClientID: "key", RefreshToken: "initial"}, state)
+	require.Equal(t, "rotated", provider.(bitbucketapi.RefreshTokenCredentials).Cache.Token().RefreshToken)
+}
+
+func TestTrackSizeGrowth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitbucket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	size := 1024
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repositories/acme/api" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"slug": "api", "size": %d}`, size)
+	}))
+	defer ts.Close()
+
+	gather := func() interface{} {
+		b := newTestBitbucket(t, ts.URL)
+		b.Repositories = []string{"api"}
+		b.TrackSizeGrowth = true
+		b.StateFile = stateFile
+		require.NoError(t, b.Init())
+		var acc testutil.Accumulator
+		require.NoError(t, acc.GatherError(b.Gather))
+		for _, m := range acc.Metrics {
+			if m.Measurement == "bitbucket_repository" {
+				return m.Fields["size_growth_bytes"]
+			}
+		}
+		return nil
+	}
+
+	require.Nil(t, gather())
+	// A restarted plugin compares with the size from the file.
+	size = 5000
+	require.Equal(t, int64(3976), gather())
+	size = 4000
+	require.Equal(t, int64(-1000), gather())
+}
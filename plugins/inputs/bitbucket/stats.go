@@ -0,0 +1,121 @@
+package bitbucket
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// requestStats are the internal statistics of the API requests and of the
+// gathers making them.
+type requestStats struct {
+	requests selfstat.Stat
+	errors   selfstat.Stat
+
+	// The phase timings of the last gather, in milliseconds.
+	gatherDuration      selfstat.Stat
+	memberDiscovery     selfstat.Stat
+	repositoryDiscovery selfstat.Stat
+	pullRequestFetch    selfstat.Stat
+	accumulation        selfstat.Stat
+
+	// The requests made by the pull request gather of the last gather and
+	// the repositories it did not request with pull_request_mode.
+	pullRequestRequests selfstat.Stat
+	skippedRepositories selfstat.Stat
+
+	// The connection timings are only registered when tracing is enabled.
+	dnsLookup    selfstat.Stat
+	connect      selfstat.Stat
+	tlsHandshake selfstat.Stat
+	firstByte    selfstat.Stat
+}
+
+func newRequestStats(tags map[string]string, trace bool) *requestStats {
+	s := &requestStats{
+		requests: selfstat.Register("bitbucket", "requests", tags),
+		errors:   selfstat.Register("bitbucket", "request_errors", tags),
+
+		gatherDuration:      selfstat.Register("bitbucket", "gather_duration_ms", tags),
+		memberDiscovery:     selfstat.Register("bitbucket", "member_discovery_ms", tags),
+		repositoryDiscovery: selfstat.Register("bitbucket", "repository_discovery_ms", tags),
+		pullRequestFetch:    selfstat.Register("bitbucket", "pull_request_fetch_ms", tags),
+		accumulation:        selfstat.Register("bitbucket", "accumulation_ms", tags),
+
+		pullRequestRequests: selfstat.Register("bitbucket", "pull_request_requests", tags),
+		skippedRepositories: selfstat.Register("bitbucket", "pull_request_repositories_skipped", tags),
+	}
+	if trace {
+		s.dnsLookup = selfstat.RegisterTiming("bitbucket", "dns_lookup_ns", tags)
+		s.connect = selfstat.RegisterTiming("bitbucket", "connect_ns", tags)
+		s.tlsHandshake = selfstat.RegisterTiming("bitbucket", "tls_handshake_ns", tags)
+		s.firstByte = selfstat.RegisterTiming("bitbucket", "time_to_first_byte_ns", tags)
+	}
+	return s
+}
+
+// withTrace returns a context recording the connection timings of the
+// request made with it, when tracing is enabled.
+func (s *requestStats) withTrace(ctx context.Context) context.Context {
+	if s.firstByte == nil {
+		return ctx
+	}
+
+	var dnsStart, connectStart, tlsStart time.Time
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			s.dnsLookup.Incr(int64(time.Since(dnsStart)))
+		},
+		ConnectStart: func(_, _ string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				s.connect.Incr(int64(time.Since(connectStart)))
+			}
+		},
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				s.tlsHandshake.Incr(int64(time.Since(tlsStart)))
+			}
+		},
+		GotFirstResponseByte: func() {
+			s.firstByte.Incr(int64(time.Since(start)))
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace)
+}
+
+type requestCounterKey struct{}
+
+// countRequests returns a context counting the requests made with it in n.
+func countRequests(ctx context.Context, n *int64) context.Context {
+	return context.WithValue(ctx, requestCounterKey{}, n)
+}
+
+// countRequest counts a request made with a context of countRequests.
+func countRequest(ctx context.Context) {
+	if n, ok := ctx.Value(requestCounterKey{}).(*int64); ok {
+		atomic.AddInt64(n, 1)
+	}
+}
+
+// requestCount returns the requests made so far with a context of
+// countRequests.
+func requestCount(ctx context.Context) int64 {
+	if n, ok := ctx.Value(requestCounterKey{}).(*int64); ok {
+		return atomic.LoadInt64(n)
+	}
+	return 0
+}
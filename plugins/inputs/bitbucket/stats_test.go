@@ -0,0 +1,50 @@
+package bitbucket
+
+import (
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestStats(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme": `{"values": []}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Workspace = "stats"
+	b.Repositories = []string{"missing"}
+	b.TraceRequests = true
+	var acc testutil.Accumulator
+	require.Error(t, acc.GatherError(b.Gather))
+
+	stats := b.workspaces[0].stats
+	require.Equal(t, int64(1), stats.requests.Get())
+	require.Equal(t, int64(1), stats.errors.Get())
+	require.True(t, stats.connect.Get() > 0)
+	require.True(t, stats.firstByte.Get() > 0)
+	require.Equal(t, int64(0), stats.tlsHandshake.Get())
+}
+
+func TestGatherTimings(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/timings/api":              `{"slug": "api"}`,
+		"/repositories/timings/api/pullrequests": `{"values": []}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Workspace = "timings"
+	b.Repositories = []string{"api"}
+	b.GatherPullRequests = true
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	w := b.workspaces[0]
+	require.True(t, w.timings.phases[phaseRepositoryDiscovery] > 0)
+	require.True(t, w.timings.phases[phasePullRequestFetch] > 0)
+	require.Equal(t, int64(0), w.timings.phases[phaseMemberDiscovery])
+	require.True(t, w.stats.gatherDuration.Get() >= w.stats.repositoryDiscovery.Get())
+}
@@ -0,0 +1,86 @@
+package bitbucket
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// reviewLatency returns the time from opening the pull request until the
+// first reviewer approved or requested changes.  Bitbucket only keeps the
+// last participation of each reviewer, so a reviewer who reviewed again
+// later counts with the later time.
+func (w *workspace) reviewLatency(pr pullRequest) (time.Duration, bool) {
+	var first time.Time
+	for _, p := range pr.Participants {
+		if !w.isReviewer(p) || p.ParticipatedOn.IsZero() {
+			continue
+		}
+		if !p.Approved && p.State != "changes_requested" {
+			continue
+		}
+		if first.IsZero() || p.ParticipatedOn.Before(first) {
+			first = p.ParticipatedOn
+		}
+	}
+	if first.IsZero() || first.Before(pr.CreatedOn) {
+		return 0, false
+	}
+	return w.calendar.elapsed(pr.CreatedOn, first), true
+}
+
+// summaryFields returns the count, sum and quantiles of the values, in the
+// form the prometheus_client output expects.  The quantiles are the nearest
+// rank of the sorted values and are left out without values.
+func summaryFields(values []float64, quantiles []float64) map[string]interface{} {
+	sort.Float64s(values)
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	fields := map[string]interface{}{
+		"count": int64(len(values)),
+		"sum":   sum,
+	}
+	if len(values) == 0 {
+		return fields
+	}
+	for _, q := range quantiles {
+		rank := int(math.Ceil(q*float64(len(values)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		fields[strconv.FormatFloat(q, 'f', -1, 64)] = values[rank]
+	}
+	return fields
+}
+
+// validQuantiles returns whether the quantiles are between 0 and 1.
+func validQuantiles(quantiles []float64) bool {
+	for _, q := range quantiles {
+		if !(q >= 0 && q <= 1) {
+			return false
+		}
+	}
+	return true
+}
+
+// addReviewLatencySummary reports the distribution of the review latency of
+// the gathered pull requests of the repository which were reviewed.
+func (w *workspace) addReviewLatencySummary(acc telegraf.Accumulator, repo repository, prs []pullRequest, now time.Time) {
+	var latencies []float64
+	for _, pr := range prs {
+		if d, ok := w.reviewLatency(pr); ok {
+			latencies = append(latencies, w.durationValue(d))
+		}
+	}
+
+	tags := w.repositoryTags(repo)
+	if repo.Project.Key != "" {
+		tags["project"] = repo.Project.Key
+	}
+	acc.AddSummary(measurementReviewLatency, summaryFields(latencies, w.reviewLatencyQuantiles), tags, now)
+}
@@ -0,0 +1,78 @@
+package bitbucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReviewLatency(t *testing.T) {
+	created := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	w := &workspace{}
+
+	pr := pullRequest{
+		CreatedOn: created,
+		Participants: []participant{
+			{Role: "REVIEWER", Approved: true, ParticipatedOn: created.Add(3 * time.Hour)},
+			{Role: "REVIEWER", State: "changes_requested", ParticipatedOn: created.Add(2 * time.Hour)},
+			{Role: "REVIEWER", ParticipatedOn: created.Add(time.Hour)},
+			{Role: "PARTICIPANT", Approved: true, ParticipatedOn: created.Add(time.Minute)},
+		},
+	}
+	d, ok := w.reviewLatency(pr)
+	require.True(t, ok)
+	require.Equal(t, 2*time.Hour, d)
+
+	_, ok = w.reviewLatency(pullRequest{CreatedOn: created})
+	require.False(t, ok)
+}
+
+func TestSummaryFields(t *testing.T) {
+	require.Equal(t, map[string]interface{}{
+		"count": int64(4),
+		"sum":   10.0,
+		"0":     1.0,
+		"0.5":   2.0,
+		"0.9":   4.0,
+	}, summaryFields([]float64{4, 1, 3, 2}, []float64{0, 0.5, 0.9}))
+
+	require.Equal(t, map[string]interface{}{
+		"count": int64(0),
+		"sum":   0.0,
+	}, summaryFields(nil, []float64{0.5}))
+}
+
+func TestValidQuantiles(t *testing.T) {
+	require.True(t, validQuantiles([]float64{0, 0.5, 1}))
+	require.False(t, validQuantiles([]float64{1.5}))
+	require.False(t, validQuantiles([]float64{-0.1}))
+}
+
+func TestAddReviewLatencySummary(t *testing.T) {
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	w := &workspace{
+		WorkspaceConfig:        WorkspaceConfig{Workspace: "acme"},
+		durationUnit:           "m",
+		reviewLatencyQuantiles: []float64{0.5},
+	}
+	prs := []pullRequest{
+		{CreatedOn: now.Add(-time.Hour), Participants: []participant{
+			{Role: "REVIEWER", Approved: true, ParticipatedOn: now.Add(-30 * time.Minute)},
+		}},
+		{CreatedOn: now.Add(-time.Hour)},
+	}
+
+	var acc testutil.Accumulator
+	w.addReviewLatencySummary(&acc, repository{Slug: "api"}, prs, now)
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric("bitbucket_review_latency",
+			map[string]string{"workspace": "acme", "repository": "api"},
+			map[string]interface{}{"count": int64(1), "sum": 30.0, "0.5": 30.0},
+			now, telegraf.Summary),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics())
+}
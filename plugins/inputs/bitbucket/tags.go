@@ -0,0 +1,61 @@
+package bitbucket
+
+import (
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// taggingAccumulator adds the tags of a workspace to every metric, without
+// replacing the tags a metric already has.
+type taggingAccumulator struct {
+	telegraf.Accumulator
+	tags map[string]string
+}
+
+func newTaggingAccumulator(acc telegraf.Accumulator, tags map[string]string) telegraf.Accumulator {
+	if len(tags) == 0 {
+		return acc
+	}
+	return &taggingAccumulator{Accumulator: acc, tags: tags}
+}
+
+func (a *taggingAccumulator) AddFields(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.Accumulator.AddFields(measurement, fields, a.merge(tags), t...)
+}
+
+func (a *taggingAccumulator) AddGauge(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.Accumulator.AddGauge(measurement, fields, a.merge(tags), t...)
+}
+
+func (a *taggingAccumulator) AddCounter(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.Accumulator.AddCounter(measurement, fields, a.merge(tags), t...)
+}
+
+func (a *taggingAccumulator) AddSummary(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.Accumulator.AddSummary(measurement, fields, a.merge(tags), t...)
+}
+
+func (a *taggingAccumulator) AddHistogram(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.Accumulator.AddHistogram(measurement, fields, a.merge(tags), t...)
+}
+
+func (a *taggingAccumulator) AddMetric(m telegraf.Metric) {
+	for k, v := range a.tags {
+		if !m.HasTag(k) {
+			m.AddTag(k, v)
+		}
+	}
+	a.Accumulator.AddMetric(m)
+}
+
+func (a *taggingAccumulator) merge(tags map[string]string) map[string]string {
+	merged := make(map[string]string, len(tags)+len(a.tags))
+	for k, v := range a.tags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,57 @@
+package bitbucket
+
+import (
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherWorkspaceTags(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/initech": `{"values": [{"slug": "tps"}]}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Workspace = ""
+	b.Workspaces = []*WorkspaceConfig{
+		{Workspace: "initech", Tags: map[string]string{"business_unit": "payments", "repository": "all"}},
+	}
+	require.NoError(t, b.Init())
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_up",
+		map[string]interface{}{"success": 1, "repos_gathered": 1, "prs_gathered": 0, "errors": 0},
+		map[string]string{"workspace": "initech", "business_unit": "payments", "repository": "all"})
+
+	// Static tags do not replace the tags of the metrics.
+	acc.AssertContainsTaggedFields(t, "bitbucket_repository",
+		map[string]interface{}{
+			"size":       int64(0),
+			"is_private": false,
+			"has_issues": false,
+			"has_wiki":   false,
+		},
+		map[string]string{"workspace": "initech", "business_unit": "payments", "repository": "tps", "language": ""})
+}
+
+func TestTaggingAccumulatorKeepsMetricTags(t *testing.T) {
+	w := &workspace{WorkspaceConfig: WorkspaceConfig{
+		Workspace: "acme",
+		Tags:      map[string]string{"workspace": "static", "team": "core"},
+	}}
+
+	var acc testutil.Accumulator
+	tacc := newTaggingAccumulator(&acc, w.tags())
+	tacc.AddFields("m1", map[string]interface{}{"value": 1}, nil)
+	tacc.AddFields("m2", map[string]interface{}{"value": 1}, map[string]string{"team": "web"})
+
+	acc.AssertContainsTaggedFields(t, "m1",
+		map[string]interface{}{"value": 1},
+		map[string]string{"workspace": "acme", "team": "core"})
+	acc.AssertContainsTaggedFields(t, "m2",
+		map[string]interface{}{"value": 1},
+		map[string]string{"workspace": "acme", "team": "web"})
+}
@@ -0,0 +1,84 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+// loadTeamMap reads a JSON object mapping users to teams from a file.
+func loadTeamMap(path string) (map[string]string, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var teams map[string]string
+	if err := json.Unmarshal(buf, &teams); err != nil {
+		return nil, fmt.Errorf("parsing %s failed: %v", path, err)
+	}
+	return teams, nil
+}
+
+// team returns the team of a user, looked up by account ID, nickname and
+// display name in turn.
+func (w *workspace) team(u prUser) (string, bool) {
+	for _, key := range []string{u.AccountID, u.Nickname, u.DisplayName} {
+		if key == "" {
+			continue
+		}
+		if team, ok := w.teams[key]; ok {
+			return team, true
+		}
+	}
+	return "", false
+}
+
+// teamCoverage returns the teams of the reviewers of a pull request which
+// approved it, and those of which no reviewer approved it yet.  Reviewers
+// without a team are left out.
+func (w *workspace) teamCoverage(pr pullRequest) (approved, pending []string) {
+	approvedTeams := make(map[string]bool)
+	reviewerTeams := make(map[string]bool)
+	for _, p := range pr.Participants {
+		if !w.isReviewer(p) {
+			continue
+		}
+		team, ok := w.team(p.User)
+		if !ok {
+			continue
+		}
+		reviewerTeams[team] = true
+		if p.Approved {
+			approvedTeams[team] = true
+		}
+	}
+	for team := range reviewerTeams {
+		if approvedTeams[team] {
+			approved = append(approved, team)
+		} else {
+			pending = append(pending, team)
+		}
+	}
+	sort.Strings(approved)
+	sort.Strings(pending)
+	return approved, pending
+}
+
+// crossTeamReviewed returns whether a reviewer of another team than the
+// author approved the pull request.  It is not known when the team of the
+// author is not, or no reviewer of a known team approved yet.
+func (w *workspace) crossTeamReviewed(pr pullRequest) (reviewed, known bool) {
+	author, ok := w.team(pr.Author)
+	if !ok {
+		return false, false
+	}
+	approved, _ := w.teamCoverage(pr)
+	for _, team := range approved {
+		if team != author {
+			return true, true
+		}
+	}
+	return false, len(approved) > 0
+}
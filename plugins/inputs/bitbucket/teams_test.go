@@ -0,0 +1,104 @@
+package bitbucket
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserTeamMap(t *testing.T) {
+	f, err := ioutil.TempFile("", "teams")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`{"557058:1": "platform", "jdoe": "web"}`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	b := newTestBitbucket(t, "")
+	b.UserTeamMapFile = f.Name()
+	b.UserTeamMap = map[string]string{"557058:1": "payments"}
+	require.NoError(t, b.Init())
+
+	w := &workspace{WorkspaceConfig: b.WorkspaceConfig, teams: b.teams}
+	var acc testutil.Accumulator
+	now := time.Now()
+	w.addPullRequest(&acc, repository{Slug: "api"}, pullRequest{ID: 1, Author: prUser{AccountID: "557058:1"}}, now)
+	w.addPullRequest(&acc, repository{Slug: "api"}, pullRequest{ID: 2, Author: prUser{AccountID: "557058:2", Nickname: "jdoe"}}, now)
+	w.addPullRequest(&acc, repository{Slug: "api"}, pullRequest{ID: 3, Author: prUser{DisplayName: "Erika"}}, now)
+
+	teams := make(map[int64]string)
+	for _, m := range acc.Metrics {
+		teams[m.Fields["id"].(int64)] = m.Tags["team"]
+	}
+	require.Equal(t, map[int64]string{1: "payments", 2: "web", 3: ""}, teams)
+}
+
+func TestUserTeamMapFileInvalid(t *testing.T) {
+	b := newTestBitbucket(t, "")
+	b.UserTeamMapFile = "testdata/does-not-exist.json"
+	require.Error(t, b.Init())
+}
+
+func TestTeamCoverage(t *testing.T) {
+	w := &workspace{
+		userField: "display_name",
+		teams: map[string]string{
+			"Jane": "payments",
+			"John": "payments",
+			"Max":  "platform",
+			"Eva":  "security",
+		},
+	}
+	pr := pullRequest{
+		Author: prUser{DisplayName: "Jane"},
+		Participants: []participant{
+			{Role: "REVIEWER", User: prUser{DisplayName: "John"}, Approved: true},
+			{Role: "REVIEWER", User: prUser{DisplayName: "Max"}},
+			{Role: "REVIEWER", User: prUser{DisplayName: "Eva"}},
+			{Role: "REVIEWER", User: prUser{DisplayName: "Erika"}, Approved: true},
+			{Role: "PARTICIPANT", User: prUser{DisplayName: "Eva"}, Approved: true},
+		},
+	}
+
+	approved, pending := w.teamCoverage(pr)
+	require.Equal(t, []string{"payments"}, approved)
+	require.Equal(t, []string{"platform", "security"}, pending)
+
+	reviewed, known := w.crossTeamReviewed(pr)
+	require.False(t, reviewed)
+	require.True(t, known)
+
+	pr.Participants[1].Approved = true
+	reviewed, known = w.crossTeamReviewed(pr)
+	require.True(t, reviewed)
+	require.True(t, known)
+
+	_, known = w.crossTeamReviewed(pullRequest{Author: prUser{DisplayName: "Erika"}})
+	require.False(t, known)
+}
+
+func TestCrossTeamReviewRatio(t *testing.T) {
+	w := &workspace{
+		WorkspaceConfig: WorkspaceConfig{Workspace: "acme"},
+		teams:           map[string]string{"Jane": "payments", "John": "payments", "Max": "platform"},
+	}
+	approvedBy := func(name string) []participant {
+		return []participant{{Role: "REVIEWER", User: prUser{DisplayName: name}, Approved: true}}
+	}
+	prs := []pullRequest{
+		{ID: 1, Author: prUser{DisplayName: "Jane"}, Participants: approvedBy("Max")},
+		{ID: 2, Author: prUser{DisplayName: "Jane"}, Participants: approvedBy("John")},
+		{ID: 3, Author: prUser{DisplayName: "Jane"}, Participants: approvedBy("Max")},
+		{ID: 4, Author: prUser{DisplayName: "Jane"}},
+	}
+
+	var acc testutil.Accumulator
+	w.addPullRequestCount(&acc, repository{Slug: "api"}, prs, pullRequestTotals{}, time.Now())
+	ratio, ok := acc.FloatField(measurementPullRequestCount, "cross_team_review_ratio")
+	require.True(t, ok)
+	require.InDelta(t, 2.0/3.0, ratio, 1e-9)
+}
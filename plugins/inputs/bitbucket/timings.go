@@ -0,0 +1,51 @@
+package bitbucket
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// phase is a step of a workspace gather whose time is reported.
+type phase int
+
+const (
+	phaseMemberDiscovery phase = iota
+	phaseRepositoryDiscovery
+	phasePullRequestFetch
+	phaseAccumulation
+	numPhases
+)
+
+// gatherTimings sums the time spent in each phase during a gather.  Phases
+// running concurrently, such as the pull request listings of several
+// repositories, add up.
+type gatherTimings struct {
+	start  time.Time
+	phases [numPhases]int64
+}
+
+func newGatherTimings() *gatherTimings {
+	return &gatherTimings{start: time.Now()}
+}
+
+// track adds the time since start to a phase.  It is meant to be deferred
+// and does nothing outside of a gather.
+func (t *gatherTimings) track(p phase, start time.Time) {
+	if t == nil {
+		return
+	}
+	atomic.AddInt64(&t.phases[p], int64(time.Since(start)))
+}
+
+// record sets the internal statistics to the timings in milliseconds.
+func (t *gatherTimings) record(s *requestStats) {
+	if s == nil {
+		return
+	}
+	ms := func(ns int64) int64 { return ns / int64(time.Millisecond) }
+	s.gatherDuration.Set(ms(int64(time.Since(t.start))))
+	s.memberDiscovery.Set(ms(atomic.LoadInt64(&t.phases[phaseMemberDiscovery])))
+	s.repositoryDiscovery.Set(ms(atomic.LoadInt64(&t.phases[phaseRepositoryDiscovery])))
+	s.pullRequestFetch.Set(ms(atomic.LoadInt64(&t.phases[phasePullRequestFetch])))
+	s.accumulation.Set(ms(atomic.LoadInt64(&t.phases[phaseAccumulation])))
+}
@@ -0,0 +1,63 @@
+package bitbucket
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+// truncation counts the repositories whose pull requests were cut short by
+// max_prs_per_repo, max_pages or max_pull_request_requests during a gather,
+// along with the pull requests left out.
+type truncation struct {
+	mu           sync.Mutex
+	repositories int
+	skipped      int
+}
+
+func (t *truncation) add(skipped int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.repositories++
+	t.skipped += skipped
+}
+
+func (t *truncation) fields() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return map[string]interface{}{
+		"truncated":              t.repositories > 0,
+		"truncated_repositories": t.repositories,
+		"skipped_pull_requests":  t.skipped,
+	}
+}
+
+// countPullRequests returns the number of pull requests matching the
+// listing parameters which were updated since the given time, fetching
+// nothing but the count.  The listing applies the lookback window while
+// paging, the count has it added to the query so both count the same pull
+// requests.
+func (w *workspace) countPullRequests(ctx context.Context, repo repository, params url.Values, since time.Time) (int, error) {
+	counted := url.Values{"fields": {"size"}}
+	for _, key := range []string{"state", "q"} {
+		if v, ok := params[key]; ok {
+			counted[key] = v
+		}
+	}
+	if !since.IsZero() {
+		q := "updated_on >= " + since.UTC().Format(time.RFC3339)
+		if query := counted.Get("q"); query != "" {
+			q = "(" + query + ") AND " + q
+		}
+		counted.Set("q", q)
+	}
+
+	var page struct {
+		Size int `json:"size"`
+	}
+	err := w.client.Get(ctx, bitbucketapi.PullRequestsPath(w.Workspace, repo.Slug), counted, &page)
+	return page.Size, err
+}
@@ -0,0 +1,95 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+type webhook struct {
+	UUID        string   `json:"uuid"`
+	Description string   `json:"description"`
+	Active      bool     `json:"active"`
+	Events      []string `json:"events"`
+}
+
+// webhookDelivery is a single entry of the delivery history of a webhook.
+type webhookDelivery struct {
+	Response *struct {
+		StatusCode int `json:"status_code"`
+	} `json:"response"`
+}
+
+func (d webhookDelivery) failed() bool {
+	return d.Response == nil || d.Response.StatusCode < 200 || d.Response.StatusCode >= 300
+}
+
+// gatherWebhooks reports the webhooks of a repository.  Delivery failures are
+// counted from the recent delivery history when the API exposes it for the
+// hook.
+func (w *workspace) gatherWebhooks(ctx context.Context, acc telegraf.Accumulator, repo repository) error {
+	var hooks []webhook
+	err := w.client.GetPages(ctx, bitbucketapi.HooksPath(w.Workspace, repo.Slug), url.Values{"pagelen": {"100"}},
+		func(values json.RawMessage) error {
+			var p []webhook
+			if err := json.Unmarshal(values, &p); err != nil {
+				return err
+			}
+			hooks = append(hooks, p...)
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("gathering webhooks of %s failed: %v", repo.Slug, err)
+	}
+
+	for _, hook := range hooks {
+		fields := map[string]interface{}{
+			"active": hook.Active,
+			"events": len(hook.Events),
+		}
+
+		deliveries, err := w.getWebhookDeliveries(bitbucketapi.ExpectStatus(ctx, http.StatusNotFound), repo, hook)
+		if bitbucketapi.IsStatus(err, http.StatusNotFound) {
+			w.Log.Debugf("No delivery history available for webhook %s of %s", hook.UUID, repo.Slug)
+		} else if err != nil {
+			acc.AddError(fmt.Errorf("gathering deliveries of webhook %s of %s failed: %v", hook.UUID, repo.Slug, err))
+		} else {
+			var failures int
+			for _, d := range deliveries {
+				if d.failed() {
+					failures++
+				}
+			}
+			fields["deliveries"] = len(deliveries)
+			fields["failures"] = failures
+		}
+
+		tags := w.repositoryTags(repo)
+		tags["hook"] = hook.UUID
+		tags["description"] = hook.Description
+		acc.AddFields(measurementWebhook, fields, tags, time.Now())
+	}
+	return nil
+}
+
+// getWebhookDeliveries returns the most recent page of the delivery history of
+// a webhook.
+func (w *workspace) getWebhookDeliveries(ctx context.Context, repo repository, hook webhook) ([]webhookDelivery, error) {
+	var p bitbucketapi.Page
+	path := bitbucketapi.HookPath(w.Workspace, repo.Slug, hook.UUID) + "/requests"
+	if err := w.client.Get(ctx, path, nil, &p); err != nil {
+		return nil, err
+	}
+
+	var deliveries []webhookDelivery
+	if err := json.Unmarshal(p.Values, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,41 @@
+package bitbucket
+
+import (
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherWebhooks(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme/api": `{"slug": "api"}`,
+		"/repositories/acme/api/hooks": `{
+			"values": [
+				{"uuid": "{hook-1}", "description": "CI", "active": true, "events": ["repo:push", "pullrequest:created"]},
+				{"uuid": "{hook-2}", "description": "Chat", "active": false, "events": ["repo:push"]}
+			]
+		}`,
+		"/repositories/acme/api/hooks/{hook-1}/requests": `{
+			"values": [
+				{"response": {"status_code": 200}},
+				{"response": {"status_code": 500}},
+				{}
+			]
+		}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.Repositories = []string{"api"}
+	b.GatherWebhooks = true
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_webhook",
+		map[string]interface{}{"active": true, "events": 2, "deliveries": 3, "failures": 2},
+		map[string]string{"workspace": "acme", "repository": "api", "hook": "{hook-1}", "description": "CI"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_webhook",
+		map[string]interface{}{"active": false, "events": 1},
+		map[string]string{"workspace": "acme", "repository": "api", "hook": "{hook-2}", "description": "Chat"})
+}
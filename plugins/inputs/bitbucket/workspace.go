@@ -0,0 +1,177 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/bitbucketapi"
+)
+
+type user struct {
+	DisplayName string `json:"display_name"`
+	AccountID   string `json:"account_id"`
+
+	// HasTwoFactor is only present when the workspace exposes the security
+	// attributes of its members.
+	HasTwoFactor *bool `json:"has_2fa_enabled"`
+}
+
+type member struct {
+	User user `json:"user"`
+}
+
+func (w *workspace) workspacePath() string {
+	return bitbucketapi.WorkspacePath(w.Workspace)
+}
+
+// getMembers returns the members of the workspace.
+func (w *workspace) getMembers(ctx context.Context) ([]member, error) {
+	defer w.timings.track(phaseMemberDiscovery, time.Now())
+
+	var members []member
+	err := w.client.GetPages(ctx, w.workspacePath()+"/members", url.Values{"pagelen": {"100"}},
+		func(values json.RawMessage) error {
+			var p []member
+			if err := json.Unmarshal(values, &p); err != nil {
+				return err
+			}
+			members = append(members, p...)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("listing members of %s failed: %v", w.Workspace, err)
+	}
+	return members, nil
+}
+
+// gatherTwoStepVerification reports whether the workspace members have
+// two-step verification enabled, along with the share of compliant members.
+// Members without the attribute are only counted as unknown.
+func (w *workspace) gatherTwoStepVerification(ctx context.Context, acc telegraf.Accumulator) error {
+	members, err := w.getMembers(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var enabled, disabled, unknown int
+	for _, m := range members {
+		if m.User.HasTwoFactor == nil {
+			unknown++
+			continue
+		}
+		if *m.User.HasTwoFactor {
+			enabled++
+		} else {
+			disabled++
+		}
+
+		tags := map[string]string{
+			"workspace": w.Workspace,
+			"user":      m.User.DisplayName,
+		}
+		fields := map[string]interface{}{
+			"account_id": m.User.AccountID,
+			"has_2sv":    *m.User.HasTwoFactor,
+		}
+		acc.AddFields(measurementMember, fields, tags, now)
+	}
+
+	tags := map[string]string{
+		"workspace": w.Workspace,
+	}
+	fields := map[string]interface{}{
+		"enabled":  enabled,
+		"disabled": disabled,
+		"unknown":  unknown,
+	}
+	if enabled+disabled > 0 {
+		fields["compliance_ratio"] = float64(enabled) / float64(enabled+disabled)
+	}
+	acc.AddFields(measurementTwoStep, fields, tags, now)
+	return nil
+}
+
+// gatherSecuritySettings reports the boolean attributes of the workspace,
+// such as whether it is private or, on Premium plans, whether IP allowlisting
+// is enabled.  Attributes are reported as they are exposed by the API so that
+// settings only present on some plans are picked up as well.
+func (w *workspace) gatherSecuritySettings(ctx context.Context, acc telegraf.Accumulator) error {
+	var settings map[string]interface{}
+	if err := w.client.Get(ctx, w.workspacePath(), nil, &settings); err != nil {
+		return fmt.Errorf("gathering settings of %s failed: %v", w.Workspace, err)
+	}
+
+	fields := make(map[string]interface{})
+	for key, value := range settings {
+		if v, ok := value.(bool); ok {
+			fields[key] = v
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	tags := map[string]string{
+		"workspace": w.Workspace,
+	}
+	acc.AddFields(measurementWorkspace, fields, tags, time.Now())
+	return nil
+}
+
+type oauthConsumer struct {
+	Name        string   `json:"name"`
+	CallbackURL string   `json:"callback_url"`
+	Scopes      []string `json:"scopes"`
+}
+
+// gatherOAuthConsumers reports the OAuth consumers registered in the
+// workspace and the breadth of the scopes each of them was granted.
+func (w *workspace) gatherOAuthConsumers(ctx context.Context, acc telegraf.Accumulator) error {
+	var consumers []oauthConsumer
+	err := w.client.GetPages(ctx, w.workspacePath()+"/consumers", url.Values{"pagelen": {"100"}},
+		func(values json.RawMessage) error {
+			var p []oauthConsumer
+			if err := json.Unmarshal(values, &p); err != nil {
+				return err
+			}
+			consumers = append(consumers, p...)
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("listing OAuth consumers of %s failed: %v", w.Workspace, err)
+	}
+
+	now := time.Now()
+	var withCallback int
+	for _, c := range consumers {
+		hasCallback := c.CallbackURL != ""
+		if hasCallback {
+			withCallback++
+		}
+
+		tags := map[string]string{
+			"workspace": w.Workspace,
+			"consumer":  c.Name,
+		}
+		fields := map[string]interface{}{
+			"scopes":           len(c.Scopes),
+			"has_callback_url": hasCallback,
+		}
+		acc.AddFields(measurementOAuthConsumer, fields, tags, now)
+	}
+
+	tags := map[string]string{
+		"workspace": w.Workspace,
+	}
+	fields := map[string]interface{}{
+		"count":             len(consumers),
+		"with_callback_url": withCallback,
+	}
+	acc.AddFields(measurementOAuthConsumers, fields, tags, now)
+	return nil
+}
@@ -0,0 +1,107 @@
+package bitbucket
+
+import (
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherTwoStepVerification(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme": `{"values": []}`,
+		"/workspaces/acme/members": `{
+			"values": [
+				{"user": {"display_name": "Jane Doe", "account_id": "557058:1", "has_2fa_enabled": true}},
+				{"user": {"display_name": "John Doe", "account_id": "557058:2", "has_2fa_enabled": false}},
+				{"user": {"display_name": "Erika Mustermann", "account_id": "557058:3", "has_2fa_enabled": true}},
+				{"user": {"display_name": "Max Mustermann", "account_id": "557058:4"}}
+			]
+		}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.GatherTwoStep = true
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_member",
+		map[string]interface{}{"account_id": "557058:2", "has_2sv": false},
+		map[string]string{"workspace": "acme", "user": "John Doe"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_two_step_verification",
+		map[string]interface{}{"enabled": 2, "disabled": 1, "unknown": 1, "compliance_ratio": 2.0 / 3.0},
+		map[string]string{"workspace": "acme"})
+	require.Len(t, acc.Metrics, 5) // including bitbucket_up
+}
+
+func TestGatherTwoStepVerificationNotExposed(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme": `{"values": []}`,
+		"/workspaces/acme/members": `{
+			"values": [{"user": {"display_name": "Jane Doe", "account_id": "557058:1"}}]
+		}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.GatherTwoStep = true
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_two_step_verification",
+		map[string]interface{}{"enabled": 0, "disabled": 0, "unknown": 1},
+		map[string]string{"workspace": "acme"})
+	acc.AssertDoesNotContainMeasurement(t, "bitbucket_member")
+}
+
+func TestGatherSecuritySettings(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme": `{"values": []}`,
+		"/workspaces/acme": `{
+			"slug": "acme",
+			"name": "Acme",
+			"is_private": true,
+			"ip_allowlist_enabled": false,
+			"links": {"self": {"href": "https://api.bitbucket.org/2.0/workspaces/acme"}}
+		}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.GatherSecurity = true
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_workspace",
+		map[string]interface{}{"is_private": true, "ip_allowlist_enabled": false},
+		map[string]string{"workspace": "acme"})
+}
+
+func TestGatherOAuthConsumers(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"/repositories/acme": `{"values": []}`,
+		"/workspaces/acme/consumers": `{
+			"values": [
+				{"name": "Deploy bot", "scopes": ["repository", "pullrequest", "pipeline"]},
+				{"name": "Chat", "callback_url": "https://chat.example.com/callback", "scopes": ["repository"]}
+			]
+		}`,
+	})
+	defer ts.Close()
+
+	b := newTestBitbucket(t, ts.URL)
+	b.GatherConsumers = true
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(b.Gather))
+
+	acc.AssertContainsTaggedFields(t, "bitbucket_oauth_consumer",
+		map[string]interface{}{"scopes": 3, "has_callback_url": false},
+		map[string]string{"workspace": "acme", "consumer": "Deploy bot"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_oauth_consumer",
+		map[string]interface{}{"scopes": 1, "has_callback_url": true},
+		map[string]string{"workspace": "acme", "consumer": "Chat"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_oauth_consumers",
+		map[string]interface{}{"count": 2, "with_callback_url": 1},
+		map[string]string{"workspace": "acme"})
+}
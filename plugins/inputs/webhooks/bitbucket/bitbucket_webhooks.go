@@ -0,0 +1,212 @@
+package bitbucket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+)
+
+const meas = "bitbucket_webhooks"
+
+// maxDeliveries bounds the request UUIDs remembered to drop the retried
+// deliveries.
+const maxDeliveries = 10000
+
+// BitbucketWebhook receives the repository push events of Bitbucket Cloud
+// and reports the force pushes and deletions of branches.
+type BitbucketWebhook struct {
+	Path              string   `toml:"path"`
+	Secret            string   `toml:"secret"`
+	ProtectedBranches []string `toml:"protected_branches"`
+
+	acc       telegraf.Accumulator
+	protected filter.Filter
+
+	mu         sync.Mutex
+	deliveries map[string]bool
+	order      []string
+}
+
+// Init compiles the protected branches, failing the start of the webhooks
+// input when they are missing or invalid.
+func (bb *BitbucketWebhook) Init() error {
+	if len(bb.ProtectedBranches) == 0 {
+		return fmt.Errorf("protected_branches of webhooks_bitbucket is required")
+	}
+	protected, err := filter.Compile(bb.ProtectedBranches)
+	if err != nil {
+		return fmt.Errorf("invalid protected_branches of webhooks_bitbucket: %v", err)
+	}
+	bb.protected = protected
+	return nil
+}
+
+func (bb *BitbucketWebhook) Register(router *mux.Router, acc telegraf.Accumulator) {
+	router.HandleFunc(bb.Path, bb.eventHandler).Methods("POST")
+	log.Printf("I! Started the webhooks_bitbucket on %s\n", bb.Path)
+	bb.acc = acc
+}
+
+type user struct {
+	DisplayName string `json:"display_name"`
+	AccountID   string `json:"account_id"`
+}
+
+type ref struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Target struct {
+		Hash string `json:"hash"`
+	} `json:"target"`
+}
+
+// PushEvent is the payload of the repo:push event.
+type PushEvent struct {
+	Actor      user `json:"actor"`
+	Repository struct {
+		FullName  string `json:"full_name"`
+		IsPrivate bool   `json:"is_private"`
+	} `json:"repository"`
+	Push struct {
+		Changes []struct {
+			Old    *ref `json:"old"`
+			New    *ref `json:"new"`
+			Forced bool `json:"forced"`
+			Closed bool `json:"closed"`
+		} `json:"changes"`
+	} `json:"push"`
+}
+
+func (bb *BitbucketWebhook) eventHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	eventKey := r.Header.Get("X-Event-Key")
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if bb.Secret != "" && !checkSignature(bb.Secret, data, r.Header.Get("X-Hub-Signature")) {
+		log.Printf("E! Fail to check the bitbucket webhook signature\n")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("D! New %v event received", eventKey)
+	if eventKey != "repo:push" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var e PushEvent
+	if err := json.Unmarshal(data, &e); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if bb.delivered(r.Header.Get("X-Request-UUID")) {
+		log.Printf("D! Ignoring the retried delivery %s", r.Header.Get("X-Request-UUID"))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	now := time.Now()
+	for _, m := range bb.metrics(e) {
+		bb.acc.AddFields(meas, m.fields, m.tags, now)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// delivered records the request UUID of a delivery and tells whether it was
+// already received.  Bitbucket retries the deliveries it considers failed
+// with the same UUID.  The oldest UUIDs are forgotten past maxDeliveries.
+func (bb *BitbucketWebhook) delivered(uuid string) bool {
+	if uuid == "" {
+		return false
+	}
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	if bb.deliveries[uuid] {
+		return true
+	}
+	if bb.deliveries == nil {
+		bb.deliveries = make(map[string]bool)
+	}
+	if len(bb.order) >= maxDeliveries {
+		delete(bb.deliveries, bb.order[0])
+		bb.order = bb.order[1:]
+	}
+	bb.deliveries[uuid] = true
+	bb.order = append(bb.order, uuid)
+	return false
+}
+
+type pushMetric struct {
+	tags   map[string]string
+	fields map[string]interface{}
+}
+
+// metrics returns the force pushes and deletions of the protected branches
+// among the changes of a push.  Without protected_branches no branch is
+// protected.
+func (bb *BitbucketWebhook) metrics(e PushEvent) []pushMetric {
+	var metrics []pushMetric
+	for _, c := range e.Push.Changes {
+		var event string
+		switch {
+		case c.Closed && c.Old != nil:
+			event = "branch_deletion"
+		case c.Forced && c.Old != nil && c.New != nil:
+			event = "force_push"
+		default:
+			continue
+		}
+		if c.Old.Type != "branch" {
+			continue
+		}
+		if bb.protected == nil || !bb.protected.Match(c.Old.Name) {
+			continue
+		}
+
+		tags := map[string]string{
+			"event":      event,
+			"repository": e.Repository.FullName,
+			"private":    strconv.FormatBool(e.Repository.IsPrivate),
+			"branch":     c.Old.Name,
+			"user":       e.Actor.DisplayName,
+		}
+		fields := map[string]interface{}{
+			"old_hash": c.Old.Target.Hash,
+		}
+		if c.New != nil {
+			fields["new_hash"] = c.New.Target.Hash
+		}
+		if e.Actor.AccountID != "" {
+			fields["user_account_id"] = e.Actor.AccountID
+		}
+		metrics = append(metrics, pushMetric{tags: tags, fields: fields})
+	}
+	return metrics
+}
+
+func checkSignature(secret string, data []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(generateSignature(secret, data)))
+}
+
+func generateSignature(secret string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	result := mac.Sum(nil)
+	return "sha256=" + hex.EncodeToString(result)
+}
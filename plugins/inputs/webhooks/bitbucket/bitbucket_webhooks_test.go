@@ -0,0 +1,133 @@
+package bitbucket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const pushEventJSON = `{
+	"actor": {"display_name": "Jane Doe", "account_id": "557058:1"},
+	"repository": {"full_name": "acme/api", "is_private": true},
+	"push": {"changes": [
+		{"old": {"type": "branch", "name": "master", "target": {"hash": "aaa"}},
+			"new": {"type": "branch", "name": "master", "target": {"hash": "bbb"}}, "forced": true},
+		{"old": {"type": "branch", "name": "release/1.0", "target": {"hash": "ccc"}},
+			"new": null, "closed": true},
+		{"old": {"type": "branch", "name": "feature/a", "target": {"hash": "ddd"}},
+			"new": {"type": "branch", "name": "feature/a", "target": {"hash": "eee"}}, "forced": true},
+		{"old": {"type": "branch", "name": "master", "target": {"hash": "bbb"}},
+			"new": {"type": "branch", "name": "master", "target": {"hash": "fff"}}},
+		{"old": {"type": "tag", "name": "v1.0", "target": {"hash": "ggg"}},
+			"new": null, "closed": true}
+	]}
+}`
+
+func bitbucketWebhookRequest(t *testing.T, bb *BitbucketWebhook, event, body, signature string) int {
+	return bitbucketWebhookDelivery(t, bb, event, body, signature, "")
+}
+
+func bitbucketWebhookDelivery(t *testing.T, bb *BitbucketWebhook, event, body, signature, uuid string) int {
+	req, err := http.NewRequest("POST", "/bitbucket", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Add("X-Event-Key", event)
+	if uuid != "" {
+		req.Header.Add("X-Request-UUID", uuid)
+	}
+	if signature != "" {
+		req.Header.Add("X-Hub-Signature", signature)
+	}
+	w := httptest.NewRecorder()
+	bb.eventHandler(w, req)
+	return w.Code
+}
+
+func TestPushEventProtectedBranches(t *testing.T) {
+	var acc testutil.Accumulator
+	protected, err := filter.Compile([]string{"master", "release/*"})
+	require.NoError(t, err)
+	bb := &BitbucketWebhook{Path: "/bitbucket", acc: &acc, protected: protected}
+
+	require.Equal(t, http.StatusOK, bitbucketWebhookRequest(t, bb, "repo:push", pushEventJSON, ""))
+	require.Len(t, acc.Metrics, 2)
+	acc.AssertContainsTaggedFields(t, "bitbucket_webhooks",
+		map[string]interface{}{"old_hash": "aaa", "new_hash": "bbb", "user_account_id": "557058:1"},
+		map[string]string{"event": "force_push", "repository": "acme/api", "private": "true", "branch": "master", "user": "Jane Doe"})
+	acc.AssertContainsTaggedFields(t, "bitbucket_webhooks",
+		map[string]interface{}{"old_hash": "ccc", "user_account_id": "557058:1"},
+		map[string]string{"event": "branch_deletion", "repository": "acme/api", "private": "true", "branch": "release/1.0", "user": "Jane Doe"})
+}
+
+func TestPushEventNoProtectedBranches(t *testing.T) {
+	var acc testutil.Accumulator
+	bb := &BitbucketWebhook{Path: "/bitbucket", acc: &acc}
+	require.Equal(t, http.StatusOK, bitbucketWebhookRequest(t, bb, "repo:push", pushEventJSON, ""))
+	require.Len(t, acc.Metrics, 0)
+}
+
+func TestPushEventRetriedDelivery(t *testing.T) {
+	var acc testutil.Accumulator
+	protected, err := filter.Compile([]string{"master"})
+	require.NoError(t, err)
+	bb := &BitbucketWebhook{Path: "/bitbucket", acc: &acc, protected: protected}
+
+	uuid := "0c4a5b0e-5f1c-4f5e-8d3b-2f7e4c6a9b10"
+	require.Equal(t, http.StatusOK, bitbucketWebhookDelivery(t, bb, "repo:push", pushEventJSON, "", uuid))
+	require.Equal(t, http.StatusOK, bitbucketWebhookDelivery(t, bb, "repo:push", pushEventJSON, "", uuid))
+	require.Len(t, acc.Metrics, 1)
+
+	require.Equal(t, http.StatusOK, bitbucketWebhookDelivery(t, bb, "repo:push", pushEventJSON, "", "another"))
+	require.Len(t, acc.Metrics, 2)
+}
+
+func TestRetriedDeliveriesBounded(t *testing.T) {
+	bb := &BitbucketWebhook{}
+	for i := 0; i < maxDeliveries+1; i++ {
+		require.False(t, bb.delivered(strconv.Itoa(i)))
+	}
+	require.Len(t, bb.deliveries, maxDeliveries)
+	require.False(t, bb.delivered("0"))
+	require.True(t, bb.delivered(strconv.Itoa(maxDeliveries)))
+}
+
+func TestOtherEventIgnored(t *testing.T) {
+	var acc testutil.Accumulator
+	bb := &BitbucketWebhook{Path: "/bitbucket", acc: &acc}
+	require.Equal(t, http.StatusOK, bitbucketWebhookRequest(t, bb, "pullrequest:created", `{}`, ""))
+	require.Len(t, acc.Metrics, 0)
+}
+
+func TestInvalidPushEvent(t *testing.T) {
+	var acc testutil.Accumulator
+	bb := &BitbucketWebhook{Path: "/bitbucket", acc: &acc}
+	require.Equal(t, http.StatusBadRequest, bitbucketWebhookRequest(t, bb, "repo:push", `{`, ""))
+}
+
+func TestSignature(t *testing.T) {
+	var acc testutil.Accumulator
+	bb := &BitbucketWebhook{Path: "/bitbucket", Secret: "signature", acc: &acc}
+
+	signature := generateSignature("signature", []byte(pushEventJSON))
+	require.Equal(t, http.StatusOK, bitbucketWebhookRequest(t, bb, "repo:push", pushEventJSON, signature))
+	require.Equal(t, http.StatusBadRequest, bitbucketWebhookRequest(t, bb, "repo:push", pushEventJSON, "sha256=00"))
+	require.Equal(t, http.StatusBadRequest, bitbucketWebhookRequest(t, bb, "repo:push", pushEventJSON, ""))
+}
+
+func TestInitInvalidProtectedBranches(t *testing.T) {
+	bb := &BitbucketWebhook{Path: "/bitbucket"}
+	require.Error(t, bb.Init())
+
+	bb.ProtectedBranches = []string{"release/["}
+	require.Error(t, bb.Init())
+
+	bb.ProtectedBranches = []string{"master"}
+	require.NoError(t, bb.Init())
+	require.True(t, bb.protected.Match("master"))
+	require.False(t, bb.protected.Match("feature"))
+}
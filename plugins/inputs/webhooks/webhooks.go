@@ -11,6 +11,7 @@ import (
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/plugins/inputs"
 
+	"github.com/influxdata/telegraf/plugins/inputs/webhooks/bitbucket"
 	"github.com/influxdata/telegraf/plugins/inputs/webhooks/filestack"
 	"github.com/influxdata/telegraf/plugins/inputs/webhooks/github"
 	"github.com/influxdata/telegraf/plugins/inputs/webhooks/mandrill"
@@ -30,6 +31,7 @@ func init() {
 type Webhooks struct {
 	ServiceAddress string
 
+	Bitbucket  *bitbucket.BitbucketWebhook
 	Github     *github.GithubWebhook
 	Filestack  *filestack.FilestackWebhook
 	Mandrill   *mandrill.MandrillWebhook
@@ -49,6 +51,11 @@ func (wb *Webhooks) SampleConfig() string {
   ## Address and port to host Webhook listener on
   service_address = ":1619"
 
+  [inputs.webhooks.bitbucket]
+    path = "/bitbucket"
+    # secret = ""
+    protected_branches = ["master"]
+
   [inputs.webhooks.filestack]
     path = "/filestack"
 
@@ -99,6 +106,18 @@ func (wb *Webhooks) AvailableWebhooks() []Webhook {
 	return webhooks
 }
 
+// Init validates the settings of the webhooks which have any.
+func (wb *Webhooks) Init() error {
+	for _, webhook := range wb.AvailableWebhooks() {
+		if initializer, ok := webhook.(telegraf.Initializer); ok {
+			if err := initializer.Init(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (wb *Webhooks) Start(acc telegraf.Accumulator) error {
 	r := mux.NewRouter()
 
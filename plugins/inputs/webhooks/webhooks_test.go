@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/influxdata/telegraf/plugins/inputs/webhooks/bitbucket"
 	"github.com/influxdata/telegraf/plugins/inputs/webhooks/github"
 	"github.com/influxdata/telegraf/plugins/inputs/webhooks/papertrail"
 	"github.com/influxdata/telegraf/plugins/inputs/webhooks/particle"
@@ -41,3 +42,16 @@ func TestAvailableWebhooks(t *testing.T) {
 		t.Errorf("expected to be %v.\nGot %v", expected, wb.AvailableWebhooks())
 	}
 }
+
+func TestInitValidatesWebhooks(t *testing.T) {
+	wb := NewWebhooks()
+	wb.Bitbucket = &bitbucket.BitbucketWebhook{Path: "/bitbucket", ProtectedBranches: []string{"release/["}}
+	if err := wb.Init(); err == nil {
+		t.Errorf("expected invalid protected_branches to fail Init")
+	}
+
+	wb.Bitbucket.ProtectedBranches = []string{"release/*"}
+	if err := wb.Init(); err != nil {
+		t.Errorf("expected valid protected_branches to pass Init, got %v", err)
+	}
+}
@@ -1,7 +1,9 @@
 package all
 
 import (
+	_ "github.com/influxdata/telegraf/plugins/processors/annotation"
 	_ "github.com/influxdata/telegraf/plugins/processors/clone"
+	_ "github.com/influxdata/telegraf/plugins/processors/code_review"
 	_ "github.com/influxdata/telegraf/plugins/processors/converter"
 	_ "github.com/influxdata/telegraf/plugins/processors/date"
 	_ "github.com/influxdata/telegraf/plugins/processors/enum"
@@ -0,0 +1,259 @@
+package annotation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+var sampleConfig = `
+  ## Name of the annotation measurement.
+  # measurement = "annotation"
+
+  ## Drop the metrics turned into annotations.
+  # drop_original = false
+
+  ## Events turned into annotations.  When no event is configured, merged
+  ## pull requests and failed pipelines of the bitbucket input are used.
+  # [[processors.annotation.event]]
+  #   ## Name of the event, reported as the event tag.
+  #   name = "merge"
+  #   ## Measurement of the metrics to turn into annotations.
+  #   measurement = "bitbucket_pull_request"
+  #   ## Title and text of the annotation, {key} is replaced by the value of
+  #   ## the tag or field key of the metric.
+  #   title = "Merged {repository}#{id}"
+  #   text = "{author} merged into {destination_branch}"
+  #   ## Tags of the metric kept on the annotation and listed in its tags
+  #   ## field, along with the event name.
+  #   tags = ["workspace", "repository"]
+  #   ## Integer field holding the Unix time in seconds of the event, the
+  #   ## annotation is made at the time of the metric when not set.
+  #   time_field = "merged_on"
+  #   ## Tag or field key whose value identifies the event along with the
+  #   ## values of the tags above, such as the pull request ID within its
+  #   ## repository.  Only the first metric of each is turned into an
+  #   ## annotation.
+  #   dedupe = "id"
+  #
+  #   ## Values the tags or string fields of the metric must have.
+  #   [processors.annotation.event.match]
+  #     state = "MERGED"
+`
+
+// Event turns the matching metrics of one measurement into annotations.
+type Event struct {
+	Name        string            `toml:"name"`
+	Measurement string            `toml:"measurement"`
+	Match       map[string]string `toml:"match"`
+	Title       string            `toml:"title"`
+	Text        string            `toml:"text"`
+	Tags        []string          `toml:"tags"`
+	TimeField   string            `toml:"time_field"`
+	Dedupe      string            `toml:"dedupe"`
+}
+
+// maxSeen bounds the number of event identifiers remembered for dedupe, the
+// oldest are forgotten first.
+const maxSeen = 10000
+
+// Annotation turns selected metrics, such as merges or pipeline failures,
+// into annotation metrics for dashboards.
+type Annotation struct {
+	Measurement  string  `toml:"measurement"`
+	DropOriginal bool    `toml:"drop_original"`
+	Events       []Event `toml:"event"`
+
+	events map[string][]Event
+
+	// seen holds the identifiers of the events annotated, in order.
+	seen     map[string]bool
+	seenList []string
+}
+
+// defaultEvents holds the events used when none are configured.
+var defaultEvents = []Event{
+	{
+		Name:        "merge",
+		Measurement: "bitbucket_pull_request",
+		Match:       map[string]string{"state": "MERGED"},
+		Title:       "Merged {repository}#{id}",
+		Text:        "{author} merged into {destination_branch}",
+		Tags:        []string{"workspace", "repository"},
+		TimeField:   "merged_on",
+		Dedupe:      "id",
+	},
+	{
+		Name:        "pipeline_failure",
+		Measurement: "bitbucket_pull_request",
+		Match:       map[string]string{"ci_state": "failed"},
+		Title:       "Pipeline failed for {repository}#{id}",
+		Text:        "Pipeline of the source commit failed",
+		Tags:        []string{"workspace", "repository"},
+		Dedupe:      "ci_pipeline_uuid",
+	},
+}
+
+func (a *Annotation) SampleConfig() string {
+	return sampleConfig
+}
+
+func (a *Annotation) Description() string {
+	return "Turn selected metrics, such as merges and pipeline failures, into annotations."
+}
+
+func (a *Annotation) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	if a.events == nil {
+		events := a.Events
+		if len(events) == 0 {
+			events = defaultEvents
+		}
+		a.events = make(map[string][]Event)
+		for _, e := range events {
+			a.events[e.Measurement] = append(a.events[e.Measurement], e)
+		}
+	}
+
+	out := make([]telegraf.Metric, 0, len(in))
+	for _, m := range in {
+		var matched bool
+		for _, e := range a.events[m.Name()] {
+			if !matches(m, e.Match) {
+				continue
+			}
+			matched = true
+			if a.duplicate(m, e) {
+				continue
+			}
+			if annotation := a.annotate(m, e); annotation != nil {
+				out = append(out, annotation)
+			}
+		}
+		if matched && a.DropOriginal {
+			m.Drop()
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// matches returns whether the metric has the tag or string field values.
+func matches(m telegraf.Metric, match map[string]string) bool {
+	for key, want := range match {
+		value, ok := m.GetTag(key)
+		if !ok {
+			field, _ := m.GetField(key)
+			value, ok = field.(string)
+		}
+		if !ok || value != want {
+			return false
+		}
+	}
+	return true
+}
+
+// duplicate returns whether the event identified by the dedupe key of the
+// metric, within the values of the tags of the event, was annotated already,
+// remembering it otherwise.  Metrics without the key are never duplicates.
+func (a *Annotation) duplicate(m telegraf.Metric, e Event) bool {
+	if e.Dedupe == "" {
+		return false
+	}
+	value, ok := m.GetTag(e.Dedupe)
+	if !ok {
+		field, ok := m.GetField(e.Dedupe)
+		if !ok {
+			return false
+		}
+		value = fmt.Sprint(field)
+	}
+
+	key := e.Name
+	for _, tag := range e.Tags {
+		v, _ := m.GetTag(tag)
+		key += "\x00" + v
+	}
+	key += "\x00" + value
+	if a.seen[key] {
+		return true
+	}
+	if a.seen == nil {
+		a.seen = make(map[string]bool)
+	}
+	if len(a.seenList) >= maxSeen {
+		delete(a.seen, a.seenList[0])
+		a.seenList = a.seenList[1:]
+	}
+	a.seen[key] = true
+	a.seenList = append(a.seenList, key)
+	return false
+}
+
+// eventTime returns the time of the event, from the time field when set and
+// present, the time of the metric otherwise.
+func eventTime(m telegraf.Metric, e Event) time.Time {
+	if e.TimeField != "" {
+		switch v := m.Fields()[e.TimeField].(type) {
+		case int64:
+			return time.Unix(v, 0)
+		case uint64:
+			return time.Unix(int64(v), 0)
+		}
+	}
+	return m.Time()
+}
+
+// annotate returns the annotation of the event for the metric, at the time
+// of the event.
+func (a *Annotation) annotate(m telegraf.Metric, e Event) telegraf.Metric {
+	tags := map[string]string{"event": e.Name}
+	list := []string{e.Name}
+	for _, key := range e.Tags {
+		if value, ok := m.GetTag(key); ok {
+			tags[key] = value
+			list = append(list, value)
+		}
+	}
+	fields := map[string]interface{}{
+		"title": expand(e.Title, m),
+		"text":  expand(e.Text, m),
+		"tags":  strings.Join(list, ","),
+	}
+
+	annotation, err := metric.New(a.Measurement, tags, fields, eventTime(m, e))
+	if err != nil {
+		return nil
+	}
+	return annotation
+}
+
+var placeholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// expand replaces the {key} placeholders of a template by the tag or field
+// values of the metric, missing ones by nothing.
+func expand(template string, m telegraf.Metric) string {
+	return placeholder.ReplaceAllStringFunc(template, func(s string) string {
+		key := s[1 : len(s)-1]
+		if value, ok := m.GetTag(key); ok {
+			return value
+		}
+		if value, ok := m.GetField(key); ok {
+			return fmt.Sprint(value)
+		}
+		return ""
+	})
+}
+
+func init() {
+	processors.Add("annotation", func() telegraf.Processor {
+		return &Annotation{
+			Measurement: "annotation",
+		}
+	})
+}
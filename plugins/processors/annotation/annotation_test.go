@@ -0,0 +1,144 @@
+package annotation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newMetric(name string, tags map[string]string, fields map[string]interface{}) telegraf.Metric {
+	m, _ := metric.New(name, tags, fields, time.Unix(0, 0))
+	return m
+}
+
+func TestDefaultBitbucketEvents(t *testing.T) {
+	a := &Annotation{Measurement: "annotation"}
+
+	merged := newMetric("bitbucket_pull_request",
+		map[string]string{
+			"workspace":          "acme",
+			"repository":         "api",
+			"state":              "MERGED",
+			"author":             "Jane Doe",
+			"destination_branch": "master",
+		},
+		map[string]interface{}{"id": int64(42)})
+	failed := newMetric("bitbucket_pull_request",
+		map[string]string{"workspace": "acme", "repository": "web", "state": "OPEN"},
+		map[string]interface{}{"id": int64(7), "ci_state": "failed"})
+	open := newMetric("bitbucket_pull_request",
+		map[string]string{"workspace": "acme", "repository": "web", "state": "OPEN"},
+		map[string]interface{}{"id": int64(8), "ci_state": "successful"})
+
+	expected := []telegraf.Metric{
+		newMetric("annotation",
+			map[string]string{"event": "merge", "workspace": "acme", "repository": "api"},
+			map[string]interface{}{
+				"title": "Merged api#42",
+				"text":  "Jane Doe merged into master",
+				"tags":  "merge,acme,api",
+			}),
+		merged,
+		newMetric("annotation",
+			map[string]string{"event": "pipeline_failure", "workspace": "acme", "repository": "web"},
+			map[string]interface{}{
+				"title": "Pipeline failed for web#7",
+				"text":  "Pipeline of the source commit failed",
+				"tags":  "pipeline_failure,acme,web",
+			}),
+		failed,
+		open,
+	}
+
+	testutil.RequireMetricsEqual(t, expected, a.Apply(merged, failed, open))
+}
+
+func TestConfiguredEventDropOriginal(t *testing.T) {
+	a := &Annotation{
+		Measurement:  "events",
+		DropOriginal: true,
+		Events: []Event{
+			{
+				Name:        "deployment",
+				Measurement: "deployment",
+				Match:       map[string]string{"environment": "production"},
+				Title:       "Deployed {version}",
+				Text:        "{missing}by {user}",
+				Tags:        []string{"environment", "service"},
+			},
+		},
+	}
+
+	production := newMetric("deployment",
+		map[string]string{"environment": "production", "user": "jdoe"},
+		map[string]interface{}{"version": "1.2.0"})
+	staging := newMetric("deployment",
+		map[string]string{"environment": "staging"},
+		map[string]interface{}{"version": "1.3.0"})
+
+	expected := []telegraf.Metric{
+		newMetric("events",
+			map[string]string{"event": "deployment", "environment": "production"},
+			map[string]interface{}{
+				"title": "Deployed 1.2.0",
+				"text":  "by jdoe",
+				"tags":  "deployment,production",
+			}),
+		staging,
+	}
+
+	testutil.RequireMetricsEqual(t, expected, a.Apply(production, staging))
+}
+
+func TestDefaultEventTimeAndDedupe(t *testing.T) {
+	a := &Annotation{Measurement: "annotation"}
+	merged := time.Date(2020, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	m := newMetric("bitbucket_pull_request",
+		map[string]string{"workspace": "acme", "repository": "api", "state": "MERGED"},
+		map[string]interface{}{"id": int64(42), "merged_on": merged.Unix()})
+	out := a.Apply(m)
+	require.Len(t, out, 2)
+	require.Equal(t, "annotation", out[0].Name())
+	require.True(t, merged.Equal(out[0].Time()))
+
+	// The merge is reported again in the next gather, and a merge of the
+	// same ID in another repository.
+	require.Len(t, a.Apply(m.Copy()), 1)
+	other := newMetric("bitbucket_pull_request",
+		map[string]string{"workspace": "acme", "repository": "web", "state": "MERGED"},
+		map[string]interface{}{"id": int64(42), "merged_on": merged.Unix()})
+	require.Len(t, a.Apply(other), 2)
+
+	// A failed pipeline is reported in every gather until the pull request
+	// is updated, it is annotated once.
+	failed := func(pipeline string) telegraf.Metric {
+		return newMetric("bitbucket_pull_request",
+			map[string]string{"workspace": "acme", "repository": "web", "state": "OPEN"},
+			map[string]interface{}{"id": int64(7), "ci_state": "failed", "ci_pipeline_uuid": pipeline})
+	}
+	var annotations int
+	for _, pipeline := range []string{"{p1}", "{p1}", "{p2}", "{p1}"} {
+		for _, m := range a.Apply(failed(pipeline)) {
+			if m.Name() == "annotation" {
+				annotations++
+			}
+		}
+	}
+	require.Equal(t, 2, annotations)
+}
+
+func TestDedupeForgetsOldest(t *testing.T) {
+	a := &Annotation{Measurement: "annotation"}
+	e := Event{Name: "failure", Dedupe: "id"}
+	for i := 0; i <= maxSeen; i++ {
+		require.False(t, a.duplicate(newMetric("m", nil, map[string]interface{}{"id": int64(i)}), e))
+	}
+	require.Len(t, a.seen, maxSeen)
+	require.False(t, a.duplicate(newMetric("m", nil, map[string]interface{}{"id": int64(0)}), e))
+	require.True(t, a.duplicate(newMetric("m", nil, map[string]interface{}{"id": int64(maxSeen)}), e))
+}
@@ -0,0 +1,150 @@
+package code_review
+
+import (
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/processors"
+)
+
+var sampleConfig = `
+  ## Name of the canonical measurement.
+  # measurement = "code_review"
+
+  ## Drop the tags and fields which are not part of a mapping.
+  # drop_unmapped = false
+
+  ## Mappings of the source measurements to the canonical schema.  When no
+  ## source is configured the built-in mapping of the bitbucket input is used.
+  # [[processors.code_review.source]]
+  #   ## Measurement to normalize.
+  #   measurement = "bitbucket_pull_request"
+  #   ## Value of the provider tag added to the normalized metrics.
+  #   provider = "bitbucket"
+  #
+  #   ## Renames of source tags to canonical tags.
+  #   [processors.code_review.source.tags]
+  #     workspace = "owner"
+  #     destination_branch = "target_branch"
+  #
+  #   ## Renames of source fields to canonical fields.
+  #   [processors.code_review.source.fields]
+  #     comment_count = "comments"
+`
+
+// Source maps the metrics of one input to the canonical schema.
+type Source struct {
+	Measurement string            `toml:"measurement"`
+	Provider    string            `toml:"provider"`
+	Tags        map[string]string `toml:"tags"`
+	Fields      map[string]string `toml:"fields"`
+}
+
+// CodeReview normalizes the pull request metrics of SCM inputs into a
+// single measurement.
+type CodeReview struct {
+	Measurement  string   `toml:"measurement"`
+	DropUnmapped bool     `toml:"drop_unmapped"`
+	Sources      []Source `toml:"source"`
+
+	sources map[string]Source
+}
+
+// defaultSources holds the mappings used when none are configured.
+var defaultSources = []Source{
+	{
+		Measurement: "bitbucket_pull_request",
+		Provider:    "bitbucket",
+		Tags: map[string]string{
+			"workspace":          "owner",
+			"repository":         "repository",
+			"state":              "state",
+			"author":             "author",
+			"destination_branch": "target_branch",
+		},
+		Fields: map[string]string{
+			"id":            "id",
+			"age":           "age",
+			"time_to_merge": "time_to_merge",
+			"comment_count": "comments",
+			"approvals":     "approvals",
+			"lines_changed": "lines_changed",
+		},
+	},
+}
+
+func (c *CodeReview) SampleConfig() string {
+	return sampleConfig
+}
+
+func (c *CodeReview) Description() string {
+	return "Normalize the pull request metrics of SCM inputs into a common code_review measurement."
+}
+
+func (c *CodeReview) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	if c.sources == nil {
+		sources := c.Sources
+		if len(sources) == 0 {
+			sources = defaultSources
+		}
+		c.sources = make(map[string]Source, len(sources))
+		for _, s := range sources {
+			c.sources[s.Measurement] = s
+		}
+	}
+
+	for _, m := range in {
+		source, ok := c.sources[m.Name()]
+		if !ok {
+			continue
+		}
+		c.normalize(m, source)
+	}
+	return in
+}
+
+func (c *CodeReview) normalize(m telegraf.Metric, source Source) {
+	m.SetName(c.Measurement)
+
+	// Copy the tags and fields first, as renaming modifies the lists.
+	tags := m.Tags()
+	fields := m.Fields()
+
+	for key, value := range tags {
+		dest, ok := source.Tags[key]
+		if !ok {
+			if c.DropUnmapped {
+				m.RemoveTag(key)
+			}
+			continue
+		}
+		if dest != key {
+			m.RemoveTag(key)
+			m.AddTag(dest, value)
+		}
+	}
+
+	for key, value := range fields {
+		dest, ok := source.Fields[key]
+		if !ok {
+			if c.DropUnmapped {
+				m.RemoveField(key)
+			}
+			continue
+		}
+		if dest != key {
+			m.RemoveField(key)
+			m.AddField(dest, value)
+		}
+	}
+
+	if source.Provider != "" {
+		m.AddTag("provider", source.Provider)
+	}
+}
+
+func init() {
+	processors.Add("code_review", func() telegraf.Processor {
+		return &CodeReview{
+			Measurement: "code_review",
+		}
+	})
+}
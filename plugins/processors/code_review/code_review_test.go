@@ -0,0 +1,87 @@
+package code_review
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+)
+
+func newMetric(name string, tags map[string]string, fields map[string]interface{}) telegraf.Metric {
+	m, _ := metric.New(name, tags, fields, time.Unix(0, 0))
+	return m
+}
+
+func TestDefaultBitbucketMapping(t *testing.T) {
+	c := &CodeReview{Measurement: "code_review"}
+
+	in := newMetric("bitbucket_pull_request",
+		map[string]string{
+			"workspace":          "acme",
+			"repository":         "api",
+			"state":              "MERGED",
+			"destination_branch": "master",
+			"custom":             "kept",
+		},
+		map[string]interface{}{
+			"id":            int64(42),
+			"time_to_merge": int64(3600),
+			"comment_count": int64(3),
+		})
+
+	expected := []telegraf.Metric{
+		newMetric("code_review",
+			map[string]string{
+				"provider":      "bitbucket",
+				"owner":         "acme",
+				"repository":    "api",
+				"state":         "MERGED",
+				"target_branch": "master",
+				"custom":        "kept",
+			},
+			map[string]interface{}{
+				"id":            int64(42),
+				"time_to_merge": int64(3600),
+				"comments":      int64(3),
+			}),
+	}
+
+	testutil.RequireMetricsEqual(t, expected, c.Apply(in))
+}
+
+func TestConfiguredSourceDropUnmapped(t *testing.T) {
+	c := &CodeReview{
+		Measurement:  "code_review",
+		DropUnmapped: true,
+		Sources: []Source{
+			{
+				Measurement: "gitlab_merge_request",
+				Provider:    "gitlab",
+				Tags:        map[string]string{"project": "repository"},
+				Fields:      map[string]string{"notes": "comments"},
+			},
+		},
+	}
+
+	in := []telegraf.Metric{
+		newMetric("gitlab_merge_request",
+			map[string]string{"project": "api", "custom": "dropped"},
+			map[string]interface{}{"notes": int64(2), "custom": int64(1)}),
+		newMetric("bitbucket_pull_request",
+			map[string]string{"workspace": "acme"},
+			map[string]interface{}{"id": int64(1)}),
+	}
+
+	expected := []telegraf.Metric{
+		newMetric("code_review",
+			map[string]string{"provider": "gitlab", "repository": "api"},
+			map[string]interface{}{"comments": int64(2)}),
+		newMetric("bitbucket_pull_request",
+			map[string]string{"workspace": "acme"},
+			map[string]interface{}{"id": int64(1)}),
+	}
+
+	testutil.RequireMetricsEqual(t, expected, c.Apply(in...))
+}